@@ -8,6 +8,6 @@ import (
 
 func Migrate(cfg *config.Config, db *db.DB) error {
 
-	db.AutoMigrate(&model.Task{})
+	db.AutoMigrate(&model.Task{}, &model.TaskLogLine{})
 	return nil
 }
@@ -1,9 +1,15 @@
 package config
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/kelseyhightower/envconfig"
@@ -15,6 +21,18 @@ type Logger struct {
 
 type Server struct {
 	Port string `envconfig:"SERVER_PORT" default:"8888" validate:"numeric"`
+	TLS  TLS
+}
+
+// TLS certificates are reloaded on SIGHUP
+type TLS struct {
+	Enabled  bool   `envconfig:"TLS_ENABLED" default:"false"`
+	CertFile string `envconfig:"TLS_CERT_FILE" validate:"required_if=Enabled true"`
+	KeyFile  string `envconfig:"TLS_KEY_FILE" validate:"required_if=Enabled true"`
+	// CA bundle used to verify client certificates (mTLS)
+	ClientCAFile string `envconfig:"TLS_CLIENT_CA_FILE"`
+	// none: no client certificate, verify_if_given: verify it if the client sends one, require: every client must send a valid one
+	ClientAuth string `envconfig:"TLS_CLIENT_AUTH" default:"none" validate:"oneof=none verify_if_given require"`
 }
 
 type Debug struct {
@@ -40,10 +58,185 @@ type Swagger struct {
 
 type CMD struct {
 	Validate bool `envconfig:"CMD_VALIDATE" default:"false"`
+	// Lines longer than this many bytes are split or truncated
+	MaxLineLength int `envconfig:"CMD_MAX_LINE_LENGTH" default:"65536" validate:"gte=16"`
+	// What to do with lines longer than MaxLineLength
+	LongLines string `envconfig:"CMD_LONG_LINES" default:"split" validate:"oneof=split truncate"`
 }
 
 type TaskLogger struct {
 	DirPath string `envconfig:"TASK_LOGGER_DIR_PATH" default:"./task_logs"`
+	// Compression applied to the log file once the task reaches a terminal state
+	Compression string `envconfig:"TASK_LOGGER_COMPRESSION" default:"none" validate:"oneof=none gzip zstd"`
+	// Max log file size in bytes, the head and the tail of bigger outputs are kept, 0 disables it
+	MaxSize int64 `envconfig:"TASK_LOGGER_MAX_SIZE" default:"0" validate:"gte=0"`
+	// Reader of the logs without index: native reads them in process, exec runs sed and tail
+	Reader string `envconfig:"TASK_LOGGER_READER" default:"native" validate:"oneof=native exec"`
+}
+
+// RedactRule describes a pattern that is masked in task output before it is persisted or streamed.
+type RedactRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// RedactRules is decoded from a JSON array, e.g.
+// [{"name":"aws-key","pattern":"AKIA[0-9A-Z]{16}","replacement":"[AWS_KEY]"}]
+type RedactRules []RedactRule
+
+func (r *RedactRules) Decode(value string) error {
+	var rules []RedactRule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return fmt.Errorf("invalid redact rules: %w", err)
+	}
+
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("redact rule name is required")
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern for redact rule %q: %w", rule.Name, err)
+		}
+	}
+
+	*r = rules
+	return nil
+}
+
+type Redact struct {
+	Rules RedactRules `envconfig:"REDACT_RULES"`
+}
+
+type Auth struct {
+	// Header carrying the client API key, clients without a known key are identified by their certificate or IP
+	APIKeyHeader string `envconfig:"AUTH_API_KEY_HEADER" default:"X-API-Key"`
+	// API keys identifying clients for the rate limit and the quotas, comma separated
+	ClientKeys []string `envconfig:"AUTH_CLIENT_KEYS"`
+	// API keys with the approver role, comma separated
+	ApproverKeys []string `envconfig:"AUTH_APPROVER_KEYS"`
+	// API keys with the admin role, comma separated
+	AdminKeys []string `envconfig:"AUTH_ADMIN_KEYS"`
+}
+
+// HasKey reports whether the key is one of the configured client, approver or admin keys
+func (a *Auth) HasKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, keys := range [][]string{a.ClientKeys, a.ApproverKeys, a.AdminKeys} {
+		for _, k := range keys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type Approval struct {
+	// Commands flagged by the validator wait for an approver instead of being rejected, only with CMD_VALIDATE
+	Enabled bool `envconfig:"APPROVAL_ENABLED" default:"false"`
+}
+
+type RateLimit struct {
+	Enabled bool          `envconfig:"RATE_LIMIT_ENABLED" default:"false"`
+	Max     int           `envconfig:"RATE_LIMIT_MAX" default:"100" validate:"gte=1"`
+	Window  time.Duration `envconfig:"RATE_LIMIT_WINDOW" default:"1m"`
+	// Per client overrides of Max, keyed by client ID, e.g. "key:3f2a9c0e1b7d4a65:1000,ip:10.0.0.5:20"
+	Overrides RateLimitOverrides `envconfig:"RATE_LIMIT_OVERRIDES"`
+}
+
+// RateLimitOverrides is decoded from comma separated client:limit pairs. Clients are identified like task owners,
+// key:<first 16 hex digits of the SHA-256 of the API key>, cert:<certificate common name> or ip:<address>,
+// so the API keys themselves are not in the config. The limit is after the last colon of a pair.
+type RateLimitOverrides map[string]int
+
+func (o *RateLimitOverrides) Decode(value string) error {
+	overrides := make(RateLimitOverrides)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.LastIndexByte(pair, ':')
+		if i <= 0 {
+			return fmt.Errorf("invalid rate limit override %q, expected client:limit", pair)
+		}
+		limit, err := strconv.Atoi(pair[i+1:])
+		if err != nil || limit < 1 {
+			return fmt.Errorf("invalid limit of rate limit override %q", pair)
+		}
+		overrides[pair[:i]] = limit
+	}
+
+	*o = overrides
+	return nil
+}
+
+// Quota limits are applied per client, 0 disables the limit
+type Quota struct {
+	MaxQueuedTasks        int `envconfig:"QUOTA_MAX_QUEUED_TASKS" default:"0" validate:"gte=0"`
+	MaxRunningTasks       int `envconfig:"QUOTA_MAX_RUNNING_TASKS" default:"0" validate:"gte=0"`
+	MaxSubmissionsPerHour int `envconfig:"QUOTA_MAX_SUBMISSIONS_PER_HOUR" default:"0" validate:"gte=0"`
+}
+
+// Retention of finished tasks and their logs, 0 disables a limit
+type Retention struct {
+	Enabled  bool          `envconfig:"RETENTION_ENABLED" default:"false"`
+	Interval time.Duration `envconfig:"RETENTION_INTERVAL" default:"1h" validate:"gt=0"`
+	// Finished tasks older than this are removed
+	MaxAge time.Duration `envconfig:"RETENTION_MAX_AGE" default:"0" validate:"gte=0"`
+	// Per status overrides of MaxAge, keyed by status name, e.g. "failed:720h,canceled:24h"
+	MaxAgeByStatus map[string]time.Duration `envconfig:"RETENTION_MAX_AGE_BY_STATUS" validate:"dive,keys,oneof=completed failed canceled rejected,endkeys,gte=0"`
+	// Only the newest finished tasks are kept
+	MaxTasks int `envconfig:"RETENTION_MAX_TASKS" default:"0" validate:"gte=0"`
+	// Only the newest finished tasks whose logs fit in this many bytes are kept
+	MaxLogBytes int64 `envconfig:"RETENTION_MAX_LOG_BYTES" default:"0" validate:"gte=0"`
+}
+
+// LogStore selects where task logs are stored, the sql and s3 backends let several server instances share logs
+type LogStore struct {
+	Backend string `envconfig:"LOG_STORE_BACKEND" default:"fs" validate:"oneof=fs sql s3"`
+	S3      S3
+}
+
+// S3 compatible object store, e.g. AWS S3 or MinIO. The bucket must exist.
+type S3 struct {
+	Endpoint  string `envconfig:"LOG_STORE_S3_ENDPOINT" validate:"omitempty,url"`
+	Region    string `envconfig:"LOG_STORE_S3_REGION" default:"us-east-1"`
+	Bucket    string `envconfig:"LOG_STORE_S3_BUCKET"`
+	Prefix    string `envconfig:"LOG_STORE_S3_PREFIX" default:"task_logs/"`
+	AccessKey string `envconfig:"LOG_STORE_S3_ACCESS_KEY"`
+	SecretKey string `envconfig:"LOG_STORE_S3_SECRET_KEY"`
+	// Address the bucket in the path instead of the host name, required by MinIO
+	PathStyle bool `envconfig:"LOG_STORE_S3_PATH_STYLE" default:"true"`
+}
+
+type LogSearch struct {
+	// Searches scanning a log for longer than this are stopped
+	Timeout time.Duration `envconfig:"LOG_SEARCH_TIMEOUT" default:"30s" validate:"gt=0"`
+	// Logs scanned at the same time by the searches across tasks, shared by every request
+	Concurrency int `envconfig:"LOG_SEARCH_CONCURRENCY" default:"4" validate:"gt=0"`
+}
+
+// SSE configures the event stream of /api/v1/events
+type SSE struct {
+	// Events kept per task to replay to the clients reconnecting with Last-Event-ID
+	ReplaySize int `envconfig:"SSE_REPLAY_SIZE" default:"1000" validate:"gte=0"`
+	// Tasks whose events are kept for replay, the events of the least recently active tasks are dropped first
+	ReplayTasks int `envconfig:"SSE_REPLAY_TASKS" default:"100" validate:"gte=0"`
+	// Events queued per client, a client whose queue is full is a slow client
+	QueueSize int `envconfig:"SSE_QUEUE_SIZE" default:"1024" validate:"gt=0"`
+	// What happens to the events of a slow client: drop_oldest drops its oldest queued events, disconnect closes its
+	// connection, coalesce replaces its queued status update of the task and drops its log lines
+	SlowClientPolicy string `envconfig:"SSE_SLOW_CLIENT_POLICY" default:"drop_oldest" validate:"oneof=drop_oldest disconnect coalesce"`
+}
+
+// EventBus configures the bus publishing the events of the tasks to the components of the server
+type EventBus struct {
+	// Events buffered per subscriber, a subscriber whose buffer is full misses the events published until it catches up
+	BufferSize int `envconfig:"EVENT_BUS_BUFFER_SIZE" default:"4096" validate:"gt=0"`
 }
 
 type Config struct {
@@ -54,6 +247,16 @@ type Config struct {
 	Swagger    Swagger
 	CMD        CMD
 	TaskLogger TaskLogger
+	Redact     Redact
+	Auth       Auth
+	RateLimit  RateLimit
+	Quota      Quota
+	Approval   Approval
+	Retention  Retention
+	LogStore   LogStore
+	LogSearch  LogSearch
+	SSE        SSE
+	EventBus   EventBus
 }
 
 func NewConfig() (*Config, error) {
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitOverrides_Decode(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    RateLimitOverrides
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: RateLimitOverrides{}},
+		{
+			name:  "client IDs with colons",
+			value: "key:3f2a9c0e1b7d4a65:1000, ip:10.0.0.5:20,ip:2001:db8::1:5,cert:ci:50",
+			want:  RateLimitOverrides{"key:3f2a9c0e1b7d4a65": 1000, "ip:10.0.0.5": 20, "ip:2001:db8::1": 5, "cert:ci": 50},
+		},
+		{name: "missing limit", value: "ip:10.0.0.5", wantErr: true},
+		{name: "invalid limit", value: "ip:10.0.0.5:0", wantErr: true},
+		{name: "missing client", value: ":20", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var overrides RateLimitOverrides
+			err := overrides.Decode(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, overrides)
+		})
+	}
+}
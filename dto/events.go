@@ -0,0 +1,67 @@
+package dto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const MaxEventsTaskIDs = 100
+
+// EventsQuery filters the events of the SSE stream, every parameter takes comma separated values or can be repeated
+type EventsQuery struct {
+	TaskID []string `json:"task_id" query:"task_id"`                   // tasks to receive the events of, every task by default
+	Types  []string `json:"types" query:"types" enums:"status,log"`    // events to receive, every event by default
+	Status []string `json:"status" query:"status" example:"completed"` // statuses of the status events to receive, every status by default
+	// id of the last event received, for clients that can't send the Last-Event-ID header
+	LastEventID string `json:"last_event_id" query:"last_event_id"`
+}
+
+// Values validates the task ids of the query and returns them with the types and statuses of the query
+func (q *EventsQuery) Values() ([]uint64, []string, []string, error) {
+	var taskIDs []uint64
+	for _, value := range splitValues(q.TaskID) {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || id == 0 {
+			return nil, nil, nil, fmt.Errorf("invalid task_id %q", value)
+		}
+		taskIDs = append(taskIDs, id)
+	}
+	if len(taskIDs) > MaxEventsTaskIDs {
+		return nil, nil, nil, fmt.Errorf("at most %d task ids are allowed", MaxEventsTaskIDs)
+	}
+
+	return taskIDs, splitValues(q.Types), splitValues(q.Status), nil
+}
+
+// splitValues returns the comma separated values of repeated query parameters, empty values are skipped
+func splitValues(params []string) []string {
+	var values []string
+	for _, param := range params {
+		for _, value := range strings.Split(param, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+type ViewSSEClient struct {
+	ID          string `json:"id"`
+	ConnectedAt int64  `json:"connected_at"` // unix nano
+	Queued      int    `json:"queued"`
+	Sent        uint64 `json:"sent"`
+	Dropped     uint64 `json:"dropped"`
+	Coalesced   uint64 `json:"coalesced"`
+}
+
+type ViewSSEStats struct {
+	Policy       string           `json:"policy" enums:"drop_oldest,disconnect,coalesce"`
+	QueueSize    int              `json:"queue_size"`
+	Clients      []*ViewSSEClient `json:"clients"`
+	Dropped      uint64           `json:"dropped"`      // events dropped for slow clients, disconnected ones included
+	Coalesced    uint64           `json:"coalesced"`    // status updates that replaced a queued one
+	Disconnected uint64           `json:"disconnected"` // slow clients disconnected
+	Missed       uint64           `json:"missed"`       // events of the event bus missed by the server, every client got a resync
+}
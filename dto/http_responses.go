@@ -1,6 +1,8 @@
 package dto
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -104,3 +106,54 @@ func NewForbiddenResponse(ctx *fiber.Ctx, err string) error {
 	}
 	return ctx.Status(403).JSON(resp)
 }
+
+func NewTooManyRequestsResponse(ctx *fiber.Ctx, err string) error {
+	resp := &BaseResponse{
+		Success: false,
+		Code:    429,
+		Data:    nil,
+		Error:   err,
+		Message: "",
+	}
+	return ctx.Status(429).JSON(resp)
+}
+
+func NewGatewayTimeoutResponse(ctx *fiber.Ctx, err string) error {
+	resp := &BaseResponse{
+		Success: false,
+		Code:    504,
+		Data:    nil,
+		Error:   err,
+		Message: "",
+	}
+
+	return ctx.Status(504).JSON(resp)
+}
+
+func NewUpgradeRequiredResponse(ctx *fiber.Ctx, err string) error {
+	resp := &BaseResponse{
+		Success: false,
+		Code:    426,
+		Data:    nil,
+		Error:   err,
+		Message: "",
+	}
+	return ctx.Status(426).JSON(resp)
+}
+
+// NewErrorResponse returns the error with its status if it is a *fiber.Error, as an internal server error otherwise
+func NewErrorResponse(ctx *fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		code = fiberErr.Code
+	}
+	resp := &BaseResponse{
+		Success: false,
+		Code:    code,
+		Data:    nil,
+		Error:   err.Error(),
+		Message: "",
+	}
+	return ctx.Status(code).JSON(resp)
+}
@@ -1,15 +1,118 @@
 package dto
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/fattymango/px-take-home/internal/ansi"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/model"
+)
+
+type ViewLogLine struct {
+	LineNumber int             `json:"line_number"`
+	Stream     model.LogStream `json:"stream"`
+	Timestamp  int64           `json:"timestamp"` // unix nano, 0 if unknown
+	Line       string          `json:"line"`
+}
+
 type ViewTaskLogs struct {
-	Logs       []string `json:"logs"`
-	TotalLines int      `json:"total_lines"`
+	Logs       []*ViewLogLine `json:"logs"`
+	TotalLines int            `json:"total_lines"`
+	// Opaque cursors of the lines after and before this page, prev is empty at the start of the log
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+func ToViewLogLine(line *logreader.Line) *ViewLogLine {
+	return &ViewLogLine{LineNumber: line.Number, Stream: line.Stream, Timestamp: line.Time, Line: line.Text}
 }
 
-func ToViewTaskLogs(logs []string, totalLines int) *ViewTaskLogs {
-	return &ViewTaskLogs{Logs: logs, TotalLines: totalLines}
+// Render converts the line to the render format, see ansi.Render
+func (l *ViewLogLine) Render(render string) {
+	l.Line = ansi.Render(l.Line, render)
+}
+
+func ToViewLogLines(lines []*logreader.Line) []*ViewLogLine {
+	viewLines := make([]*ViewLogLine, len(lines))
+	for i, line := range lines {
+		viewLines[i] = ToViewLogLine(line)
+	}
+	return viewLines
+}
+
+func ToViewTaskLogs(logs []*logreader.Line, totalLines int) *ViewTaskLogs {
+	return &ViewTaskLogs{Logs: ToViewLogLines(logs), TotalLines: totalLines}
 }
 
 type TaskLogFilter struct {
-	From int `json:"from"`
-	To   int `json:"to"`
+	// Opaque cursor returned as next or prev by a previous page, it can't be used with a line or time range
+	Cursor string `json:"cursor" query:"cursor"`
+	Limit  int    `json:"limit" query:"limit"` // lines per page or time range, 100 by default, at most 1000
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+	Stream string `json:"stream" query:"stream" enums:"stdout,stderr,all"`
+	// RFC3339 time range of the lines to return, e.g. 2025-01-02T15:04:05.123Z
+	Since string `json:"since" query:"since"`
+	Until string `json:"until" query:"until"`
+	// raw returns the lines as captured, plain strips the escape sequences, html turns styles into spans
+	Render string `json:"render" query:"render" enums:"raw,plain,html"`
+}
+
+// ToLogFilter validates the stream and time range and converts the filter for the log reader
+func (f *TaskLogFilter) ToLogFilter() (*logreader.Filter, error) {
+	filter := &logreader.Filter{From: f.From, To: f.To}
+
+	stream, err := parseStream(f.Stream)
+	if err != nil {
+		return nil, err
+	}
+	filter.Stream = stream
+
+	if err := validateRender(f.Render); err != nil {
+		return nil, err
+	}
+
+	if f.Since != "" {
+		since, err := time.Parse(time.RFC3339Nano, f.Since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since, must be an RFC3339 time: %w", err)
+		}
+		filter.Since = since.UnixNano()
+	}
+
+	if f.Until != "" {
+		until, err := time.Parse(time.RFC3339Nano, f.Until)
+		if err != nil {
+			return nil, fmt.Errorf("invalid until, must be an RFC3339 time: %w", err)
+		}
+		filter.Until = until.UnixNano()
+	}
+
+	if filter.Since != 0 && filter.Until != 0 && filter.Since > filter.Until {
+		return nil, fmt.Errorf("since must be before until")
+	}
+
+	return filter, nil
+}
+
+// parseStream returns the stream of the given name, empty and "all" return 0 (all streams)
+func parseStream(name string) (model.LogStream, error) {
+	if name == "" || name == "all" {
+		return 0, nil
+	}
+	stream, ok := model.LogStream_value[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid stream, must be one of stdout, stderr, all")
+	}
+	return stream, nil
+}
+
+// validateRender checks the render format of the lines, empty is raw
+func validateRender(render string) error {
+	switch render {
+	case "", ansi.RenderRaw, ansi.RenderPlain, ansi.RenderHTML:
+		return nil
+	}
+	return fmt.Errorf("invalid render, must be one of raw, plain, html")
 }
@@ -0,0 +1,91 @@
+package dto
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+)
+
+const (
+	DefaultLogPageSize = 100
+	MaxLogPageSize     = 1000
+)
+
+// EncodeCursor returns the opaque form of a cursor of the log of a task
+func EncodeCursor(taskID uint64, cursor *logreader.Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+	direction := 'f'
+	if cursor.Backward {
+		direction = 'b'
+	}
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%d:%d:%c", taskID, cursor.Line, cursor.Offset, direction))
+}
+
+// DecodeCursor parses an opaque cursor, it must be a cursor of the log of the task
+func DecodeCursor(taskID uint64, s string) (*logreader.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var cursorTaskID uint64
+	var direction rune
+	cursor := &logreader.Cursor{}
+	if _, err := fmt.Sscanf(string(data), "%d:%d:%d:%c", &cursorTaskID, &cursor.Line, &cursor.Offset, &direction); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if cursorTaskID != taskID {
+		return nil, fmt.Errorf("cursor is not a cursor of task #%d", taskID)
+	}
+	if cursor.Line < 1 || cursor.Offset < -1 || (direction != 'f' && direction != 'b') {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	cursor.Backward = direction == 'b'
+	return cursor, nil
+}
+
+// PageCursor returns the cursor of the page to read, nil for the last lines of the log.
+// A single bound of the line range is a page starting at from or ending at to.
+func (f *TaskLogFilter) PageCursor(taskID uint64) (*logreader.Cursor, error) {
+	switch {
+	case f.Cursor != "":
+		if f.From != 0 || f.To != 0 || f.Since != "" || f.Until != "" {
+			return nil, fmt.Errorf("cursor can't be used with a line or time range")
+		}
+		return DecodeCursor(taskID, f.Cursor)
+	case f.From > 0:
+		return &logreader.Cursor{Line: f.From, Offset: -1}, nil
+	case f.To > 0:
+		return &logreader.Cursor{Line: f.To + 1, Offset: -1, Backward: true}, nil
+	}
+	return nil, nil
+}
+
+// IsPage reports whether the filter reads a page from a cursor, rather than a line range or a time range
+func (f *TaskLogFilter) IsPage() bool {
+	if f.Cursor != "" {
+		return true
+	}
+	return f.Since == "" && f.Until == "" && (f.From == 0 || f.To == 0)
+}
+
+// PageLimit returns the number of lines of the page
+func (f *TaskLogFilter) PageLimit() (int, error) {
+	if f.Limit < 0 || f.Limit > MaxLogPageSize {
+		return 0, fmt.Errorf("limit must be between 1 and %d", MaxLogPageSize)
+	}
+	if f.Limit == 0 {
+		return DefaultLogPageSize, nil
+	}
+	return f.Limit, nil
+}
+
+func ToViewTaskLogPage(taskID uint64, page *logreader.Page) *ViewTaskLogs {
+	view := ToViewTaskLogs(page.Lines, page.Total)
+	view.Next = EncodeCursor(taskID, page.Next)
+	view.Prev = EncodeCursor(taskID, page.Prev)
+	return view
+}
@@ -0,0 +1,118 @@
+package dto
+
+import (
+	"fmt"
+	"regexp"
+
+	logdiff "github.com/fattymango/px-take-home/internal/log_diff"
+	"github.com/fattymango/px-take-home/model"
+)
+
+const (
+	DiffFormatUnified = "unified"
+	DiffFormatJSON    = "json"
+)
+
+type TaskLogDiffQuery struct {
+	Format           string   `json:"format" query:"format" enums:"unified,json"`  // unified (text/plain, like diff -u) by default
+	IgnoreTimestamps bool     `json:"ignore_timestamps" query:"ignore_timestamps"` // ignore the dates and times printed in the lines
+	Ignore           []string `json:"ignore" query:"ignore"`                       // regexes (RE2 syntax) of parts of the lines to ignore, repeatable
+	Context          *int     `json:"context" query:"context"`                     // unchanged lines around every change, 3 by default, at most 100
+}
+
+// ToOptions validates the query and converts it for the log diff
+func (q *TaskLogDiffQuery) ToOptions() (*logdiff.Options, error) {
+	switch q.Format {
+	case "":
+		q.Format = DiffFormatUnified
+	case DiffFormatUnified, DiffFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid format, must be one of unified, json")
+	}
+
+	opts := &logdiff.Options{IgnoreTimestamps: q.IgnoreTimestamps, Context: logdiff.DefaultContext}
+	if q.Context != nil {
+		if *q.Context < 0 || *q.Context > logdiff.MaxContext {
+			return nil, fmt.Errorf("context must be between 0 and %d", logdiff.MaxContext)
+		}
+		opts.Context = *q.Context
+	}
+
+	if len(q.Ignore) > logdiff.MaxIgnorePatterns {
+		return nil, fmt.Errorf("at most %d ignore patterns are allowed", logdiff.MaxIgnorePatterns)
+	}
+	for _, pattern := range q.Ignore {
+		if pattern == "" {
+			return nil, fmt.Errorf("ignore pattern must not be empty")
+		}
+		if len(pattern) > logdiff.MaxPatternLength {
+			return nil, fmt.Errorf("ignore pattern is longer than %d bytes", logdiff.MaxPatternLength)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore regex: %w", err)
+		}
+		opts.Ignore = append(opts.Ignore, re)
+	}
+
+	return opts, nil
+}
+
+type ViewDiffLine struct {
+	Op        string          `json:"op" enums:" ,-,+"` // " " unchanged, "-" deleted from a, "+" inserted in b
+	ALine     int             `json:"a_line,omitempty"` // line number in the log of a, unchanged and deleted lines
+	BLine     int             `json:"b_line,omitempty"` // line number in the log of b, unchanged and inserted lines
+	Stream    model.LogStream `json:"stream"`
+	Timestamp int64           `json:"timestamp"`
+	Line      string          `json:"line"` // text of the line in a, of the line in b for inserted lines
+}
+
+type ViewDiffHunk struct {
+	AStart int             `json:"a_start"` // first line of the hunk in a, like the unified diff header
+	ALines int             `json:"a_lines"`
+	BStart int             `json:"b_start"`
+	BLines int             `json:"b_lines"`
+	Lines  []*ViewDiffLine `json:"lines"`
+}
+
+type ViewLogDiffStats struct {
+	A        uint64 `json:"a"`
+	B        uint64 `json:"b"`
+	ALines   int    `json:"a_lines"`
+	BLines   int    `json:"b_lines"`
+	Deleted  int    `json:"deleted"`
+	Inserted int    `json:"inserted"`
+}
+
+// ViewTaskLogDiff is the structured diff of two logs, it is streamed hunk by hunk
+type ViewTaskLogDiff struct {
+	ViewLogDiffStats
+	Hunks []*ViewDiffHunk `json:"hunks"`
+}
+
+func ToViewLogDiffStats(d *logdiff.Diff) *ViewLogDiffStats {
+	return &ViewLogDiffStats{A: d.A, B: d.B, ALines: d.ALines, BLines: d.BLines, Deleted: d.Deleted, Inserted: d.Inserted}
+}
+
+// ToViewDiffHunk returns the hunk without its lines, they are streamed after it
+func ToViewDiffHunk(h *logdiff.Hunk) *ViewDiffHunk {
+	return &ViewDiffHunk{AStart: h.AStart + 1, ALines: h.AEnd - h.AStart, BStart: h.BStart + 1, BLines: h.BEnd - h.BStart}
+}
+
+func ToViewDiffLine(l *logdiff.Line) *ViewDiffLine {
+	view := &ViewDiffLine{Op: string(l.Op)}
+	line := l.A
+	if l.A != nil {
+		view.ALine = l.A.Number
+	}
+	if l.B != nil {
+		view.BLine = l.B.Number
+		if l.A == nil {
+			line = l.B
+		}
+	}
+	view.Stream = line.Stream
+	view.Timestamp = line.Time
+	view.Line = line.Text
+	return view
+}
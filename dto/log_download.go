@@ -0,0 +1,40 @@
+package dto
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	LogFormatText   = "text"   // the log as plain text
+	LogFormatNDJSON = "ndjson" // a JSON object per line, after a task record
+	LogFormatCSV    = "csv"    // a CSV record per line, after the task records
+)
+
+type TaskLogDownloadQuery struct {
+	From   int    `json:"from" query:"from"`     // first line to download, the first line of the log by default
+	To     int    `json:"to" query:"to"`         // last line to download, the last line of the log by default
+	Format string `json:"format" query:"format"` // text (default), ndjson or csv
+}
+
+func (q *TaskLogDownloadQuery) Lines() bool {
+	return q.From != 0 || q.To != 0
+}
+
+// Export reports whether the log is exported line by line in a structured format
+func (q *TaskLogDownloadQuery) Export() bool {
+	return q.Format == LogFormatNDJSON || q.Format == LogFormatCSV
+}
+
+func (q *TaskLogDownloadQuery) Validate() error {
+	if q.From < 0 || q.To < 0 {
+		return fmt.Errorf("from and to must be positive")
+	}
+	if q.To != 0 && q.From > q.To {
+		return fmt.Errorf("from must be less than or equal to to")
+	}
+	if q.Format != "" && !slices.Contains([]string{LogFormatText, LogFormatNDJSON, LogFormatCSV}, q.Format) {
+		return fmt.Errorf("format must be one of %s, %s or %s", LogFormatText, LogFormatNDJSON, LogFormatCSV)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package dto
+
+import (
+	"strconv"
+	"strings"
+
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/model"
+)
+
+var (
+	LogExportTaskColumns = []string{"task_id", "name", "command", "status", "exit_code"}
+	LogExportLineColumns = []string{"line_number", "stream", "timestamp", "line"}
+)
+
+// ViewLogExportTask is the header record of an exported log
+type ViewLogExportTask struct {
+	ID       uint64 `json:"task_id"`
+	Name     string `json:"name"`
+	Command  string `json:"command"`
+	Status   string `json:"status"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// ViewLogExportLine is a line of an exported log, the stream is named so the export reads without the API docs
+type ViewLogExportLine struct {
+	LineNumber int    `json:"line_number"`
+	Stream     string `json:"stream,omitempty"`
+	Timestamp  int64  `json:"timestamp,omitempty"` // unix nano, omitted if unknown
+	Line       string `json:"line"`
+}
+
+func ToViewLogExportTask(t *model.Task) *ViewLogExportTask {
+	return &ViewLogExportTask{
+		ID:       t.ID,
+		Name:     t.Name,
+		Command:  t.Command,
+		Status:   model.TaskStatus_name[t.Status],
+		ExitCode: t.ExitCode,
+	}
+}
+
+func ToViewLogExportLine(line *logreader.Line) *ViewLogExportLine {
+	return &ViewLogExportLine{
+		LineNumber: line.Number,
+		Stream:     model.LogStream_name[line.Stream],
+		Timestamp:  line.Time,
+		Line:       line.Text,
+	}
+}
+
+// Record returns the task as a CSV record of LogExportTaskColumns
+func (t *ViewLogExportTask) Record() []string {
+	return []string{strconv.FormatUint(t.ID, 10), csvText(t.Name), csvText(t.Command), t.Status, strconv.Itoa(t.ExitCode)}
+}
+
+// Record returns the line as a CSV record of LogExportLineColumns, an unknown timestamp is empty
+func (l *ViewLogExportLine) Record() []string {
+	timestamp := ""
+	if l.Timestamp != 0 {
+		timestamp = strconv.FormatInt(l.Timestamp, 10)
+	}
+	return []string{strconv.Itoa(l.LineNumber), l.Stream, timestamp, csvText(l.Line)}
+}
+
+// csvText returns a text cell that spreadsheets would run as a formula prefixed with a quote, which shows it as text
+func csvText(s string) string {
+	if s != "" && strings.IndexByte("=+-@\t\r", s[0]) >= 0 {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,42 @@
+package dto
+
+import "fmt"
+
+const (
+	DefaultFollowTail = 100
+	MaxFollowTail     = 10000
+)
+
+type TaskLogFollowQuery struct {
+	From int `json:"from" query:"from"` // first line to send, 1 replays the whole log
+	Tail int `json:"tail" query:"tail"` // last lines to send before the live ones, 100 by default, at most 10000
+	// raw sends the lines as captured, plain strips the escape sequences, html turns styles into spans
+	Render string `json:"render" query:"render" enums:"raw,plain,html"`
+}
+
+// Validate checks the query, from and tail are exclusive, without both the last 100 lines are sent
+func (q *TaskLogFollowQuery) Validate() error {
+	if q.From < 0 || q.Tail < 0 {
+		return fmt.Errorf("from and tail must be positive")
+	}
+	if q.From > 0 && q.Tail > 0 {
+		return fmt.Errorf("from and tail can't be used together")
+	}
+	if err := validateRender(q.Render); err != nil {
+		return err
+	}
+	if q.Tail > MaxFollowTail {
+		return fmt.Errorf("tail must be at most %d", MaxFollowTail)
+	}
+	if q.From == 0 && q.Tail == 0 {
+		q.Tail = DefaultFollowTail
+	}
+	return nil
+}
+
+// ViewLogSkip is sent in place of the lines that can't be sent, like the lines in the tail of a truncated output
+// missed while the task is running, they only reach the log once it finished
+type ViewLogSkip struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
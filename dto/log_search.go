@@ -0,0 +1,205 @@
+package dto
+
+import (
+	"fmt"
+	"time"
+
+	logsearch "github.com/fattymango/px-take-home/internal/log_search"
+	"github.com/fattymango/px-take-home/model"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+
+	DefaultSearchTasks = 500
+	MaxSearchTasks     = 1000
+	DefaultTaskMatches = 3
+	MaxTaskMatches     = 10
+)
+
+type TaskLogSearchQuery struct {
+	Q          string `json:"q" query:"q"`                     // text or regex to find
+	Regex      bool   `json:"regex" query:"regex"`             // q is a regular expression (RE2 syntax)
+	IgnoreCase bool   `json:"ignore_case" query:"ignore_case"` // case insensitive match
+	Context    int    `json:"context" query:"context"`         // lines returned before and after every match, at most 10
+	Stream     string `json:"stream" query:"stream" enums:"stdout,stderr,all"`
+	Offset     int    `json:"offset" query:"offset"`
+	Limit      int    `json:"limit" query:"limit"` // matches per page, 20 by default, at most 100
+}
+
+// ToSearchQuery validates the query and converts it for the log search
+func (q *TaskLogSearchQuery) ToSearchQuery() (*logsearch.Query, error) {
+	if q.Context < 0 || q.Context > logsearch.MaxContext {
+		return nil, fmt.Errorf("context must be between 0 and %d", logsearch.MaxContext)
+	}
+	if q.Offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative")
+	}
+
+	if _, err := logsearch.NewMatcher(q.Q, q.Regex, q.IgnoreCase); err != nil {
+		return nil, err
+	}
+
+	stream, err := parseStream(q.Stream)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	return &logsearch.Query{
+		Pattern:    q.Q,
+		Regex:      q.Regex,
+		IgnoreCase: q.IgnoreCase,
+		Context:    q.Context,
+		Stream:     stream,
+		Offset:     q.Offset,
+		Limit:      min(limit, MaxSearchLimit),
+	}, nil
+}
+
+type ViewLogMatch struct {
+	ViewLogLine
+	Highlights [][2]int       `json:"highlights"` // [start, end) character offsets of the matches in the line
+	Before     []*ViewLogLine `json:"before"`
+	After      []*ViewLogLine `json:"after"`
+}
+
+type ViewTaskLogSearch struct {
+	Matches      []*ViewLogMatch `json:"matches"`
+	TotalMatches int             `json:"total_matches"`
+	TotalLines   int             `json:"total_lines"`
+	Offset       int             `json:"offset"`
+	Limit        int             `json:"limit"`
+}
+
+func toViewLogMatches(r *logsearch.Result) []*ViewLogMatch {
+	matches := make([]*ViewLogMatch, len(r.Matches))
+	for i, match := range r.Matches {
+		matches[i] = &ViewLogMatch{
+			ViewLogLine: *ToViewLogLine(match.Line),
+			Highlights:  match.Highlights,
+			Before:      ToViewLogLines(match.Before),
+			After:       ToViewLogLines(match.After),
+		}
+	}
+	return matches
+}
+
+func ToViewTaskLogSearch(r *logsearch.Result, query *logsearch.Query) *ViewTaskLogSearch {
+	matches := toViewLogMatches(r)
+
+	return &ViewTaskLogSearch{
+		Matches:      matches,
+		TotalMatches: r.TotalMatches,
+		TotalLines:   r.TotalLines,
+		Offset:       query.Offset,
+		Limit:        query.Limit,
+	}
+}
+
+// LogSearchQuery searches the logs of the most recent tasks selected by the task filters
+type LogSearchQuery struct {
+	Q          string `json:"q" query:"q"`                     // text or regex to find
+	Regex      bool   `json:"regex" query:"regex"`             // q is a regular expression (RE2 syntax)
+	IgnoreCase bool   `json:"ignore_case" query:"ignore_case"` // case insensitive match
+	Context    int    `json:"context" query:"context"`         // lines returned before and after every match, at most 10
+	Stream     string `json:"stream" query:"stream" enums:"stdout,stderr,all"`
+
+	Status int    `json:"status" query:"status"` // only tasks in this status
+	Name   string `json:"name" query:"name"`     // only tasks whose name contains it, case insensitive
+	// RFC3339 creation time range of the tasks, e.g. 2025-01-02T15:04:05Z
+	CreatedAfter  string `json:"created_after" query:"created_after"`
+	CreatedBefore string `json:"created_before" query:"created_before"`
+
+	Tasks   int `json:"tasks" query:"tasks"`     // most recent tasks searched, 500 by default, at most 1000
+	Matches int `json:"matches" query:"matches"` // matching lines returned per task, 3 by default, at most 10
+}
+
+// TaskFilters validates the task filters and returns the creation time range (unix nano, 0 when unbounded)
+// with the number of tasks to search
+func (q *LogSearchQuery) TaskFilters() (int64, int64, int, error) {
+	if q.Status != 0 {
+		if _, ok := model.TaskStatus_name[model.TaskStatus(q.Status)]; !ok {
+			return 0, 0, 0, fmt.Errorf("invalid status")
+		}
+	}
+
+	var createdAfter, createdBefore int64
+	if q.CreatedAfter != "" {
+		after, err := time.Parse(time.RFC3339Nano, q.CreatedAfter)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid created_after, must be an RFC3339 time: %w", err)
+		}
+		createdAfter = after.UnixNano()
+	}
+
+	if q.CreatedBefore != "" {
+		before, err := time.Parse(time.RFC3339Nano, q.CreatedBefore)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid created_before, must be an RFC3339 time: %w", err)
+		}
+		createdBefore = before.UnixNano()
+	}
+
+	if createdAfter != 0 && createdBefore != 0 && createdAfter > createdBefore {
+		return 0, 0, 0, fmt.Errorf("created_after must be before created_before")
+	}
+
+	if q.Tasks < 0 {
+		return 0, 0, 0, fmt.Errorf("tasks must not be negative")
+	}
+	tasks := q.Tasks
+	if tasks == 0 {
+		tasks = DefaultSearchTasks
+	}
+
+	return createdAfter, createdBefore, min(tasks, MaxSearchTasks), nil
+}
+
+// ToSearchQuery validates the pattern and returns the query run on the log of every task
+func (q *LogSearchQuery) ToSearchQuery() (*logsearch.Query, error) {
+	matches := q.Matches
+	if matches <= 0 {
+		matches = DefaultTaskMatches
+	}
+
+	taskQuery := &TaskLogSearchQuery{Q: q.Q, Regex: q.Regex, IgnoreCase: q.IgnoreCase, Context: q.Context, Stream: q.Stream, Limit: min(matches, MaxTaskMatches)}
+	return taskQuery.ToSearchQuery()
+}
+
+type ViewTaskMatches struct {
+	Task         *ViewTask       `json:"task"`
+	Matches      []*ViewLogMatch `json:"matches"`       // first matching lines of the log
+	TotalMatches int             `json:"total_matches"` // matching lines in the whole log
+	TotalLines   int             `json:"total_lines"`
+}
+
+type ViewLogSearch struct {
+	Tasks    []*ViewTaskMatches `json:"tasks"`    // tasks with at least a match, most recent first
+	Total    int64              `json:"total"`    // tasks selected by the filters
+	Searched int                `json:"searched"` // tasks whose log was searched
+	Complete bool               `json:"complete"` // false if the search timed out, the result holds the tasks searched so far
+}
+
+func ToViewLogSearch(tasks []*model.Task, total int64, r *logsearch.TasksResult) *ViewLogSearch {
+	byID := make(map[uint64]*model.Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+
+	view := &ViewLogSearch{Tasks: make([]*ViewTaskMatches, len(r.Tasks)), Total: total, Searched: r.Searched, Complete: r.Complete}
+	for i, result := range r.Tasks {
+		view.Tasks[i] = &ViewTaskMatches{
+			Task:         ToViewTask(byID[result.TaskID]),
+			Matches:      toViewLogMatches(result.Result),
+			TotalMatches: result.TotalMatches,
+			TotalLines:   result.TotalLines,
+		}
+	}
+	return view
+}
@@ -0,0 +1,49 @@
+package dto
+
+import (
+	"github.com/fattymango/px-take-home/internal/janitor"
+	"github.com/fattymango/px-take-home/model"
+)
+
+type ViewRetentionRemoval struct {
+	TaskID  uint64           `json:"task_id"`
+	Name    string           `json:"name"`
+	Status  model.TaskStatus `json:"status"`
+	EndTime uint64           `json:"end_time"`
+	Reason  string           `json:"reason" enums:"max_age,max_tasks,max_log_bytes"`
+	Bytes   int64            `json:"bytes"`
+}
+
+type ViewRetentionReport struct {
+	DryRun         bool                    `json:"dry_run"`
+	StartedAt      int64                   `json:"started_at"` // unix nano
+	Removed        []*ViewRetentionRemoval `json:"removed"`
+	RemovedTasks   int                     `json:"removed_tasks"`
+	ReclaimedBytes int64                   `json:"reclaimed_bytes"`
+	KeptTasks      int                     `json:"kept_tasks"`
+	KeptBytes      int64                   `json:"kept_bytes"`
+}
+
+func ToViewRetentionReport(r *janitor.Report) *ViewRetentionReport {
+	removed := make([]*ViewRetentionRemoval, len(r.Removals))
+	for i, removal := range r.Removals {
+		removed[i] = &ViewRetentionRemoval{
+			TaskID:  removal.Task.ID,
+			Name:    removal.Task.Name,
+			Status:  removal.Task.Status,
+			EndTime: removal.Task.EndTime,
+			Reason:  removal.Reason,
+			Bytes:   removal.Bytes,
+		}
+	}
+
+	return &ViewRetentionReport{
+		DryRun:         r.DryRun,
+		StartedAt:      r.StartedAt.UnixNano(),
+		Removed:        removed,
+		RemovedTasks:   len(removed),
+		ReclaimedBytes: r.ReclaimedBytes,
+		KeptTasks:      r.KeptTasks,
+		KeptBytes:      r.KeptBytes,
+	}
+}
@@ -5,12 +5,15 @@ import "github.com/fattymango/px-take-home/model"
 type CrtTask struct {
 	Name    string `json:"name" validate:"required"`
 	Command string `json:"command" validate:"required"`
+	// Keep the stdin of the command open for the stdin command of the WebSocket API
+	Stdin bool `json:"stdin"`
 }
 
 func (c *CrtTask) ToTask() *model.Task {
 	return &model.Task{
 		Name:    c.Name,
 		Command: c.Command,
+		Stdin:   c.Stdin,
 		Status:  model.TaskStatus_Queued,
 	}
 }
@@ -29,11 +32,22 @@ type ViewTask struct {
 	ID        uint64           `json:"id"`
 	Name      string           `json:"name"`
 	Command   string           `json:"command"`
+	Owner     string           `json:"owner"`
 	Status    model.TaskStatus `json:"status"`
 	Reason    string           `json:"reason"`
 	ExitCode  int              `json:"exit_code"`
 	StartTime uint64           `json:"start_time"`
 	EndTime   uint64           `json:"end_time"`
+
+	Redactions map[string]int64 `json:"redactions,omitempty"`
+	Truncated  bool             `json:"truncated,omitempty"`
+	Stdin      bool             `json:"stdin,omitempty"`
+
+	Findings       string               `json:"findings,omitempty"`
+	ReviewDecision model.ReviewDecision `json:"review_decision,omitempty"`
+	ReviewedBy     string               `json:"reviewed_by,omitempty"`
+	ReviewComment  string               `json:"review_comment,omitempty"`
+	ReviewedAt     uint64               `json:"reviewed_at,omitempty"`
 }
 
 func ToViewTask(t *model.Task) *ViewTask {
@@ -41,11 +55,22 @@ func ToViewTask(t *model.Task) *ViewTask {
 		ID:        t.ID,
 		Name:      t.Name,
 		Command:   t.Command,
+		Owner:     t.Owner,
 		Status:    t.Status,
 		Reason:    t.Reason,
 		ExitCode:  t.ExitCode,
 		StartTime: t.StartTime,
 		EndTime:   t.EndTime,
+
+		Redactions: t.Redactions,
+		Truncated:  t.Truncated,
+		Stdin:      t.Stdin,
+
+		Findings:       t.Findings,
+		ReviewDecision: t.ReviewDecision,
+		ReviewedBy:     t.ReviewedBy,
+		ReviewComment:  t.ReviewComment,
+		ReviewedAt:     t.ReviewedAt,
 	}
 }
 
@@ -65,3 +90,7 @@ func ToListTasks(tasks []*model.Task, total int64) *ListTasks {
 		Total: total,
 	}
 }
+
+type ReviewTask struct {
+	Comment string `json:"comment"`
+}
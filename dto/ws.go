@@ -0,0 +1,132 @@
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Commands of the WebSocket clients
+const (
+	WSCommandSubscribe   = "subscribe"
+	WSCommandUnsubscribe = "unsubscribe"
+	WSCommandCancel      = "cancel"
+	WSCommandStdin       = "stdin"
+	WSCommandLogs        = "logs"
+	WSCommandPing        = "ping"
+)
+
+var WSCommands = []string{WSCommandSubscribe, WSCommandUnsubscribe, WSCommandCancel, WSCommandStdin, WSCommandLogs, WSCommandPing}
+
+// Messages sent to the WebSocket clients
+const (
+	WSMessageEvent    = "event"
+	WSMessageConnect  = "connect"
+	WSMessageResync   = "resync"
+	WSMessageResponse = "response"
+)
+
+// WSCommand is a command of a WebSocket client, the response to it carries its id
+type WSCommand struct {
+	ID   string `json:"id"`
+	Type string `json:"type" enums:"subscribe,unsubscribe,cancel,stdin,logs,ping"`
+
+	// subscribe and unsubscribe: tasks added to or removed from the subscription, every task by default.
+	// types and status replace those of the subscription, see EventsQuery.
+	TaskIDs []uint64 `json:"task_ids"`
+	Types   []string `json:"types"`
+	Status  []string `json:"status"`
+
+	// cancel, stdin and logs
+	TaskID uint64 `json:"task_id"`
+
+	// stdin: data written to the stdin of the task, eof closes it afterwards
+	Data string `json:"data"`
+	EOF  bool   `json:"eof"`
+
+	// logs: the query of the logs endpoint
+	TaskLogFilter
+}
+
+// Validate checks the command type and the task of the commands of a task
+func (c *WSCommand) Validate() error {
+	if c.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if !slices.Contains(WSCommands, c.Type) {
+		return fmt.Errorf("invalid type %q", c.Type)
+	}
+	if (c.Type == WSCommandCancel || c.Type == WSCommandStdin || c.Type == WSCommandLogs) && c.TaskID == 0 {
+		return fmt.Errorf("task_id is required")
+	}
+	if c.Type == WSCommandStdin && c.Data == "" && !c.EOF {
+		return fmt.Errorf("data or eof is required")
+	}
+	return nil
+}
+
+// WSEvent is a status update or a log line, data is the event sent by the SSE stream
+type WSEvent struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data"`
+}
+
+func ToWSEvent(id string, data []byte) *WSEvent {
+	return &WSEvent{Type: WSMessageEvent, ID: id, Data: data}
+}
+
+// WSConnect is the first message of a connection
+type WSConnect struct {
+	Type string `json:"type"`
+	ID   string `json:"id"` // id of the last event sent before the connection
+}
+
+func ToWSConnect(id string) *WSConnect {
+	return &WSConnect{Type: WSMessageConnect, ID: id}
+}
+
+// WSResync tells the client it missed events because it was too slow, it should reload the tasks it shows
+type WSResync struct {
+	Type    string `json:"type"`
+	Dropped uint64 `json:"dropped"`
+}
+
+func ToWSResync(dropped uint64) *WSResync {
+	return &WSResync{Type: WSMessageResync, Dropped: dropped}
+}
+
+// WSResponse is the response to a command, code and data are those of the matching HTTP endpoint
+type WSResponse struct {
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id"`
+	Success   bool        `json:"success"`
+	Code      int         `json:"code"`
+	Data      interface{} `json:"data"`
+	Error     string      `json:"error"`
+}
+
+func NewWSSuccessResponse(requestID string, data interface{}) *WSResponse {
+	return &WSResponse{Type: WSMessageResponse, RequestID: requestID, Success: true, Code: 200, Data: data}
+}
+
+// NewWSErrorResponse returns the error with its status if it is a *fiber.Error, as an internal server error otherwise
+func NewWSErrorResponse(requestID string, err error) *WSResponse {
+	code := fiber.StatusInternalServerError
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		code = fiberErr.Code
+	}
+	return &WSResponse{Type: WSMessageResponse, RequestID: requestID, Code: code, Error: err.Error()}
+}
+
+// ViewWSSubscription is the subscription of a client, returned by subscribe and unsubscribe
+type ViewWSSubscription struct {
+	Subscribed bool     `json:"subscribed"`
+	TaskIDs    []uint64 `json:"task_ids"` // every task if empty
+	Types      []string `json:"types"`
+	Status     []string `json:"status"`
+}
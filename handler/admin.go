@@ -0,0 +1,99 @@
+package server
+
+import (
+	"github.com/fattymango/px-take-home/dto"
+	"github.com/fattymango/px-take-home/internal/sse"
+	"github.com/gofiber/fiber/v2"
+)
+
+// @Tags Admin
+// @Summary Preview retention
+// @Router /api/v1/admin/retention [get]
+// @Security BearerAuth
+// @Description Dry run of the retention janitor, lists the finished tasks and log files that would be removed
+// @Accept json
+// @Produce json
+//
+// @Success	200	{object} dto.ViewRetentionReport "Success"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+// @Failure	403	{object} dto.BaseResponse	"Forbidden"
+// @Failure	500	{object} dto.BaseResponse	"Internal Server Error"
+//
+// @Security BearerAuth
+// @ID PreviewRetention
+func (s *Server) PreviewRetention(c *fiber.Ctx) error {
+	report, err := s.janitor.Run(true)
+	if err != nil {
+		return dto.NewInternalServerErrorResponse(c, err.Error())
+	}
+
+	return dto.NewSuccessResponse(c, dto.ToViewRetentionReport(report))
+}
+
+// @Tags Admin
+// @Summary Run retention
+// @Router /api/v1/admin/retention [post]
+// @Security BearerAuth
+// @Description Run the retention janitor now, finished tasks out of retention are soft deleted and their log files removed
+// @Accept json
+// @Produce json
+//
+// @Success	200	{object} dto.ViewRetentionReport "Success"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+// @Failure	403	{object} dto.BaseResponse	"Forbidden"
+// @Failure	500	{object} dto.BaseResponse	"Internal Server Error"
+//
+// @Security BearerAuth
+// @ID RunRetention
+func (s *Server) RunRetention(c *fiber.Ctx) error {
+	report, err := s.janitor.Run(false)
+	if err != nil {
+		return dto.NewInternalServerErrorResponse(c, err.Error())
+	}
+
+	s.logger.Infof("retention run removed %d tasks, reclaimed %d bytes", len(report.Removals), report.ReclaimedBytes)
+	return dto.NewSuccessResponse(c, dto.ToViewRetentionReport(report))
+}
+
+// @Tags Admin
+// @Summary SSE stats
+// @Router /api/v1/admin/sse [get]
+// @Security BearerAuth
+// @Description Counters of the SSE clients: events queued and sent per client, and the events dropped or coalesced
+// @Description and the clients disconnected by the slow client policy (SSE_SLOW_CLIENT_POLICY)
+// @Accept json
+// @Produce json
+//
+// @Success	200	{object} dto.ViewSSEStats "Success"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+// @Failure	403	{object} dto.BaseResponse	"Forbidden"
+//
+// @Security BearerAuth
+// @ID GetSSEStats
+func (s *Server) GetSSEStats(c *fiber.Ctx) error {
+	return dto.NewSuccessResponse(c, toViewSSEStats(s.sseManager.Stats()))
+}
+
+func toViewSSEStats(stats *sse.Stats) *dto.ViewSSEStats {
+	clients := make([]*dto.ViewSSEClient, len(stats.Clients))
+	for i, client := range stats.Clients {
+		clients[i] = &dto.ViewSSEClient{
+			ID:          client.ID,
+			ConnectedAt: client.ConnectedAt.UnixNano(),
+			Queued:      client.Queued,
+			Sent:        client.Sent,
+			Dropped:     client.Dropped,
+			Coalesced:   client.Coalesced,
+		}
+	}
+
+	return &dto.ViewSSEStats{
+		Policy:       stats.Policy,
+		QueueSize:    stats.QueueSize,
+		Clients:      clients,
+		Dropped:      stats.Dropped,
+		Coalesced:    stats.Coalesced,
+		Disconnected: stats.Disconnected,
+		Missed:       stats.Missed,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 
 	"github.com/fattymango/px-take-home/internal/middleware"
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/gofiber/contrib/swagger"
@@ -19,9 +20,6 @@ func (s *Server) RegisterRoutes() {
 	// Logging Middleware
 	root.Use(middleware.Logger(s.logger))
 
-	// Rate Limiter Middleware
-	// root.Use(middleware.RateLimiter(s.logger))
-
 	// Swagger UI
 	s.RegisterSwagger(root)
 
@@ -29,14 +27,28 @@ func (s *Server) RegisterRoutes() {
 	root.Static("/", "./web")
 
 	api := root.Group("/api")
+
+	// Rate Limiter Middleware, only applied to the API, static files are not limited
+	if s.config.RateLimit.Enabled {
+		api.Use(middleware.RateLimiter(s.config, s.logger))
+	}
 	v1 := api.Group("/v1")
 
 	// Task
 	s.RegisterTaskAPIs(v1)
 
+	// Logs
+	s.RegisterLogAPIs(v1)
+
 	// SSE
 	s.RegisterSSEHandlers(v1)
 
+	// WebSocket
+	s.RegisterWebSocketHandlers(v1)
+
+	// Admin
+	s.RegisterAdminAPIs(v1)
+
 }
 
 func (s *Server) RegisterSwagger(router fiber.Router) {
@@ -61,8 +73,29 @@ func (s *Server) RegisterTaskAPIs(router fiber.Router) {
 	task.Get("/", s.GetAllTasks)
 	task.Get("/:taskID", s.GetTaskByID)
 	task.Get("/:taskID/logs", s.GetTaskLogsByID)
+	task.Get("/:taskID/logs/search", s.SearchTaskLogs)
+	task.Get("/:taskID/logs/follow", s.FollowTaskLogs)
 	task.Get("/:taskID/logs/download", s.DownloadTaskLogs)
+	task.Get("/:taskID/logs/diff/:otherTaskID", s.DiffTaskLogs)
 	task.Delete("/:taskID/cancel", s.CancelTask)
+
+	approver := middleware.RequireAPIKey(s.config.Auth.APIKeyHeader, s.config.Auth.ApproverKeys)
+	task.Post("/:taskID/approve", approver, s.ApproveTask)
+	task.Post("/:taskID/reject", approver, s.RejectTask)
+}
+
+func (s *Server) RegisterLogAPIs(router fiber.Router) {
+	logs := router.Group("/logs")
+
+	logs.Get("/search", s.SearchAllTaskLogs)
+}
+
+func (s *Server) RegisterAdminAPIs(router fiber.Router) {
+	admin := router.Group("/admin", middleware.RequireAPIKey(s.config.Auth.APIKeyHeader, s.config.Auth.AdminKeys))
+
+	admin.Get("/retention", s.PreviewRetention)
+	admin.Post("/retention", s.RunRetention)
+	admin.Get("/sse", s.GetSSEStats)
 }
 
 func (s *Server) RegisterSSEHandlers(router fiber.Router) error {
@@ -70,3 +103,7 @@ func (s *Server) RegisterSSEHandlers(router fiber.Router) error {
 
 	return nil
 }
+
+func (s *Server) RegisterWebSocketHandlers(router fiber.Router) {
+	router.Get("/ws", s.WebSocketUpgrade, websocket.New(s.WebSocket))
+}
@@ -1,9 +1,15 @@
 package server
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 
 	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/internal/certs"
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	"github.com/fattymango/px-take-home/internal/janitor"
+	logstore "github.com/fattymango/px-take-home/internal/log_store"
 	"github.com/fattymango/px-take-home/internal/middleware"
 	"github.com/fattymango/px-take-home/internal/sse"
 	"github.com/fattymango/px-take-home/internal/task"
@@ -23,19 +29,44 @@ type Server struct {
 	TaskManager *task.TaskManager
 
 	sseManager *sse.SseManager
+
+	// publishes the events of the tasks, closed once the task manager stopped
+	bus *eventbus.Bus
+
+	janitor *janitor.Janitor
+
+	// nil when TLS is disabled
+	certReloader *certs.Reloader
 }
 
 func NewServer(cfg *config.Config, logger *logger.Logger, db *db.DB) (*Server, error) {
-	taskManager := task.NewTaskManager(cfg, logger, task.NewTaskDBStore(cfg, logger, db))
+	taskStore := task.NewTaskDBStore(cfg, logger, db)
+	logStore, err := logstore.NewLogStore(cfg, logger, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log store: %w", err)
+	}
+	bus := eventbus.NewBus(cfg, logger)
+	taskManager := task.NewTaskManager(cfg, logger, taskStore, logStore, bus)
+
+	var certReloader *certs.Reloader
+	if cfg.Server.TLS.Enabled {
+		certReloader, err = certs.NewReloader(cfg, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificates: %w", err)
+		}
+	}
 
 	return &Server{
-		config:      cfg,
-		logger:      logger,
-		App:         fiber.New(),
-		db:          db,
-		validator:   validator.New(),
-		TaskManager: taskManager,
-		sseManager:  sse.NewSseManager(cfg, logger, taskManager.TaskUpdatesStream(), taskManager.LogStream()),
+		config:       cfg,
+		logger:       logger,
+		App:          fiber.New(),
+		db:           db,
+		validator:    validator.New(),
+		TaskManager:  taskManager,
+		sseManager:   sse.NewSseManager(cfg, logger, bus),
+		bus:          bus,
+		janitor:      janitor.NewJanitor(cfg, logger, taskStore, logStore),
+		certReloader: certReloader,
 	}, nil
 }
 
@@ -44,7 +75,31 @@ func (s *Server) Start() error {
 	s.RegisterRoutes()
 	s.TaskManager.Start()
 	s.sseManager.Start()
-	err := s.App.Listen(":" + s.config.Server.Port)
+	if s.config.Retention.Enabled {
+		s.janitor.Start()
+	}
+
+	if s.certReloader == nil {
+		err := s.App.Listen(":" + s.config.Server.Port)
+		if err != nil {
+			return fmt.Errorf("failed to start server: %w", err)
+		}
+		return nil
+	}
+
+	tlsConfig, err := s.certReloader.TLSConfig()
+	if err != nil {
+		return fmt.Errorf("failed to create TLS config: %w", err)
+	}
+
+	ln, err := net.Listen(s.App.Config().Network, ":"+s.config.Server.Port)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	s.certReloader.Start()
+	s.logger.Infof("serving TLS, client auth: %s", s.config.Server.TLS.ClientAuth)
+	err = s.App.Listener(tls.NewListener(ln, tlsConfig))
 	if err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
@@ -54,7 +109,14 @@ func (s *Server) Start() error {
 func (s *Server) Stop() error {
 	s.logger.Info("Stopping server...")
 	s.TaskManager.Stop()
+	s.bus.Close()
 	s.sseManager.Stop()
+	if s.config.Retention.Enabled {
+		s.janitor.Stop()
+	}
+	if s.certReloader != nil {
+		s.certReloader.Stop()
+	}
 	err := s.App.Shutdown()
 
 	return err
@@ -65,9 +127,9 @@ type Middlewares struct {
 	Logger      fiber.Handler
 }
 
-func newMiddlewares(logger *logger.Logger) *Middlewares {
+func newMiddlewares(cfg *config.Config, logger *logger.Logger) *Middlewares {
 	return &Middlewares{
-		RateLimiter: middleware.RateLimiter(logger),
+		RateLimiter: middleware.RateLimiter(cfg, logger),
 		Logger:      middleware.Logger(logger),
 	}
 }
@@ -2,35 +2,71 @@ package server
 
 import (
 	"bufio"
-	"fmt"
 
+	"github.com/fattymango/px-take-home/dto"
+	"github.com/fattymango/px-take-home/internal/sse"
+	"github.com/fattymango/px-take-home/pkg/ctxstore"
 	"github.com/gofiber/fiber/v2"
 	"github.com/valyala/fasthttp"
 )
 
+// @Tags Events
+// @Summary Stream task events
+// @Router /api/v1/events [get]
+// @Security BearerAuth
+// @Description Stream the status updates and log lines of the tasks as server sent events.
+// @Description task_id, types (status, log) and status select the events sent, a client only receives the events matching all of them.
+// @Description Every parameter takes comma separated values or can be repeated, status only applies to status events.
+// @Description Every event has an id, clients reconnecting with Last-Event-ID (or last_event_id) first get the events they missed,
+// @Description followed by a resync event if some of them are no longer kept, then the connect event and the live events.
+// @Accept json
+// @Produce text/event-stream
+//
+// @Param query query dto.EventsQuery false "Filters"
+//
+// @Success	200	{string} string "Event stream"
+// @Failure	400	{object} dto.BaseResponse	"Bad Request"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+//
+// @Security BearerAuth
+// @ID StreamEvents
 func (s *Server) SSE(c *fiber.Ctx) error {
+	query, err := ctxstore.GetEventsQueryFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+	filter, err := eventsFilter(query)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
 	c.Set("Content-Type", "text/event-stream")
 	c.Set("Cache-Control", "no-cache")
 	c.Set("Connection", "keep-alive")
 	c.Set("Transfer-Encoding", "chunked")
 
+	lastEventID := c.Get("Last-Event-ID", query.LastEventID)
+
 	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
-		// Send initial connection message
-		fmt.Fprintf(w, "event: connect\ndata: {\"status\": \"connected\"}\n\n")
-		err := w.Flush()
-		if err != nil {
-			s.logger.Errorf("Error while flushing initial message: %v", err)
-			return
-		}
-
-		client := s.sseManager.NewSSEClient(w)
+		// The missed events and the initial connection message are sent before the live events
+		client := s.sseManager.AddClient(sse.NewSSEWriter(w), filter, lastEventID)
 		s.logger.Infof("SSE connection client created: %s", client.ID)
 
+		// Wait writes the events of the client, a slow client only delays its own events
 		client.Wait()
 
 		s.logger.Infof("SSE connection closed: %s", client.ID)
-		s.sseManager.RemoveSSEClient(client.ID)
+		s.sseManager.RemoveClient(client.ID)
 	}))
 
 	return nil
 }
+
+// eventsFilter validates the query and returns the filter of the SSE client
+func eventsFilter(query *dto.EventsQuery) (*sse.Filter, error) {
+	taskIDs, types, statuses, err := query.Values()
+	if err != nil {
+		return nil, err
+	}
+	return sse.NewFilter(taskIDs, types, statuses)
+}
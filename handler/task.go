@@ -1,9 +1,14 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
 
 	"github.com/fattymango/px-take-home/dto"
+	"github.com/fattymango/px-take-home/internal/task"
+	"github.com/fattymango/px-take-home/model"
 	"github.com/fattymango/px-take-home/pkg/ctxstore"
 	"github.com/gofiber/fiber/v2"
 )
@@ -20,6 +25,7 @@ import (
 // @Failure	400	{object} dto.BaseResponse	"Bad Request"
 // @Failure	401	{object} dto.BaseResponse	"Unauthorized"
 // @Failure	404	{object} dto.BaseResponse	"Not Found"
+// @Failure	429	{object} dto.BaseResponse	"Quota Exceeded"
 // @Failure	500	{object} dto.BaseResponse	"Internal Server Error"
 //
 // @Security BearerAuth
@@ -34,19 +40,32 @@ func (s *Server) CreateTask(c *fiber.Ctx) error {
 		return dto.NewBadRequestResponse(c, err.Error())
 	}
 
-	task, err := s.TaskManager.CreateTask(crt.ToTask())
+	newTask := crt.ToTask()
+	newTask.Owner = ctxstore.GetClientIDFromCtx(c, &s.config.Auth)
+
+	createdTask, err := s.TaskManager.CreateTask(newTask)
 	if err != nil {
+		var quotaErr *task.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			if quotaErr.RetryAfter > 0 {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(quotaErr.RetryAfter.Seconds()))))
+			}
+			return dto.NewTooManyRequestsResponse(c, fmt.Sprintf("quota exceeded: %s", quotaErr))
+		}
 		return dto.NewInternalServerErrorResponse(c, fmt.Sprintf("failed to create task: %s", err))
 	}
 
-	go func() {
-		err = s.TaskManager.QueueTask(task)
-		if err != nil {
-			s.logger.Error("failed to queue task", "error", err)
-		}
-	}()
+	// Tasks pending approval are queued once approved
+	if createdTask.Status == model.TaskStatus_Queued {
+		go func() {
+			err = s.TaskManager.QueueTask(createdTask)
+			if err != nil {
+				s.logger.Error("failed to queue task", "error", err)
+			}
+		}()
+	}
 
-	return dto.NewSuccessResponse(c, dto.ToViewTaskID(task.ID))
+	return dto.NewSuccessResponse(c, dto.ToViewTaskID(createdTask.ID))
 }
 
 // @Tags Task
@@ -136,7 +155,14 @@ func (s *Server) CancelTask(c *fiber.Ctx) error {
 		return dto.NewBadRequestResponse(c, fmt.Sprintf("failed to get task ID: %s", err))
 	}
 
+	if _, err := s.TaskManager.GetTask(taskID); err != nil {
+		return dto.NewNotFoundResponse(c, fmt.Sprintf("task #%d not found", taskID))
+	}
+
 	err = s.TaskManager.CancelTask(taskID)
+	if errors.Is(err, task.ErrNotRunning) {
+		return dto.NewBadRequestResponse(c, fmt.Sprintf("task #%d is not running", taskID))
+	}
 	if err != nil {
 		return dto.NewInternalServerErrorResponse(c, fmt.Sprintf("failed to cancel task: %s", err))
 	}
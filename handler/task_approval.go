@@ -0,0 +1,93 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fattymango/px-take-home/dto"
+	"github.com/fattymango/px-take-home/internal/task"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/ctxstore"
+	"github.com/gofiber/fiber/v2"
+)
+
+// @Tags Task Approval
+// @Summary Approve task
+// @Router /api/v1/tasks/{taskID}/approve [post]
+// @Security BearerAuth
+// @Description Approve a task pending approval, the task is queued right away
+// @Accept json
+// @Produce json
+//
+// @Param taskID path int true "Task ID"
+// @Param review body dto.ReviewTask false "Review"
+//
+// @Success	200	{object} dto.ViewTask "Success"
+// @Failure	400	{object} dto.BaseResponse	"Bad Request"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+// @Failure	403	{object} dto.BaseResponse	"Forbidden"
+// @Failure	404	{object} dto.BaseResponse	"Not Found"
+// @Failure	500	{object} dto.BaseResponse	"Internal Server Error"
+//
+// @ID ApproveTask
+func (s *Server) ApproveTask(c *fiber.Ctx) error {
+	return s.reviewTask(c, model.ReviewDecision_Approved)
+}
+
+// @Tags Task Approval
+// @Summary Reject task
+// @Router /api/v1/tasks/{taskID}/reject [post]
+// @Security BearerAuth
+// @Description Reject a task pending approval
+// @Accept json
+// @Produce json
+//
+// @Param taskID path int true "Task ID"
+// @Param review body dto.ReviewTask false "Review"
+//
+// @Success	200	{object} dto.ViewTask "Success"
+// @Failure	400	{object} dto.BaseResponse	"Bad Request"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+// @Failure	403	{object} dto.BaseResponse	"Forbidden"
+// @Failure	404	{object} dto.BaseResponse	"Not Found"
+// @Failure	500	{object} dto.BaseResponse	"Internal Server Error"
+//
+// @ID RejectTask
+func (s *Server) RejectTask(c *fiber.Ctx) error {
+	return s.reviewTask(c, model.ReviewDecision_Rejected)
+}
+
+func (s *Server) reviewTask(c *fiber.Ctx, decision model.ReviewDecision) error {
+	taskID, err := ctxstore.GetTaskIDFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	review := &dto.ReviewTask{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(review); err != nil {
+			return dto.NewBadRequestResponse(c, err.Error())
+		}
+	}
+
+	t, err := s.TaskManager.GetTask(taskID)
+	if err != nil {
+		return dto.NewNotFoundResponse(c, fmt.Sprintf("task #%d not found", taskID))
+	}
+
+	if t.Status != model.TaskStatus_PendingApproval {
+		return dto.NewBadRequestResponse(c, fmt.Sprintf("task #%d is not pending approval", taskID))
+	}
+
+	reviewer := ctxstore.GetClientIDFromCtx(c, &s.config.Auth)
+	t, err = s.TaskManager.ReviewTask(taskID, decision, reviewer, review.Comment)
+	// Another approver reviewed it since it was read
+	if errors.Is(err, task.ErrNotPendingApproval) {
+		return dto.NewBadRequestResponse(c, fmt.Sprintf("task #%d is not pending approval", taskID))
+	}
+	if err != nil {
+		return dto.NewInternalServerErrorResponse(c, err.Error())
+	}
+
+	return dto.NewSuccessResponse(c, dto.ToViewTask(t))
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/fattymango/px-take-home/dto"
+	logdiff "github.com/fattymango/px-take-home/internal/log_diff"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/ctxstore"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// @Tags Task Logs
+// @Summary Diff task logs
+// @Router /api/v1/tasks/{taskID}/logs/diff/{otherTaskID} [get]
+// @Security BearerAuth
+// @Description Compare the log of a task (a, the old log) with the log of another task (b, the new log), e.g. two runs of the same command.
+// @Description format=unified returns a text diff like diff -u, format=json returns the hunks with the line numbers, stream and timestamp of every line.
+// @Description ignore_timestamps ignores the dates and times printed in the lines, ignore removes the matches of regexes before comparing lines.
+// @Description Only the hash of every line is kept to compare the logs, the hunks are streamed from the logs.
+// @Accept json
+// @Produce text/plain
+// @Produce json
+//
+// @Param taskID path int true "Task ID of the old log"
+// @Param otherTaskID path int true "Task ID of the new log"
+// @Param query query dto.TaskLogDiffQuery false "Query"
+//
+// @Success	200	{object} dto.ViewTaskLogDiff "Success"
+// @Failure	400	{object} dto.BaseResponse	"Bad Request"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+// @Failure	404	{object} dto.BaseResponse	"Not Found"
+// @Failure	500	{object} dto.BaseResponse	"Internal Server Error"
+// @Failure	504	{object} dto.BaseResponse	"Diff timed out"
+//
+// @Security BearerAuth
+// @ID DiffTaskLogs
+func (s *Server) DiffTaskLogs(c *fiber.Ctx) error {
+	taskID, err := ctxstore.GetTaskIDFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	otherTaskID, err := ctxstore.GetDiffTaskIDFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	a, err := s.TaskManager.GetTask(taskID)
+	if err != nil {
+		return dto.NewNotFoundResponse(c, fmt.Sprintf("task #%d not found", taskID))
+	}
+
+	b, err := s.TaskManager.GetTask(otherTaskID)
+	if err != nil {
+		return dto.NewNotFoundResponse(c, fmt.Sprintf("task #%d not found", otherTaskID))
+	}
+
+	query, err := ctxstore.GetTaskLogDiffQueryFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	opts, err := query.ToOptions()
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	// The status is updated before the executor writes the end of the log
+	for _, t := range []*model.Task{a, b} {
+		if !t.Status.Finished() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(c.UserContext(), LOG_WAIT_TIMEOUT)
+		err := s.TaskManager.WaitTaskLogs(ctx, t.ID)
+		cancel()
+		if err != nil {
+			s.logger.Errorf("failed to wait for the log of task #%d: %s", t.ID, err)
+		}
+	}
+
+	diff, err := s.TaskManager.DiffTaskLogs(c.UserContext(), a.ID, b.ID, opts)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return dto.NewGatewayTimeoutResponse(c, "diff timed out")
+	}
+	if err != nil {
+		return dto.NewInternalServerErrorResponse(c, err.Error())
+	}
+
+	var newWriter func(w *bufio.Writer) diffWriter
+	switch query.Format {
+	case dto.DiffFormatJSON:
+		c.Set("Content-Type", fiber.MIMEApplicationJSONCharsetUTF8)
+		newWriter = func(w *bufio.Writer) diffWriter { return &jsonDiffWriter{w: w} }
+	default:
+		c.Set("Content-Type", "text/plain; charset=utf-8")
+		newWriter = func(w *bufio.Writer) diffWriter { return &unifiedDiffWriter{w: w, a: a, b: b} }
+	}
+
+	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		dw := newWriter(w)
+		err := dw.Start(diff)
+		if err == nil {
+			err = diff.Write(dw)
+		}
+		if err == nil {
+			err = dw.End()
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			s.logger.Errorf("failed to write the diff of tasks #%d and #%d: %s", a.ID, b.ID, err)
+		}
+	}))
+
+	return nil
+}
+
+// diffWriter writes a diff in a response format, Start is called before the hunks and End after them
+type diffWriter interface {
+	logdiff.Writer
+	Start(diff *logdiff.Diff) error
+	End() error
+}
+
+// unifiedDiffWriter writes the diff like diff -u, nothing is written if the logs are the same
+type unifiedDiffWriter struct {
+	w    *bufio.Writer
+	a, b *model.Task
+}
+
+func (u *unifiedDiffWriter) Start(diff *logdiff.Diff) error {
+	if len(diff.Hunks) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(u.w, "--- task #%d %s\n+++ task #%d %s\n", u.a.ID, u.a.Name, u.b.ID, u.b.Name)
+	return err
+}
+
+func (u *unifiedDiffWriter) WriteHunk(hunk *logdiff.Hunk) error {
+	_, err := fmt.Fprintln(u.w, hunk.Header())
+	return err
+}
+
+func (u *unifiedDiffWriter) WriteLine(line *logdiff.Line) error {
+	text := line.A
+	if line.Op == logdiff.OpInsert {
+		text = line.B
+	}
+	_, err := fmt.Fprintf(u.w, "%s%s\n", line.Op, text.Text)
+	return err
+}
+
+func (u *unifiedDiffWriter) End() error {
+	return nil
+}
+
+// jsonDiffWriter streams a dto.ViewTaskLogDiff in the success response, hunk by hunk
+type jsonDiffWriter struct {
+	w     *bufio.Writer
+	hunks int
+	lines int // lines of the current hunk
+}
+
+func (j *jsonDiffWriter) Start(diff *logdiff.Diff) error {
+	stats, err := json.Marshal(dto.ToViewLogDiffStats(diff))
+	if err != nil {
+		return err
+	}
+	// The stats object is left open for the hunks
+	_, err = fmt.Fprintf(j.w, `{"success":true,"code":%d,"data":%s,"hunks":[`, fiber.StatusOK, stats[:len(stats)-1])
+	return err
+}
+
+func (j *jsonDiffWriter) WriteHunk(hunk *logdiff.Hunk) error {
+	if j.hunks > 0 {
+		j.w.WriteString("]},")
+	}
+	j.hunks++
+	j.lines = 0
+
+	view := dto.ToViewDiffHunk(hunk)
+	_, err := fmt.Fprintf(j.w, `{"a_start":%d,"a_lines":%d,"b_start":%d,"b_lines":%d,"lines":[`, view.AStart, view.ALines, view.BStart, view.BLines)
+	return err
+}
+
+func (j *jsonDiffWriter) WriteLine(line *logdiff.Line) error {
+	data, err := json.Marshal(dto.ToViewDiffLine(line))
+	if err != nil {
+		return err
+	}
+	if j.lines > 0 {
+		j.w.WriteByte(',')
+	}
+	j.lines++
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonDiffWriter) End() error {
+	if j.hunks > 0 {
+		j.w.WriteString("]}")
+	}
+	_, err := j.w.WriteString(`]},"error":"","message":""}`)
+	return err
+}
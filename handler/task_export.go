@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fattymango/px-take-home/dto"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportTaskLogs streams the lines of the log in the format of the query, after a header record of the task
+func (s *Server) exportTaskLogs(c *fiber.Ctx, task *model.Task, query *dto.TaskLogDownloadQuery, acceptGzip bool) error {
+	view := dto.ToViewLogExportTask(task)
+
+	var newWriter func(w io.Writer) logLineWriter
+	switch query.Format {
+	case dto.LogFormatNDJSON:
+		c.Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		newWriter = func(w io.Writer) logLineWriter { return newNDJSONLineWriter(w, view) }
+	case dto.LogFormatCSV:
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+		newWriter = func(w io.Writer) logLineWriter { return &csvLineWriter{w: csv.NewWriter(w), task: view} }
+	}
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="task-%d.%s"`, task.ID, query.Format))
+
+	return s.downloadTaskLogLines(c, task.ID, query, acceptGzip, newWriter)
+}
+
+// logLineWriter writes the lines of a log in a download format, Start is called before the lines and End after them
+type logLineWriter interface {
+	Start() error
+	WriteLine(line *logreader.Line) error
+	End() error
+}
+
+// textLineWriter writes the lines as they are in the log
+type textLineWriter struct {
+	w io.Writer
+}
+
+func (t *textLineWriter) Start() error {
+	return nil
+}
+
+func (t *textLineWriter) WriteLine(line *logreader.Line) error {
+	_, err := io.WriteString(t.w, line.Text+"\n")
+	return err
+}
+
+func (t *textLineWriter) End() error {
+	return nil
+}
+
+// ndjsonLineWriter writes a dto.ViewLogExportTask object, then a dto.ViewLogExportLine object per line
+type ndjsonLineWriter struct {
+	enc  *json.Encoder
+	task *dto.ViewLogExportTask
+}
+
+func newNDJSONLineWriter(w io.Writer, task *dto.ViewLogExportTask) *ndjsonLineWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &ndjsonLineWriter{enc: enc, task: task}
+}
+
+func (n *ndjsonLineWriter) Start() error {
+	return n.enc.Encode(n.task)
+}
+
+func (n *ndjsonLineWriter) WriteLine(line *logreader.Line) error {
+	return n.enc.Encode(dto.ToViewLogExportLine(line))
+}
+
+func (n *ndjsonLineWriter) End() error {
+	return nil
+}
+
+// csvLineWriter writes the task columns and record, then the line columns and a record per line
+type csvLineWriter struct {
+	w    *csv.Writer
+	task *dto.ViewLogExportTask
+}
+
+func (c *csvLineWriter) Start() error {
+	c.w.Write(dto.LogExportTaskColumns)
+	c.w.Write(c.task.Record())
+	return c.w.Write(dto.LogExportLineColumns)
+}
+
+func (c *csvLineWriter) WriteLine(line *logreader.Line) error {
+	return c.w.Write(dto.ToViewLogExportLine(line).Record())
+}
+
+func (c *csvLineWriter) End() error {
+	c.w.Flush()
+	return c.w.Error()
+}
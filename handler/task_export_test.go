@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/fattymango/px-take-home/dto"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testExportTask = &model.Task{ID: 2, Name: "=build", Command: "make", Status: model.TaskStatus_Completed}
+
+	testExportLines = []*logreader.Line{
+		{Number: 1, Stream: model.LogStream_Stdout, Time: 1760000000000000000, Text: "cc -o app main.c"},
+		{Number: 2, Stream: model.LogStream_Stderr, Text: `=HYPERLINK("http://x","y")`},
+		{Number: 3, Stream: model.LogStream_Stdout, Time: 1760000000000000001, Text: "-1 warnings, \"quoted\""},
+	}
+)
+
+func writeTestExport(t *testing.T, w logLineWriter) {
+	assert.NoError(t, w.Start())
+	for _, line := range testExportLines {
+		assert.NoError(t, w.WriteLine(line))
+	}
+	assert.NoError(t, w.End())
+}
+
+func TestNDJSONLineWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writeTestExport(t, newNDJSONLineWriter(&buf, dto.ToViewLogExportTask(testExportTask)))
+
+	// Lines are exported as they are, formulas only run in spreadsheets
+	assert.Equal(t, `{"task_id":2,"name":"=build","command":"make","status":"completed","exit_code":0}
+{"line_number":1,"stream":"stdout","timestamp":1760000000000000000,"line":"cc -o app main.c"}
+{"line_number":2,"stream":"stderr","line":"=HYPERLINK(\"http://x\",\"y\")"}
+{"line_number":3,"stream":"stdout","timestamp":1760000000000000001,"line":"-1 warnings, \"quoted\""}
+`, buf.String())
+}
+
+func TestCSVLineWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writeTestExport(t, &csvLineWriter{w: csv.NewWriter(&buf), task: dto.ToViewLogExportTask(testExportTask)})
+
+	// The task and line records have different columns
+	reader := csv.NewReader(&buf)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		dto.LogExportTaskColumns,
+		{"2", "'=build", "make", "completed", "0"},
+		dto.LogExportLineColumns,
+		{"1", "stdout", "1760000000000000000", "cc -o app main.c"},
+		{"2", "stderr", "", `'=HYPERLINK("http://x","y")`},
+		{"3", "stdout", "1760000000000000001", "'-1 warnings, \"quoted\""},
+	}, records)
+}
@@ -0,0 +1,367 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fattymango/px-take-home/dto"
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/internal/sse"
+	"github.com/fattymango/px-take-home/internal/task"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/ctxstore"
+	"github.com/fattymango/px-take-home/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	FOLLOW_PING_INTERVAL = 15 * time.Second       // keeps idle streams open and detects closed connections
+	FOLLOW_GAP_POLL      = 100 * time.Millisecond // task logger flush interval
+	FOLLOW_GAP_TIMEOUT   = 2 * time.Second        // max wait for live lines to reach the log store
+)
+
+// @Tags Task Logs
+// @Summary Follow task logs
+// @Router /api/v1/tasks/{taskID}/logs/follow [get]
+// @Security BearerAuth
+// @Description Stream the log of a task as server sent events, like tail -f, e.g. curl -N.
+// @Description The lines already written are replayed from the log, from the from line or the last tail lines, then new lines are sent as they come.
+// @Description Every line is sent once and in order as a log event, its id is the line number so reconnecting with Last-Event-ID resumes after it.
+// @Description Lines are numbered as in the output: in a log truncated to its max size the lines after the marker keep their output number and the marker takes the number of the last dropped line.
+// @Description Lines of a truncated output that can't be sent while the task runs are replaced by a skip event with their range, its id is the last skipped line.
+// @Description render=plain strips the ANSI escape sequences of the lines, render=html turns their styles into spans.
+// @Description Status changes are sent as status events, the stream ends with an end event carrying the task once it reaches a terminal status.
+// @Accept json
+// @Produce text/event-stream
+//
+// @Param taskID path int true "Task ID"
+// @Param query query dto.TaskLogFollowQuery true "Query"
+//
+// @Success	200	{string} string "Event stream"
+// @Failure	400	{object} dto.BaseResponse	"Bad Request"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+// @Failure	404	{object} dto.BaseResponse	"Not Found"
+//
+// @Security BearerAuth
+// @ID FollowTaskLogs
+func (s *Server) FollowTaskLogs(c *fiber.Ctx) error {
+	taskID, err := ctxstore.GetTaskIDFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	_, err = s.TaskManager.GetTask(taskID)
+	if err != nil {
+		return dto.NewNotFoundResponse(c, fmt.Sprintf("task #%d not found", taskID))
+	}
+
+	query, err := ctxstore.GetTaskLogFollowQueryFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	if err := query.Validate(); err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	// EventSource reconnects with the id of the last event it received
+	if lastID := c.Get("Last-Event-ID"); lastID != "" {
+		line, err := strconv.Atoi(lastID)
+		if err != nil || line < 0 {
+			return dto.NewBadRequestResponse(c, "invalid Last-Event-ID")
+		}
+		query.From, query.Tail = line+1, 0
+	}
+
+	// Follow before reading the log, lines written meanwhile are received live
+	follower := s.sseManager.Follow(taskID)
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("Transfer-Encoding", "chunked")
+
+	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer s.sseManager.Unfollow(follower)
+
+		f := &logFollow{manager: s.TaskManager, logger: s.logger, w: w, taskID: taskID, follower: follower, render: query.Render}
+		if err := f.run(query); err != nil {
+			s.logger.Infof("follow of task #%d closed: %s", taskID, err)
+		}
+	}))
+
+	return nil
+}
+
+// logFollow streams the log of a task, lines come from the log store until the end of the log,
+// then from the follower. next is the number of the next line to send, lines before it are skipped
+// and missing lines are read from the log store, so every line is sent once whatever the source.
+type logFollow struct {
+	manager *task.TaskManager
+	logger  *logger.Logger
+	w       *bufio.Writer
+
+	taskID   uint64
+	follower *sse.Follower
+	render   string
+	next     int // in output numbering
+
+	// maps the lines of the log store to the output, see readLineMap
+	lines    logreader.LineMap
+	complete bool
+}
+
+func (f *logFollow) run(query *dto.TaskLogFollowQuery) error {
+	f.next = query.From
+	if query.Tail > 0 {
+		if err := f.readLineMap(); err != nil {
+			return err
+		}
+		lines, total, err := f.manager.TailTaskLogs(f.taskID, query.Tail)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := f.writeLines(lines); err != nil {
+			return err
+		}
+		f.next = max(f.next, f.lines.Output(f.readable(total))+1)
+	}
+
+	if err := f.replay(); err != nil {
+		return err
+	}
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+
+	// The task may have finished before the follower was registered
+	if done, err := f.finishIfDone(); done || err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(FOLLOW_PING_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.follower.Done():
+			return nil
+
+		case msg := <-f.follower.Logs:
+			if err := f.live(msg); err != nil {
+				return err
+			}
+
+		case msg := <-f.follower.Status:
+			t, err := f.manager.GetTask(f.taskID)
+			if err != nil {
+				return err
+			}
+			// The status is saved before it's published, the event is used if saving it failed
+			if msg.Status.Finished() && !t.Status.Finished() {
+				t.Status, t.Reason, t.ExitCode = msg.Status, msg.Reason, msg.ExitCode
+			}
+			if t.Status.Finished() {
+				return f.finish(t)
+			}
+			if err := f.writeEvent("status", "", dto.ToViewTask(t)); err != nil {
+				return err
+			}
+			if err := f.w.Flush(); err != nil {
+				return err
+			}
+
+		case <-f.follower.Missed:
+			if done, err := f.finishIfDone(); done || err != nil {
+				return err
+			}
+
+		case <-ticker.C:
+			if _, err := f.w.WriteString(": ping\n\n"); err != nil {
+				return err
+			}
+			if err := f.w.Flush(); err != nil {
+				return err
+			}
+			// A status update is missed if the follower fell behind
+			if done, err := f.finishIfDone(); done || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// live sends a line received from the follower, the lines missing before it are read from the log store first
+func (f *logFollow) live(msg *eventbus.LogMsg) error {
+	if msg.LineNumber > f.next {
+		if err := f.fill(msg.LineNumber); err != nil {
+			return err
+		}
+	}
+
+	if msg.LineNumber == f.next {
+		line := &dto.ViewLogLine{LineNumber: msg.LineNumber, Stream: msg.Stream, Timestamp: msg.Timestamp, Line: msg.Line}
+		line.Render(f.render)
+		if err := f.writeEvent("log", strconv.Itoa(msg.LineNumber), line); err != nil {
+			return err
+		}
+		f.next++
+	}
+
+	// Lines received in bursts are flushed together
+	if len(f.follower.Logs) > 0 {
+		return nil
+	}
+	return f.w.Flush()
+}
+
+// fill reads the lines before until from the log store. They were written before the follower was registered,
+// or dropped because the client is slow, and reach the log store once the task logger flushes them.
+// Lines in the tail of a truncated output only reach it once the task finished, they are skipped right away,
+// lines that never reach it are skipped after FOLLOW_GAP_TIMEOUT.
+func (f *logFollow) fill(until int) error {
+	deadline := time.Now().Add(FOLLOW_GAP_TIMEOUT)
+	for {
+		if err := f.replay(); err != nil {
+			return err
+		}
+		if f.next >= until {
+			return nil
+		}
+		if f.readable(f.lines.Log(f.next)) < f.lines.Log(f.next) {
+			return f.skip(until)
+		}
+		if time.Now().After(deadline) {
+			f.logger.Errorf("lines %d to %d of task #%d are not in the log, skipping them", f.next, until-1, f.taskID)
+			return f.skip(until)
+		}
+		time.Sleep(FOLLOW_GAP_POLL)
+	}
+}
+
+// skip sends a skip event for the lines before until, so a client reconnecting with its id resumes after them
+func (f *logFollow) skip(until int) error {
+	if err := f.writeEvent("skip", strconv.Itoa(until-1), &dto.ViewLogSkip{From: f.next, To: until - 1}); err != nil {
+		return err
+	}
+	f.next = until
+	return nil
+}
+
+// readLineMap reads the line map of the log, the lines of the log store are sent with their number in the output
+func (f *logFollow) readLineMap() error {
+	lines, complete, err := f.manager.GetTaskLogLineMap(f.taskID)
+	if err != nil {
+		return err
+	}
+	f.lines, f.complete = lines, complete
+	return nil
+}
+
+// readable returns the last line of the log store up to line that can be sent. While a truncated output is
+// executing, the lines after its head are numbered once the map is complete, when the task finished.
+func (f *logFollow) readable(line int) int {
+	if !f.complete && f.lines.Head > 0 {
+		return min(line, f.lines.Head)
+	}
+	return line
+}
+
+// replay sends the lines of the log store from the next line to the end of the log
+func (f *logFollow) replay() error {
+	if err := f.readLineMap(); err != nil {
+		return err
+	}
+
+	for {
+		from := f.lines.Log(f.next)
+		to := f.readable(from + LOG_BATCH_SIZE - 1)
+		if from > to {
+			return nil
+		}
+
+		lines, _, err := f.manager.GetTaskLogs(f.taskID, &logreader.Filter{From: from, To: to})
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := f.writeLines(lines); err != nil {
+			return err
+		}
+		if len(lines) < LOG_BATCH_SIZE {
+			return nil
+		}
+	}
+}
+
+func (f *logFollow) finishIfDone() (bool, error) {
+	t, err := f.manager.GetTask(f.taskID)
+	if err != nil {
+		return true, err
+	}
+	if !t.Status.Finished() {
+		return false, nil
+	}
+	return true, f.finish(t)
+}
+
+// finish sends the end of the log once the executor wrote it, then the end event with the task
+func (f *logFollow) finish(t *model.Task) error {
+	ctx, cancel := context.WithTimeout(context.Background(), LOG_WAIT_TIMEOUT)
+	defer cancel()
+	if err := f.manager.WaitTaskLogs(ctx, f.taskID); err != nil {
+		f.logger.Errorf("failed to wait for the log of task #%d: %s", f.taskID, err)
+	}
+
+	if err := f.replay(); err != nil {
+		return err
+	}
+	if err := f.writeEvent("end", "", dto.ToViewTask(t)); err != nil {
+		return err
+	}
+	return f.w.Flush()
+}
+
+// writeLines sends the lines of the log store from the next line, numbered as in the output
+func (f *logFollow) writeLines(lines []*logreader.Line) error {
+	for _, line := range lines {
+		if line.Number > f.readable(line.Number) {
+			break
+		}
+		number := f.lines.Output(line.Number)
+		if number < f.next {
+			continue
+		}
+		view := dto.ToViewLogLine(line)
+		view.LineNumber = number
+		view.Render(f.render)
+		if err := f.writeEvent("log", strconv.Itoa(number), view); err != nil {
+			return err
+		}
+		f.next = number + 1
+	}
+	return nil
+}
+
+func (f *logFollow) writeEvent(event, id string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		fmt.Fprintf(f.w, "id: %s\n", id)
+	}
+	_, err = fmt.Fprintf(f.w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
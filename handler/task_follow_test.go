@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/dto"
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	logstore "github.com/fattymango/px-take-home/internal/log_store"
+	"github.com/fattymango/px-take-home/internal/sse"
+	"github.com/fattymango/px-take-home/internal/task"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/db"
+	"github.com/fattymango/px-take-home/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type followEvent struct {
+	event string
+	id    int
+	line  string
+}
+
+// parseFollowEvents returns the log and skip events of a follow stream and checks it ends with an end event
+func parseFollowEvents(t *testing.T, stream string) []followEvent {
+	var events []followEvent
+	var ended bool
+	for _, block := range strings.Split(strings.TrimSpace(stream), "\n\n") {
+		var event followEvent
+		var data string
+		for _, field := range strings.Split(block, "\n") {
+			name, value, _ := strings.Cut(field, ": ")
+			switch name {
+			case "id":
+				event.id, _ = strconv.Atoi(value)
+			case "event":
+				event.event = value
+			case "data":
+				data = value
+			}
+		}
+		switch event.event {
+		case "log":
+			var view dto.ViewLogLine
+			assert.NoError(t, json.Unmarshal([]byte(data), &view))
+			assert.Equal(t, event.id, view.LineNumber)
+			event.line = view.Line
+		case "end":
+			ended = true
+			continue
+		case "skip":
+		default:
+			continue
+		}
+		events = append(events, event)
+	}
+	assert.True(t, ended, "the stream has no end event")
+	return events
+}
+
+func TestLogFollow_Truncated(t *testing.T) {
+	cfg := &config.Config{
+		CMD:        config.CMD{MaxLineLength: 1024, LongLines: "split"},
+		TaskLogger: config.TaskLogger{DirPath: t.TempDir(), MaxSize: 256},
+		Quota:      config.Quota{MaxRunningTasks: 1},
+		EventBus:   config.EventBus{BufferSize: 1024},
+		SSE:        config.SSE{QueueSize: 1024},
+		DB:         config.DB{File: filepath.Join(t.TempDir(), "px.db"), MaxOpenConns: 1},
+	}
+	database, err := db.NewSQLiteDB(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, database.AutoMigrate(&model.Task{}))
+
+	bus := eventbus.NewBus(cfg, logger.NewTestLogger())
+	store := task.NewTaskDBStore(cfg, logger.NewTestLogger(), database)
+	manager := task.NewTaskManager(cfg, logger.NewTestLogger(), store, logstore.NewFileStore(cfg, logger.NewTestLogger()), bus)
+	sseManager := sse.NewSseManager(cfg, logger.NewTestLogger(), bus)
+	sseManager.Start()
+	manager.Start()
+	defer manager.Stop()
+
+	created, err := manager.CreateTask(&model.Task{Name: "test", Command: "seq 1 100; sleep 0.3; seq 101 200", Status: model.TaskStatus_Queued})
+	assert.NoError(t, err)
+
+	follow := func(from int) []followEvent {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		follower := sseManager.Follow(created.ID)
+		defer sseManager.Unfollow(follower)
+
+		f := &logFollow{manager: manager, logger: logger.NewTestLogger(), w: w, taskID: created.ID, follower: follower}
+		assert.NoError(t, f.run(&dto.TaskLogFollowQuery{From: from}))
+		return parseFollowEvents(t, buf.String())
+	}
+
+	// Followed while it runs, the lines that reach the tail of the log are sent live or skipped
+	go func() { assert.NoError(t, manager.QueueTask(created)) }()
+	events := follow(1)
+	lines, complete, err := manager.GetTaskLogLineMap(created.ID)
+	assert.NoError(t, err)
+	assert.True(t, complete)
+	assert.NotZero(t, lines.Dropped)
+
+	last := 0
+	for _, event := range events {
+		assert.Greater(t, event.id, last)
+		last = event.id
+		if event.event == "log" && event.id != lines.Head+lines.Dropped {
+			assert.Equal(t, strconv.Itoa(event.id), event.line)
+		}
+	}
+	assert.Equal(t, 200, last)
+
+	tests := []struct {
+		name      string
+		from      int
+		wantFirst int
+	}{
+		{name: "from the head", from: 1, wantFirst: 1},
+		{name: "after the head", from: lines.Head + 1, wantFirst: lines.Head + lines.Dropped},
+		{name: "from a dropped line", from: lines.Head + 2, wantFirst: lines.Head + lines.Dropped},
+		{name: "from the tail", from: 190, wantFirst: 190},
+	}
+
+	// Reconnecting with the id of the last event resumes after it, in output numbering
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := follow(tt.from)
+			if !assert.NotEmpty(t, events) {
+				return
+			}
+			assert.Equal(t, tt.wantFirst, events[0].id)
+
+			want := tt.wantFirst
+			for _, event := range events {
+				assert.Equal(t, "log", event.event)
+				assert.Equal(t, want, event.id)
+				if event.id == lines.Head+lines.Dropped {
+					assert.Contains(t, event.line, "truncated")
+				} else {
+					assert.Equal(t, strconv.Itoa(event.id), event.line)
+				}
+				if want++; want > lines.Head {
+					want = max(want, lines.Head+lines.Dropped)
+				}
+			}
+			assert.Equal(t, 200, events[len(events)-1].id)
+		})
+	}
+}
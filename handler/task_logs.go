@@ -1,20 +1,42 @@
 package server
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/fattymango/px-take-home/dto"
 	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	logstore "github.com/fattymango/px-take-home/internal/log_store"
+	"github.com/fattymango/px-take-home/internal/task"
 	"github.com/fattymango/px-take-home/model"
 	"github.com/fattymango/px-take-home/pkg/ctxstore"
 	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	LOG_BATCH_SIZE   = 1000             // lines read from the log store at once
+	LOG_WAIT_TIMEOUT = 30 * time.Second // max wait for the executor to write the end of the log
 )
 
 // @Tags Task Logs
 // @Summary Get task logs by ID
 // @Router /api/v1/tasks/{taskID}/logs [get]
 // @Security BearerAuth
-// @Description Get task logs by ID
+// @Description Get task logs by ID, every line is tagged with its stream (1: stdout, 2: stderr).
+// @Description With stream=stdout|stderr only the lines of that stream within the requested range are returned.
+// @Description since/until (RFC3339) select the lines captured in that time range, every line carries its capture time in unix nano.
+// @Description A time range returns at most limit lines, the first ones or the last ones when only until is set, next continues it.
+// @Description render=plain strips the ANSI escape sequences, render=html escapes the lines and turns colors and styles into spans with ansi-* classes.
+// @Description Pages are read with the opaque next and prev cursors of the response, they stay valid while the log grows.
+// @Description Without a range the last limit lines are returned, from or to alone return the limit lines starting at from or ending at to.
 // @Accept json
 // @Produce json
 //
@@ -35,46 +57,226 @@ func (s *Server) GetTaskLogsByID(c *fiber.Ctx) error {
 		return dto.NewBadRequestResponse(c, fmt.Sprintf("failed to get task ID: %s", err))
 	}
 
+	filter, err := ctxstore.GetTaskLogFilterFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, fmt.Sprintf("failed to get task log filter: %s", err))
+	}
+
+	view, err := s.readTaskLogs(taskID, filter)
+	if err != nil {
+		return dto.NewErrorResponse(c, err)
+	}
+
+	return dto.NewSuccessResponse(c, view)
+}
+
+// readTaskLogs returns the lines of the log of a task selected by the filter, errors are *fiber.Error
+// with the status of the response
+func (s *Server) readTaskLogs(taskID uint64, filter *dto.TaskLogFilter) (*dto.ViewTaskLogs, error) {
+	_, err := s.TaskManager.GetTask(taskID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("task #%d not found", taskID))
+	}
+
+	if filter.From < 0 || filter.To < 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "from and to must be positive")
+	}
+
+	if filter.From != 0 && filter.To != 0 && filter.From >= filter.To {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "from must be less than to")
+	}
+
+	logFilter, err := filter.ToLogFilter()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if filter.IsPage() {
+		return s.readTaskLogPage(taskID, filter, logFilter)
+	}
+
+	// Time ranges are cut to a page, like a single bound of the line range
+	if logFilter.Since != 0 || logFilter.Until != 0 {
+		logFilter.Limit, err = filter.PageLimit()
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+
+	logs, totalLines, err := s.TaskManager.GetTaskLogs(taskID, logFilter)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	view := dto.ToViewTaskLogs(logs, totalLines)
+	// Cursors of a range are resolved from their line when they are used
+	if len(logs) > 0 {
+		first, last := logs[0].Number, logs[len(logs)-1].Number
+		view.Next = dto.EncodeCursor(taskID, &logreader.Cursor{Line: last + 1, Offset: -1})
+		if first > 1 {
+			view.Prev = dto.EncodeCursor(taskID, &logreader.Cursor{Line: first, Offset: -1, Backward: true})
+		}
+	}
+	for _, line := range view.Logs {
+		line.Render(filter.Render)
+	}
+
+	return view, nil
+}
+
+// readTaskLogPage returns the page of the cursor of the filter, or of a single bound of its line range
+func (s *Server) readTaskLogPage(taskID uint64, filter *dto.TaskLogFilter, logFilter *logreader.Filter) (*dto.ViewTaskLogs, error) {
+	cursor, err := filter.PageCursor(taskID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	limit, err := filter.PageLimit()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	page, err := s.TaskManager.GetTaskLogPage(taskID, cursor, limit, logFilter.Stream)
+	if errors.Is(err, logreader.ErrInvalidCursor) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	view := dto.ToViewTaskLogPage(taskID, page)
+	for _, line := range view.Logs {
+		line.Render(filter.Render)
+	}
+
+	return view, nil
+}
+
+// @Tags Task Logs
+// @Summary Search task logs
+// @Router /api/v1/tasks/{taskID}/logs/search [get]
+// @Security BearerAuth
+// @Description Search the log of a task for a plain text or a regex (RE2 syntax), like grep.
+// @Description Matches carry their line number, use it with the from/to range of the logs endpoint to jump to a match.
+// @Description highlights are the [start, end) character offsets of the matches in the line.
+// @Accept json
+// @Produce json
+//
+// @Param taskID path int true "Task ID"
+// @Param query query dto.TaskLogSearchQuery true "Query"
+//
+// @Success	200	{object} dto.ViewTaskLogSearch "Success"
+// @Failure	400	{object} dto.BaseResponse	"Bad Request"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+// @Failure	404	{object} dto.BaseResponse	"Not Found"
+// @Failure	500	{object} dto.BaseResponse	"Internal Server Error"
+// @Failure	504	{object} dto.BaseResponse	"Search timed out"
+//
+// @Security BearerAuth
+// @ID SearchTaskLogs
+func (s *Server) SearchTaskLogs(c *fiber.Ctx) error {
+	taskID, err := ctxstore.GetTaskIDFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
 	_, err = s.TaskManager.GetTask(taskID)
 	if err != nil {
 		return dto.NewNotFoundResponse(c, fmt.Sprintf("task #%d not found", taskID))
 	}
 
-	filter, err := ctxstore.GetTaskLogFilterFromCtx(c)
+	searchQuery, err := ctxstore.GetTaskLogSearchQueryFromCtx(c)
 	if err != nil {
-		return dto.NewBadRequestResponse(c, fmt.Sprintf("failed to get task log filter: %s", err))
+		return dto.NewBadRequestResponse(c, err.Error())
 	}
 
-	if (filter.From > 0 && filter.To == 0) ||
-		(filter.From == 0 && filter.To > 0) {
-		return dto.NewBadRequestResponse(c, "to and from must be provided together")
+	query, err := searchQuery.ToSearchQuery()
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
 	}
 
-	if filter.From != 0 && filter.To != 0 && filter.From >= filter.To {
-		return dto.NewBadRequestResponse(c, "from must be less than to")
+	result, err := s.TaskManager.SearchTaskLogs(c.UserContext(), taskID, query)
+	if errors.Is(err, os.ErrNotExist) {
+		return dto.NewNotFoundResponse(c, "log file not found")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return dto.NewGatewayTimeoutResponse(c, "search timed out, narrow the query")
+	}
+	if err != nil {
+		return dto.NewInternalServerErrorResponse(c, err.Error())
 	}
 
-	logs, totalLines, err := s.TaskManager.GetTaskLogs(taskID, filter.From, filter.To)
+	return dto.NewSuccessResponse(c, dto.ToViewTaskLogSearch(result, query))
+}
+
+// @Tags Task Logs
+// @Summary Search the logs of many tasks
+// @Router /api/v1/logs/search [get]
+// @Security BearerAuth
+// @Description Search the logs of the most recent tasks selected by status, name and creation time for a plain text or a regex (RE2 syntax).
+// @Description Returns the tasks with at least a match, with their first matching lines. Logs are searched a few at a time,
+// @Description a search running longer than the configured timeout returns the tasks searched so far with complete set to false.
+// @Accept json
+// @Produce json
+//
+// @Param query query dto.LogSearchQuery true "Query"
+//
+// @Success	200	{object} dto.ViewLogSearch "Success"
+// @Failure	400	{object} dto.BaseResponse	"Bad Request"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+// @Failure	500	{object} dto.BaseResponse	"Internal Server Error"
+//
+// @Security BearerAuth
+// @ID SearchAllTaskLogs
+func (s *Server) SearchAllTaskLogs(c *fiber.Ctx) error {
+	searchQuery, err := ctxstore.GetLogSearchQueryFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	createdAfter, createdBefore, limit, err := searchQuery.TaskFilters()
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+	filter := &task.TaskFilter{Status: model.TaskStatus(searchQuery.Status), Name: searchQuery.Name, CreatedAfter: createdAfter, CreatedBefore: createdBefore}
+
+	query, err := searchQuery.ToSearchQuery()
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	tasks, total, result, err := s.TaskManager.SearchAllTaskLogs(c.UserContext(), filter, limit, query)
 	if err != nil {
 		return dto.NewInternalServerErrorResponse(c, err.Error())
 	}
 
-	return dto.NewSuccessResponse(c, dto.ToViewTaskLogs(logs, totalLines))
+	return dto.NewSuccessResponse(c, dto.ToViewLogSearch(tasks, total, result))
 }
 
 // @Tags Task Logs
 // @Summary Download task logs
 // @Router /api/v1/tasks/{taskID}/logs/download [get]
 // @Security BearerAuth
-// @Description Download all logs for a task
+// @Description Download the log of a task, the log of a running task is downloaded up to its last complete line.
+// @Description Clients that accept gzip get it compressed, gzip logs are sent as is, anything else is compressed on the fly unless a range is requested.
+// @Description Byte ranges (Range, If-Range) are supported to resume downloads, from/to download a range of lines instead of the whole log.
+// @Description Finished logs carry an ETag and a Last-Modified date, If-None-Match and If-Modified-Since return 304 when they match.
+// @Description format=ndjson exports a JSON object per line and format=csv a CSV record per line, with the line number, stream and timestamp,
+// @Description both start with a header record of the task (id, name, command, status, exit code) and are streamed.
+// @Description CSV text cells starting with =, +, -, @, a tab or a carriage return are prefixed with a quote so spreadsheets don't run them as formulas.
 // @Accept json
 // @Produce text/plain
+// @Produce application/x-ndjson
+// @Produce text/csv
 // @Param taskID path int true "Task ID"
+// @Param query query dto.TaskLogDownloadQuery false "Line range and format"
 //
 //	@Success	200	{file} file "Log file"
+//	@Success	206	{file} file "Byte range of the log file"
+//	@Success	304	"Not Modified"
 //	@Failure	400	{object} dto.BaseResponse	"Bad Request"
 //	@Failure	401	{object} dto.BaseResponse	"Unauthorized"
 //	@Failure	404	{object} dto.BaseResponse	"Not Found"
+//	@Failure	416	"Range Not Satisfiable"
 //	@Failure	500	{object} dto.BaseResponse	"Internal Server Error"
 //
 // @Security BearerAuth
@@ -90,20 +292,218 @@ func (s *Server) DownloadTaskLogs(c *fiber.Ctx) error {
 		return dto.NewNotFoundResponse(c, fmt.Sprintf("task #%d not found", taskID))
 	}
 
-	// Only allow downloading logs for completed, failed, or canceled tasks
-	if task.Status == model.TaskStatus_Running || task.Status == model.TaskStatus_Queued {
-		return dto.NewBadRequestResponse(c, "cannot download logs for running or queued tasks")
+	// Tasks that never started have no logs
+	if task.Status == model.TaskStatus_Queued || task.Status == model.TaskStatus_PendingApproval {
+		return dto.NewBadRequestResponse(c, "cannot download logs for queued tasks")
+	}
+
+	query, err := ctxstore.GetTaskLogDownloadQueryFromCtx(c)
+	if err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+	if err := query.Validate(); err != nil {
+		return dto.NewBadRequestResponse(c, err.Error())
+	}
+
+	finished := task.Status.Finished()
+	if finished {
+		// The status is updated before the executor writes the end of the log
+		ctx, cancel := context.WithTimeout(c.UserContext(), LOG_WAIT_TIMEOUT)
+		err := s.TaskManager.WaitTaskLogs(ctx, taskID)
+		cancel()
+		if err != nil {
+			s.logger.Errorf("failed to wait for the log of task #%d: %s", taskID, err)
+		}
 	}
 
-	logFilePath := logreader.FormatFileName(s.config.TaskLogger.DirPath, taskID)
+	acceptGzip := acceptsGzip(c)
+	c.Set(fiber.HeaderVary, fiber.HeaderAcceptEncoding)
 
-	if !logreader.CheckFileExists(logFilePath) {
-		return dto.NewNotFoundResponse(c, "log file not found")
+	if query.Export() {
+		return s.exportTaskLogs(c, task, query, acceptGzip)
 	}
 
-	c.Set("Content-Type", "text/plain")
+	c.Set("Content-Type", "text/plain; charset=utf-8")
 	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="task-%d.log"`, taskID))
 
-	// Send the file
-	return c.SendFile(logFilePath)
+	if query.Lines() {
+		return s.downloadTaskLogLines(c, taskID, query, acceptGzip, func(w io.Writer) logLineWriter { return &textLineWriter{w: w} })
+	}
+
+	download, err := s.TaskManager.OpenTaskLogs(taskID, acceptGzip, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return dto.NewNotFoundResponse(c, "log file not found")
+	}
+	if err != nil {
+		return dto.NewInternalServerErrorResponse(c, err.Error())
+	}
+
+	byteRange := c.Get(fiber.HeaderRange)
+	compress := acceptGzip && download.Encoding == "" && byteRange == ""
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+
+	// Finished logs never change, the ETag depends on the encoding as the content does
+	if finished {
+		etag := fmt.Sprintf(`"%d-%d-identity"`, taskID, task.EndTime)
+		if download.Encoding != "" {
+			etag = fmt.Sprintf(`"%d-%d-%s"`, taskID, task.EndTime, download.Encoding)
+		}
+		if compress {
+			etag = fmt.Sprintf(`W/"%d-%d-gzip"`, taskID, task.EndTime) // compressed on the fly, not byte for byte identical
+		}
+		c.Set(fiber.HeaderETag, etag)
+		c.Set(fiber.HeaderLastModified, time.Unix(int64(task.EndTime), 0).UTC().Format(http.TimeFormat))
+
+		if c.Fresh() {
+			download.Close()
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+
+		// The range applies to the version of the client only
+		if ifRange := c.Get(fiber.HeaderIfRange); ifRange != "" && ifRange != etag && ifRange != c.GetRespHeader(fiber.HeaderLastModified) {
+			byteRange = ""
+		}
+	} else {
+		// A log being written can't be resumed safely with If-Range
+		if c.Get(fiber.HeaderIfRange) != "" {
+			byteRange = ""
+		}
+	}
+
+	if download.Encoding != "" {
+		c.Set(fiber.HeaderContentEncoding, download.Encoding)
+	}
+
+	if byteRange != "" {
+		return s.downloadTaskLogRange(c, taskID, download, byteRange, acceptGzip)
+	}
+
+	if compress {
+		c.Set(fiber.HeaderContentEncoding, logreader.CompressionGzip)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			defer download.Close()
+			if err := gzipTo(w, download); err != nil {
+				s.logger.Errorf("failed to send the log of task #%d: %s", taskID, err)
+			}
+		})
+		return nil
+	}
+
+	if download.Size >= 0 {
+		return c.SendStream(download, int(download.Size))
+	}
+	return c.SendStream(download)
+}
+
+// downloadTaskLogRange sends a single byte range of the log. The size of decompressed logs comes from their last frame,
+// logs compressed before frames were written are read once to get it.
+func (s *Server) downloadTaskLogRange(c *fiber.Ctx, taskID uint64, download *logstore.Download, byteRange string, acceptGzip bool) error {
+	size := download.Size
+	if size < 0 {
+		n, err := io.Copy(io.Discard, download)
+		download.Close()
+		if err != nil {
+			c.Response().Header.Del(fiber.HeaderContentEncoding)
+			return dto.NewInternalServerErrorResponse(c, err.Error())
+		}
+		size = n
+	} else {
+		download.Close()
+	}
+
+	start, end, err := fasthttp.ParseByteRange([]byte(byteRange), int(size))
+	if err != nil {
+		// The response has no body in the encoding of the log
+		c.Response().Header.Del(fiber.HeaderContentEncoding)
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+		return c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
+	}
+
+	download, err = s.TaskManager.OpenTaskLogs(taskID, acceptGzip, int64(start))
+	if err != nil {
+		c.Response().Header.Del(fiber.HeaderContentEncoding)
+		return dto.NewInternalServerErrorResponse(c, err.Error())
+	}
+
+	length := end - start + 1
+	c.Status(fiber.StatusPartialContent)
+	c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	return c.SendStream(&struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(download, int64(length)), download}, length)
+}
+
+// downloadTaskLogLines streams a range of lines in the format of the writer, read LOG_BATCH_SIZE lines at a time
+func (s *Server) downloadTaskLogLines(c *fiber.Ctx, taskID uint64, query *dto.TaskLogDownloadQuery, acceptGzip bool, newWriter func(w io.Writer) logLineWriter) error {
+	from, to := max(query.From, 1), query.To
+	batch := func(from int) ([]*logreader.Line, error) {
+		last := from + LOG_BATCH_SIZE - 1
+		if to != 0 {
+			last = min(last, to)
+		}
+		lines, _, err := s.TaskManager.GetTaskLogs(taskID, &logreader.Filter{From: from, To: last})
+		return lines, err
+	}
+
+	// The first batch is read before the response starts, so a missing log is reported as such
+	lines, err := batch(from)
+	if errors.Is(err, os.ErrNotExist) {
+		return dto.NewNotFoundResponse(c, "log file not found")
+	}
+	if err != nil {
+		return dto.NewInternalServerErrorResponse(c, err.Error())
+	}
+
+	if acceptGzip {
+		c.Set(fiber.HeaderContentEncoding, logreader.CompressionGzip)
+	}
+
+	c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+		var w io.Writer = bw
+		if acceptGzip {
+			gz := gzip.NewWriter(bw)
+			defer gz.Close()
+			w = gz
+		}
+
+		lw := newWriter(w)
+		if err := lw.Start(); err != nil {
+			return
+		}
+		for {
+			for _, line := range lines {
+				if err := lw.WriteLine(line); err != nil {
+					return
+				}
+			}
+			if len(lines) < LOG_BATCH_SIZE || (to != 0 && lines[len(lines)-1].Number >= to) {
+				break
+			}
+
+			lines, err = batch(lines[len(lines)-1].Number + 1)
+			if err != nil {
+				s.logger.Errorf("failed to send the lines of task #%d: %s", taskID, err)
+				return
+			}
+		}
+		if err := lw.End(); err != nil {
+			s.logger.Errorf("failed to send the lines of task #%d: %s", taskID, err)
+		}
+	})
+	return nil
+}
+
+// acceptsGzip reports whether the client accepts gzip, clients that don't send Accept-Encoding get plain text
+func acceptsGzip(c *fiber.Ctx) bool {
+	return c.Get(fiber.HeaderAcceptEncoding) != "" && c.AcceptsEncodings(logreader.CompressionGzip) == logreader.CompressionGzip
+}
+
+func gzipTo(w io.Writer, r io.Reader) error {
+	gz := gzip.NewWriter(w)
+	if _, err := io.Copy(gz, r); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
 }
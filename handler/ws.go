@@ -0,0 +1,285 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fattymango/px-take-home/dto"
+	"github.com/fattymango/px-take-home/internal/shell"
+	"github.com/fattymango/px-take-home/internal/sse"
+	"github.com/fattymango/px-take-home/internal/task"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	WS_PONG_TIMEOUT     = 10 * time.Second // the connection is closed when nothing is received for this long, pings are sent every second
+	WS_WRITE_TIMEOUT    = 10 * time.Second
+	WS_MAX_MESSAGE_SIZE = 1 << 20 // max size of a command in bytes
+)
+
+// wsWriter writes the events and the responses of a WebSocket connection, one message at a time
+type wsWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (w *wsWriter) writeJSON(v interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.conn.SetWriteDeadline(time.Now().Add(WS_WRITE_TIMEOUT))
+	return w.conn.WriteJSON(v)
+}
+
+func (w *wsWriter) Event(id string, data []byte) error {
+	return w.writeJSON(dto.ToWSEvent(id, data))
+}
+
+func (w *wsWriter) Connect(id string) error {
+	return w.writeJSON(dto.ToWSConnect(id))
+}
+
+func (w *wsWriter) Resync(dropped uint64) error {
+	return w.writeJSON(dto.ToWSResync(dropped))
+}
+
+func (w *wsWriter) Ping() error {
+	return w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WS_WRITE_TIMEOUT))
+}
+
+// Flush is a no-op, every message is sent as it is written
+func (w *wsWriter) Flush() error {
+	return nil
+}
+
+func (w *wsWriter) close(code int, reason string) {
+	w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(WS_WRITE_TIMEOUT))
+	w.conn.Close()
+}
+
+// wsSession is a WebSocket connection, its commands are handled one at a time in the order they are received
+type wsSession struct {
+	server *Server
+	writer *wsWriter
+	client *sse.Client
+	filter *sse.Filter // subscription of the client, nil until it subscribes
+}
+
+// WebSocketUpgrade rejects the requests of the WebSocket endpoint that are not WebSocket upgrades
+func (s *Server) WebSocketUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return dto.NewUpgradeRequiredResponse(c, "websocket upgrade required")
+	}
+	return c.Next()
+}
+
+// @Tags Events
+// @Summary Task events and commands over WebSocket
+// @Router /api/v1/ws [get]
+// @Security BearerAuth
+// @Description Upgrade to a WebSocket carrying the events of the SSE stream and the commands of the clients, as JSON text messages.
+// @Description The connection starts with a connect message and receives no event until it subscribes.
+// @Description Commands are dto.WSCommand with an id and a type: subscribe, unsubscribe, cancel, stdin, logs and ping.
+// @Description Every command gets a response message with its id as request_id, its code and data are those of the matching HTTP endpoint.
+// @Description Events are {"type": "event", "id", "data"} with the data of the SSE events, a resync message tells a slow client it missed events.
+// @Description The server pings the client every second and closes the connection when nothing is received for 10 seconds.
+// @Produce json
+//
+// @Success	101	{object} dto.WSResponse "Switching Protocols"
+// @Failure	401	{object} dto.BaseResponse	"Unauthorized"
+// @Failure	426	{object} dto.BaseResponse	"Upgrade Required"
+//
+// @Security BearerAuth
+// @ID WebSocket
+func (s *Server) WebSocket(conn *websocket.Conn) {
+	writer := &wsWriter{conn: conn}
+	client := s.sseManager.AddUnsubscribedClient(writer)
+	s.logger.Infof("WebSocket connection client created: %s", client.ID)
+
+	// Wait writes the events of the client, the connection is closed when it stops writing,
+	// e.g. the client is disconnected as a slow client
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Wait()
+		writer.close(websocket.CloseGoingAway, "")
+	}()
+
+	session := &wsSession{server: s, writer: writer, client: client}
+	session.read(conn)
+
+	client.Cancel()
+	<-done
+	s.logger.Infof("WebSocket connection closed: %s", client.ID)
+	s.sseManager.RemoveClient(client.ID)
+}
+
+// read handles the commands of the client until the connection is closed
+func (w *wsSession) read(conn *websocket.Conn) {
+	conn.SetReadLimit(WS_MAX_MESSAGE_SIZE)
+	conn.SetReadDeadline(time.Now().Add(WS_PONG_TIMEOUT))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(WS_PONG_TIMEOUT))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				w.server.logger.Debugf("WebSocket client %s read error: %s", w.client.ID, err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(WS_PONG_TIMEOUT))
+
+		if err := w.writer.writeJSON(w.handle(data)); err != nil {
+			return
+		}
+	}
+}
+
+func (w *wsSession) handle(data []byte) *dto.WSResponse {
+	var cmd dto.WSCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return dto.NewWSErrorResponse("", fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid command: %s", err)))
+	}
+	if err := cmd.Validate(); err != nil {
+		return dto.NewWSErrorResponse(cmd.ID, fiber.NewError(fiber.StatusBadRequest, err.Error()))
+	}
+
+	var result interface{}
+	var err error
+	switch cmd.Type {
+	case dto.WSCommandSubscribe, dto.WSCommandUnsubscribe:
+		result, err = w.subscribe(&cmd)
+	case dto.WSCommandCancel:
+		err = w.cancel(&cmd)
+	case dto.WSCommandStdin:
+		err = w.stdin(&cmd)
+	case dto.WSCommandLogs:
+		result, err = w.server.readTaskLogs(cmd.TaskID, &cmd.TaskLogFilter)
+	}
+	if err != nil {
+		return dto.NewWSErrorResponse(cmd.ID, err)
+	}
+	return dto.NewWSSuccessResponse(cmd.ID, result)
+}
+
+// subscribe applies the command to the subscription of the client, the events sent after the response match it
+func (w *wsSession) subscribe(cmd *dto.WSCommand) (*dto.ViewWSSubscription, error) {
+	filter, err := applySubscription(cmd, w.filter)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	w.filter = filter
+	if filter == nil {
+		w.server.sseManager.Unsubscribe(w.client)
+	} else {
+		w.server.sseManager.Subscribe(w.client, filter)
+	}
+	return toViewWSSubscription(filter), nil
+}
+
+// applySubscription returns the filter of the subscription once the command is applied to the current one,
+// nil when the client is not subscribed
+func applySubscription(cmd *dto.WSCommand, current *sse.Filter) (*sse.Filter, error) {
+	for _, id := range cmd.TaskIDs {
+		if id == 0 {
+			return nil, fmt.Errorf("invalid task_id 0")
+		}
+	}
+	// types and status are validated like the query of the SSE stream
+	changes, err := eventsFilter(&dto.EventsQuery{Types: cmd.Types, Status: cmd.Status})
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.Type == dto.WSCommandUnsubscribe {
+		if current == nil || len(cmd.TaskIDs) == 0 {
+			return nil, nil
+		}
+		filter, err := current.RemoveTasks(cmd.TaskIDs)
+		if err != nil {
+			return nil, err
+		}
+		if len(filter.TaskIDs) == 0 {
+			return nil, nil
+		}
+		return filter, nil
+	}
+
+	var filter *sse.Filter
+	if current == nil {
+		filter = &sse.Filter{TaskIDs: cmd.TaskIDs}
+	} else {
+		filter = current.AddTasks(cmd.TaskIDs)
+	}
+	if len(filter.TaskIDs) > dto.MaxEventsTaskIDs {
+		return nil, fmt.Errorf("at most %d task ids are allowed", dto.MaxEventsTaskIDs)
+	}
+	if len(cmd.Types) > 0 {
+		filter.Types = changes.Types
+	}
+	if len(cmd.Status) > 0 {
+		filter.Statuses = changes.Statuses
+	}
+	return filter, nil
+}
+
+func toViewWSSubscription(filter *sse.Filter) *dto.ViewWSSubscription {
+	view := &dto.ViewWSSubscription{Subscribed: filter != nil, TaskIDs: []uint64{}, Types: []string{}, Status: []string{}}
+	if filter == nil {
+		return view
+	}
+	view.TaskIDs = append(view.TaskIDs, filter.TaskIDs...)
+	for _, event := range filter.Types {
+		view.Types = append(view.Types, sse.EventType_name[event])
+	}
+	for _, status := range filter.Statuses {
+		view.Status = append(view.Status, model.TaskStatus_name[status])
+	}
+	return view
+}
+
+func (w *wsSession) cancel(cmd *dto.WSCommand) error {
+	if _, err := w.server.TaskManager.GetTask(cmd.TaskID); err != nil {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("task #%d not found", cmd.TaskID))
+	}
+	err := w.server.TaskManager.CancelTask(cmd.TaskID)
+	if errors.Is(err, task.ErrNotRunning) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("task #%d is not running", cmd.TaskID))
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("failed to cancel task: %s", err))
+	}
+	return nil
+}
+
+// stdin writes the data of the command to the stdin of a running task created with stdin
+func (w *wsSession) stdin(cmd *dto.WSCommand) error {
+	t, err := w.server.TaskManager.GetTask(cmd.TaskID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("task #%d not found", cmd.TaskID))
+	}
+	if t.Status != model.TaskStatus_Running {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("task #%d is not running", cmd.TaskID))
+	}
+	err = w.server.TaskManager.WriteTaskStdin(cmd.TaskID, []byte(cmd.Data), cmd.EOF)
+	if errors.Is(err, task.ErrNoStdin) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("task #%d has no open stdin, it must be running and created with stdin", cmd.TaskID))
+	}
+	// The command may read it later, the bytes not written can be sent again
+	if errors.Is(err, shell.ErrStdinFull) {
+		return fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return nil
+}
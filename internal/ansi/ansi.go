@@ -0,0 +1,100 @@
+package ansi
+
+const (
+	esc = 0x1b
+
+	// parameters are capped, cursor movements can't allocate large lines
+	maxParam = 1 << 12
+	// the cursor doesn't move past this column or the end of the text, like past the last column of a terminal
+	maxColumn = 1 << 12
+)
+
+// sequenceLen returns the length of the escape sequence at the start of s, s[0] is ESC.
+// complete is false if s ends before the sequence does.
+func sequenceLen(s string) (n int, complete bool) {
+	if len(s) < 2 {
+		return len(s), false
+	}
+
+	switch s[1] {
+	case '[': // CSI: parameter bytes, intermediate bytes, final byte
+		i := 2
+		for i < len(s) && s[i] >= 0x30 && s[i] <= 0x3f {
+			i++
+		}
+		for i < len(s) && s[i] >= 0x20 && s[i] <= 0x2f {
+			i++
+		}
+		if i == len(s) {
+			return i, false
+		}
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1, true
+		}
+		// malformed, the sequence ends before the unexpected byte
+		return i, true
+
+	case ']', 'P', '^', '_', 'X': // OSC and other strings, terminated by BEL or ST (ESC \)
+		for i := 2; i < len(s); i++ {
+			if s[i] == 0x07 {
+				return i + 1, true
+			}
+			if s[i] == esc && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2, true
+			}
+		}
+		return len(s), false
+
+	default: // intermediate bytes then a final byte, e.g. ESC ( B
+		i := 1
+		for i < len(s) && s[i] >= 0x20 && s[i] <= 0x2f {
+			i++
+		}
+		if i == len(s) {
+			return i, false
+		}
+		return i + 1, true
+	}
+}
+
+// csi returns the parameters and the final byte of a complete CSI sequence, ok is false for other sequences
+func csi(seq string) (params string, final byte, ok bool) {
+	if len(seq) < 3 || seq[1] != '[' {
+		return "", 0, false
+	}
+	final = seq[len(seq)-1]
+	if final < 0x40 || final > 0x7e {
+		return "", 0, false
+	}
+	return seq[2 : len(seq)-1], final, true
+}
+
+// numbers parses the numeric parameters of a CSI sequence, empty parameters are 0
+func numbers(params string) []int {
+	out := []int{0}
+	for i := 0; i < len(params); i++ {
+		switch c := params[i]; {
+		case c >= '0' && c <= '9':
+			if n := out[len(out)-1]; n < maxParam {
+				out[len(out)-1] = n*10 + int(c-'0')
+			}
+		case c == ';' || c == ':':
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+// count returns the first parameter of a cursor movement, 1 if it is missing or 0
+func count(params string) int {
+	n := numbers(params)[0]
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// isControl reports whether c is a C0 control other than tab, or DEL
+func isControl(c byte) bool {
+	return (c < 0x20 && c != '\t') || c == 0x7f
+}
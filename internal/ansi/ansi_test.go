@@ -0,0 +1,65 @@
+package ansi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapse(t *testing.T) {
+	tests := []struct {
+		name, line, want string
+	}{
+		{"Plain", "no rewrite", "no rewrite"},
+		{"Overwrite", "abcdef\rXY", "XYcdef"},
+		{"EraseLine", "abcdef\r\x1b[KXY", "XY"},
+		{"EraseWholeLine", "abcdef\x1b[2K\rXY", "XY"},
+		{"Backspace", "abc\b\bX", "aXc"},
+		{"TrailingCarriageReturn", "abc\r", "abc"},
+		{"CursorColumn", "abcdef\x1b[3GX", "abXdef"},
+		{"CursorForward", "ab\x1b[3CX", "ab   X"},
+		{"Styles", "\x1b[31mred\x1b[0m plain\r\x1b[1mB", "\x1b[0;1mB\x1b[0;31med\x1b[0m plain\x1b[0;1m"},
+		{"DropsOtherSequences", "\x1b]0;title\x07a\rb", "b"},
+		{"IncompleteSequence", "a\rb\x1b[3", "b\x1b[3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(Collapse([]byte(tt.line))))
+		})
+	}
+}
+
+func TestCollapse_CursorLimit(t *testing.T) {
+	// Moves add up, the cursor stops at the last column
+	line := Collapse([]byte(strings.Repeat("\x1b[4095C", 1000) + "x\r"))
+	assert.Len(t, line, maxColumn+1)
+	assert.True(t, strings.HasSuffix(string(line), " x"))
+
+	line = Collapse([]byte("\x1b[99999Gx"))
+	assert.Len(t, line, maxColumn+1)
+
+	// Text past the last column is kept, the cursor moves within it
+	long := strings.Repeat("a", maxColumn+10)
+	assert.Equal(t, long[:maxColumn+5]+"X"+long[maxColumn+6:], string(Collapse([]byte(long+"\r\x1b[4095C\x1b[6CX"))))
+}
+
+func TestRender(t *testing.T) {
+	line := "\x1b[1;31merror:\x1b[0m <failed> \x1b[38;5;196mx\x1b[48;2;0;128;255my\x1b[m"
+
+	assert.Equal(t, line, Render(line, RenderRaw))
+	assert.Equal(t, "error: <failed> xy", Render(line, RenderPlain))
+	assert.Equal(t,
+		`<span class="ansi-bold ansi-fg-1">error:</span> &lt;failed&gt; <span style="color:#ff0000">x</span><span style="color:#ff0000;background-color:#0080ff">y</span>`,
+		Render(line, RenderHTML))
+
+	t.Run("CarriageReturns", func(t *testing.T) {
+		assert.Equal(t, "100%", Render("10%\r50%\r100%", RenderPlain))
+		assert.Equal(t, "a &amp; b", Render("a & b", RenderHTML))
+	})
+
+	t.Run("Inverse", func(t *testing.T) {
+		assert.Equal(t, `<span class="ansi-fg-2 ansi-bg-7">x</span>`, Render("\x1b[37;42;7mx", RenderHTML))
+		assert.Equal(t, `<span class="ansi-inverse">x</span>`, Render("\x1b[7mx", RenderHTML))
+	})
+}
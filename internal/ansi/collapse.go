@@ -0,0 +1,123 @@
+package ansi
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// cell is a character of a collapsed line with the style it was written with
+type cell struct {
+	text  string
+	style style
+}
+
+// NeedsCollapse reports whether the line has carriage returns or backspaces that rewrite it
+func NeedsCollapse(line []byte) bool {
+	return bytes.IndexByte(line, '\r') >= 0 || bytes.IndexByte(line, '\b') >= 0
+}
+
+// Collapse returns the final state of a line rewritten with carriage returns, backspaces and cursor sequences,
+// as a terminal shows it, e.g. the last state of a progress bar. Text written after a carriage return
+// overwrites the line from its start, erase in line sequences (ESC [ K) clear it.
+// Cursor movements stop at maxColumn, or at the end of the line if it's longer.
+// Colors and other SGR styles are kept, re-encoded before the characters they apply to, other escape sequences are dropped.
+// An incomplete escape sequence at the end of the line is kept as is, the rest of it may be read later.
+func Collapse(line []byte) []byte {
+	s := string(line)
+	var cells []cell
+	var current style
+	cursor := 0
+
+	var tail string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\r':
+			cursor = 0
+			i++
+
+		case c == '\b':
+			cursor = max(cursor-1, 0)
+			i++
+
+		case c == esc:
+			n, complete := sequenceLen(s[i:])
+			if !complete {
+				tail = s[i:]
+				i = len(s)
+				continue
+			}
+			seq := s[i : i+n]
+			i += n
+
+			params, final, ok := csi(seq)
+			if !ok {
+				continue
+			}
+			switch final {
+			case 'm':
+				current.apply(params)
+			case 'K':
+				cells = eraseInLine(cells, cursor, numbers(params)[0])
+			case 'G':
+				cursor = min(count(params)-1, max(len(cells), maxColumn))
+			case 'C':
+				cursor = min(cursor+count(params), max(len(cells), maxColumn))
+			case 'D':
+				cursor = max(cursor-count(params), 0)
+			}
+
+		case isControl(c):
+			i++
+
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			for len(cells) < cursor {
+				cells = append(cells, cell{text: " "})
+			}
+			ch := cell{text: s[i : i+size], style: current}
+			if cursor < len(cells) {
+				cells[cursor] = ch
+			} else {
+				cells = append(cells, ch)
+			}
+			cursor++
+			i += size
+		}
+	}
+
+	var out strings.Builder
+	out.Grow(len(cells) + len(tail))
+	var written style
+	for _, ch := range cells {
+		if ch.style != written {
+			out.WriteString(ch.style.sgr())
+			written = ch.style
+		}
+		out.WriteString(ch.text)
+	}
+	// The style set at the end of the line applies to the next lines
+	if current != written {
+		out.WriteString(current.sgr())
+	}
+	out.WriteString(tail)
+	return []byte(out.String())
+}
+
+// eraseInLine applies ESC [ n K: 0 clears from the cursor to the end of the line, 1 from its start to the cursor, 2 the whole line
+func eraseInLine(cells []cell, cursor, mode int) []cell {
+	switch mode {
+	case 0:
+		if cursor < len(cells) {
+			return cells[:cursor]
+		}
+	case 1:
+		for i := 0; i <= cursor && i < len(cells); i++ {
+			cells[i] = cell{text: " "}
+		}
+	case 2:
+		return cells[:0]
+	}
+	return cells
+}
@@ -0,0 +1,109 @@
+package ansi
+
+import (
+	"html"
+	"strings"
+)
+
+const (
+	RenderRaw   = "raw"   // the line as captured, escape sequences included
+	RenderPlain = "plain" // escape sequences and control characters removed
+	RenderHTML  = "html"  // HTML escaped text, styled parts in spans
+)
+
+// Render returns the line in the render format, lines with carriage returns or backspaces are collapsed first
+func Render(line, render string) string {
+	switch render {
+	case RenderPlain:
+		return Plain(line)
+	case RenderHTML:
+		return HTML(line)
+	}
+	return line
+}
+
+// Plain removes the escape sequences and the control characters of a line but tabs
+func Plain(line string) string {
+	line = collapsed(line)
+	if !hasEscapes(line) {
+		return line
+	}
+
+	var out strings.Builder
+	out.Grow(len(line))
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == esc:
+			n, _ := sequenceLen(line[i:])
+			i += n
+		case isControl(c):
+			i++
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.String()
+}
+
+// HTML escapes a line for HTML, the parts styled by SGR sequences are wrapped in spans with ansi-* classes
+// or inline colors, see style.attributes. Other escape sequences and control characters are removed.
+func HTML(line string) string {
+	line = collapsed(line)
+	if !hasEscapes(line) {
+		return html.EscapeString(line)
+	}
+
+	var out, text strings.Builder
+	var current, written style
+	flush := func() {
+		if text.Len() == 0 {
+			return
+		}
+		if written != (style{}) {
+			out.WriteString("<span" + written.attributes() + ">" + html.EscapeString(text.String()) + "</span>")
+		} else {
+			out.WriteString(html.EscapeString(text.String()))
+		}
+		text.Reset()
+	}
+
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == esc:
+			n, _ := sequenceLen(line[i:])
+			if params, final, ok := csi(line[i : i+n]); ok && final == 'm' {
+				current.apply(params)
+			}
+			i += n
+		case isControl(c):
+			i++
+		default:
+			if current != written {
+				flush()
+				written = current
+			}
+			text.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+	return out.String()
+}
+
+func collapsed(line string) string {
+	if strings.ContainsAny(line, "\r\b") {
+		return string(Collapse([]byte(line)))
+	}
+	return line
+}
+
+// hasEscapes reports whether the line has escape sequences or control characters other than tabs
+func hasEscapes(line string) bool {
+	for i := 0; i < len(line); i++ {
+		if isControl(line[i]) {
+			return true
+		}
+	}
+	return false
+}
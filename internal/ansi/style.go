@@ -0,0 +1,188 @@
+package ansi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type colorKind uint8
+
+const (
+	colorDefault colorKind = iota
+	colorIndex             // 256 colors palette, 0-15 are the standard and bright colors
+	colorRGB
+)
+
+type color struct {
+	kind  colorKind
+	value uint32 // palette index or 0xRRGGBB
+}
+
+// style is the state set by SGR sequences (ESC [ ... m), the zero value is the default style
+type style struct {
+	fg, bg    color
+	bold      bool
+	dim       bool
+	italic    bool
+	underline bool
+	inverse   bool
+	strike    bool
+}
+
+// apply updates the style with the parameters of an SGR sequence, unknown parameters are ignored
+func (s *style) apply(params string) {
+	codes := numbers(params)
+	for i := 0; i < len(codes); i++ {
+		switch code := codes[i]; {
+		case code == 0:
+			*s = style{}
+		case code == 1:
+			s.bold = true
+		case code == 2:
+			s.dim = true
+		case code == 3:
+			s.italic = true
+		case code == 4:
+			s.underline = true
+		case code == 7:
+			s.inverse = true
+		case code == 9:
+			s.strike = true
+		case code == 22:
+			s.bold, s.dim = false, false
+		case code == 23:
+			s.italic = false
+		case code == 24:
+			s.underline = false
+		case code == 27:
+			s.inverse = false
+		case code == 29:
+			s.strike = false
+		case code >= 30 && code <= 37:
+			s.fg = color{kind: colorIndex, value: uint32(code - 30)}
+		case code == 38:
+			s.fg, i = extendedColor(codes, i)
+		case code == 39:
+			s.fg = color{}
+		case code >= 40 && code <= 47:
+			s.bg = color{kind: colorIndex, value: uint32(code - 40)}
+		case code == 48:
+			s.bg, i = extendedColor(codes, i)
+		case code == 49:
+			s.bg = color{}
+		case code >= 90 && code <= 97:
+			s.fg = color{kind: colorIndex, value: uint32(code - 90 + 8)}
+		case code >= 100 && code <= 107:
+			s.bg = color{kind: colorIndex, value: uint32(code - 100 + 8)}
+		}
+	}
+}
+
+// extendedColor parses the color of a 38 or 48 code at codes[i], 5;n or 2;r;g;b,
+// and returns the index of its last parameter
+func extendedColor(codes []int, i int) (color, int) {
+	if i+2 < len(codes) && codes[i+1] == 5 {
+		return color{kind: colorIndex, value: uint32(codes[i+2] & 0xff)}, i + 2
+	}
+	if i+4 < len(codes) && codes[i+1] == 2 {
+		r, g, b := codes[i+2]&0xff, codes[i+3]&0xff, codes[i+4]&0xff
+		return color{kind: colorRGB, value: uint32(r<<16 | g<<8 | b)}, i + 4
+	}
+	return color{}, len(codes)
+}
+
+// sgr returns the SGR sequence that sets the style from any state
+func (s style) sgr() string {
+	codes := []string{"0"}
+	flags := []struct {
+		set  bool
+		code string
+	}{{s.bold, "1"}, {s.dim, "2"}, {s.italic, "3"}, {s.underline, "4"}, {s.inverse, "7"}, {s.strike, "9"}}
+	for _, flag := range flags {
+		if flag.set {
+			codes = append(codes, flag.code)
+		}
+	}
+	codes = append(codes, s.fg.sgr(30, 90, 38)...)
+	codes = append(codes, s.bg.sgr(40, 100, 48)...)
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+func (c color) sgr(base, bright, extended int) []string {
+	switch {
+	case c.kind == colorIndex && c.value < 8:
+		return []string{strconv.Itoa(base + int(c.value))}
+	case c.kind == colorIndex && c.value < 16:
+		return []string{strconv.Itoa(bright + int(c.value) - 8)}
+	case c.kind == colorIndex:
+		return []string{strconv.Itoa(extended), "5", strconv.Itoa(int(c.value))}
+	case c.kind == colorRGB:
+		return []string{strconv.Itoa(extended), "2", strconv.Itoa(int(c.value >> 16)), strconv.Itoa(int(c.value >> 8 & 0xff)), strconv.Itoa(int(c.value & 0xff))}
+	}
+	return nil
+}
+
+// attributes returns the class and style attributes of the span of the style, the 16 standard colors
+// are classes (ansi-fg-N, ansi-bg-N) so the page picks its palette, other colors are inline styles
+func (s style) attributes() string {
+	fg, bg := s.fg, s.bg
+	var classes, styles []string
+	if s.inverse {
+		fg, bg = bg, fg
+		if fg.kind == colorDefault || bg.kind == colorDefault {
+			classes = append(classes, "ansi-inverse")
+		}
+	}
+
+	flags := []struct {
+		set   bool
+		class string
+	}{{s.bold, "ansi-bold"}, {s.dim, "ansi-dim"}, {s.italic, "ansi-italic"}, {s.underline, "ansi-underline"}, {s.strike, "ansi-strike"}}
+	for _, flag := range flags {
+		if flag.set {
+			classes = append(classes, flag.class)
+		}
+	}
+
+	for _, c := range []struct {
+		color
+		name, property string
+	}{{fg, "fg", "color"}, {bg, "bg", "background-color"}} {
+		switch {
+		case c.kind == colorIndex && c.value < 16:
+			classes = append(classes, fmt.Sprintf("ansi-%s-%d", c.name, c.value))
+		case c.kind != colorDefault:
+			styles = append(styles, fmt.Sprintf("%s:#%06x", c.property, c.rgb()))
+		}
+	}
+
+	var attrs string
+	if len(classes) > 0 {
+		attrs += ` class="` + strings.Join(classes, " ") + `"`
+	}
+	if len(styles) > 0 {
+		attrs += ` style="` + strings.Join(styles, ";") + `"`
+	}
+	return attrs
+}
+
+// rgb returns the 0xRRGGBB value of a color of the 256 colors palette past the first 16, or of an RGB color
+func (c color) rgb() uint32 {
+	if c.kind == colorRGB {
+		return c.value
+	}
+	if c.value >= 232 { // grayscale ramp
+		gray := 8 + (c.value-232)*10
+		return gray<<16 | gray<<8 | gray
+	}
+	// 6x6x6 color cube
+	level := func(v uint32) uint32 {
+		if v == 0 {
+			return 0
+		}
+		return 55 + v*40
+	}
+	i := c.value - 16
+	return level(i/36)<<16 | level(i/6%6)<<8 | level(i%6)
+}
@@ -0,0 +1,143 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/pkg/logger"
+)
+
+const (
+	ClientAuthNone          = "none"
+	ClientAuthVerifyIfGiven = "verify_if_given"
+	ClientAuthRequire       = "require"
+)
+
+// Reloader holds the server certificate and the client CA pool, they are reloaded from disk on SIGHUP
+// so certificates can be rotated without restarting the server.
+type Reloader struct {
+	config *config.Config
+	logger *logger.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+func NewReloader(config *config.Config, logger *logger.Logger) (*Reloader, error) {
+	r := &Reloader{
+		config:  config,
+		logger:  logger,
+		signals: make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload loads the certificate, key and client CA files, the current ones are kept if loading fails.
+func (r *Reloader) Reload() error {
+	cfg := r.config.Server.TLS
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file: %s", cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.mu.Unlock()
+
+	return nil
+}
+
+// TLSConfig returns a config that always serves the latest loaded certificate.
+func (r *Reloader) TLSConfig() (*tls.Config, error) {
+	clientAuth, err := r.clientAuthType()
+	if err != nil {
+		return nil, err
+	}
+
+	if clientAuth != tls.NoClientCert && r.config.Server.TLS.ClientCAFile == "" {
+		return nil, fmt.Errorf("client CA file is required when client auth is %q", r.config.Server.TLS.ClientAuth)
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.clientCAs,
+				ClientAuth:   clientAuth,
+			}, nil
+		},
+	}, nil
+}
+
+func (r *Reloader) clientAuthType() (tls.ClientAuthType, error) {
+	switch r.config.Server.TLS.ClientAuth {
+	case ClientAuthNone, "":
+		return tls.NoClientCert, nil
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth mode: %s", r.config.Server.TLS.ClientAuth)
+	}
+}
+
+// Start reloads the certificates every time the process receives SIGHUP.
+func (r *Reloader) Start() {
+	signal.Notify(r.signals, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-r.signals:
+				r.logger.Info("SIGHUP received, reloading TLS certificates")
+				if err := r.Reload(); err != nil {
+					r.logger.Errorf("failed to reload TLS certificates, keeping the current ones: %s", err)
+					continue
+				}
+				r.logger.Info("TLS certificates reloaded")
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+func (r *Reloader) Stop() {
+	signal.Stop(r.signals)
+	close(r.done)
+}
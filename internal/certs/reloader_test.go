@@ -0,0 +1,101 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeSelfSignedCert(t *testing.T, dir, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	return certFile, keyFile
+}
+
+func servedCommonName(t *testing.T, tlsConfig *tls.Config) string {
+	cfg, err := tlsConfig.GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	assert.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestReloader_Reload(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "certs_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	certFile, keyFile := writeSelfSignedCert(t, tmpDir, "first")
+	cfg := &config.Config{
+		Server: config.Server{
+			TLS: config.TLS{Enabled: true, CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthNone},
+		},
+	}
+
+	reloader, err := NewReloader(cfg, logger.NewTestLogger())
+	assert.NoError(t, err)
+
+	tlsConfig, err := reloader.TLSConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", servedCommonName(t, tlsConfig))
+
+	writeSelfSignedCert(t, tmpDir, "second")
+	assert.NoError(t, reloader.Reload())
+	assert.Equal(t, "second", servedCommonName(t, tlsConfig))
+
+	// A broken key keeps the current certificate
+	assert.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "second", servedCommonName(t, tlsConfig))
+}
+
+func TestReloader_ClientAuthRequiresCA(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "certs_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	certFile, keyFile := writeSelfSignedCert(t, tmpDir, "server")
+	cfg := &config.Config{
+		Server: config.Server{
+			TLS: config.TLS{Enabled: true, CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire},
+		},
+	}
+
+	reloader, err := NewReloader(cfg, logger.NewTestLogger())
+	assert.NoError(t, err)
+
+	_, err = reloader.TLSConfig()
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+package eventbus
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/pkg/logger"
+)
+
+const DROP_LOG_INTERVAL = 1000 // dropped events of a subscriber between two warnings
+
+// Subscriber receives the events published on the bus from the time it subscribed, in the order they were published
+type Subscriber struct {
+	Name    string
+	events  chan *Event
+	dropped atomic.Uint64
+}
+
+// Events is closed once the subscriber unsubscribes or the bus is closed
+func (s *Subscriber) Events() <-chan *Event {
+	return s.events
+}
+
+// Dropped returns the number of events the subscriber missed because its buffer was full
+func (s *Subscriber) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Bus publishes the events of the tasks to every subscriber, each subscriber has its own buffer
+// so a slow subscriber doesn't delay the publishers nor the other subscribers
+type Bus struct {
+	config *config.Config
+	logger *logger.Logger
+
+	// also orders the events published concurrently, every subscriber receives them in the same order
+	mu          sync.Mutex
+	subscribers map[*Subscriber]struct{}
+	closed      bool
+}
+
+func NewBus(config *config.Config, logger *logger.Logger) *Bus {
+	return &Bus{
+		config:      config,
+		logger:      logger,
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber with a buffer of the configured size, name identifies it in the logs
+func (b *Bus) Subscribe(name string) *Subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscriber := &Subscriber{Name: name, events: make(chan *Event, b.config.EventBus.BufferSize)}
+	if b.closed {
+		close(subscriber.events)
+		return subscriber
+	}
+	b.subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+func (b *Bus) Unsubscribe(subscriber *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[subscriber]; !ok {
+		return
+	}
+	delete(b.subscribers, subscriber)
+	close(subscriber.events)
+}
+
+// Publish sends the event to every subscriber without blocking, a subscriber whose buffer is full misses it.
+// Events published after Close are dropped.
+func (b *Bus) Publish(event *Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber.events <- event:
+		default:
+			if dropped := subscriber.dropped.Add(1); dropped%DROP_LOG_INTERVAL == 1 {
+				b.logger.Warnf("event bus subscriber %s is too slow, %d events dropped so far", subscriber.Name, dropped)
+			}
+		}
+	}
+}
+
+// Close closes the events of every subscriber once they received the events already published
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for subscriber := range b.subscribers {
+		delete(b.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
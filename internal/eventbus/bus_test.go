@@ -0,0 +1,101 @@
+package eventbus
+
+import (
+	"testing"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBus(bufferSize int) *Bus {
+	return NewBus(&config.Config{EventBus: config.EventBus{BufferSize: bufferSize}}, logger.NewTestLogger())
+}
+
+// receive returns the events buffered for the subscriber
+func receive(subscriber *Subscriber) []*Event {
+	var events []*Event
+	for {
+		select {
+		case event, ok := <-subscriber.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestBus(t *testing.T) {
+	started := NewTaskEvent(EventTaskStarted, &TaskMsg{TaskID: 1, Status: model.TaskStatus_Running})
+	log := NewLogEvent(&LogMsg{TaskID: 1, LineNumber: 1, Line: "hello"})
+	completed := NewTaskEvent(EventTaskCompleted, &TaskMsg{TaskID: 1, Status: model.TaskStatus_Completed})
+
+	t.Run("Subscribers", func(t *testing.T) {
+		bus := newTestBus(10)
+		a, b := bus.Subscribe("a"), bus.Subscribe("b")
+
+		bus.Publish(started)
+		bus.Publish(log)
+		assert.Equal(t, []*Event{started, log}, receive(a))
+
+		bus.Publish(completed)
+		assert.Equal(t, []*Event{completed}, receive(a))
+		assert.Equal(t, []*Event{started, log, completed}, receive(b), "every subscriber receives every event")
+
+		late := bus.Subscribe("late")
+		assert.Empty(t, receive(late), "subscribers only receive the events published after they subscribed")
+	})
+
+	t.Run("SlowSubscriber", func(t *testing.T) {
+		bus := newTestBus(2)
+		slow, fast := bus.Subscribe("slow"), bus.Subscribe("fast")
+
+		// Publish never blocks, the slow subscriber misses the events published while its buffer is full
+		bus.Publish(started)
+		bus.Publish(log)
+		assert.Equal(t, []*Event{started, log}, receive(fast))
+		bus.Publish(completed)
+		assert.Equal(t, []*Event{completed}, receive(fast))
+
+		assert.Equal(t, []*Event{started, log}, receive(slow))
+		assert.Equal(t, uint64(1), slow.Dropped())
+		assert.Equal(t, uint64(0), fast.Dropped())
+	})
+
+	t.Run("Unsubscribe", func(t *testing.T) {
+		bus := newTestBus(10)
+		a, b := bus.Subscribe("a"), bus.Subscribe("b")
+
+		bus.Publish(started)
+		bus.Unsubscribe(a)
+		bus.Unsubscribe(a)
+		bus.Publish(completed)
+
+		_, ok := <-a.Events()
+		assert.True(t, ok, "the buffered events are still received")
+		_, ok = <-a.Events()
+		assert.False(t, ok)
+		assert.Equal(t, []*Event{started, completed}, receive(b))
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		bus := newTestBus(10)
+		a := bus.Subscribe("a")
+
+		bus.Publish(started)
+		bus.Close()
+		bus.Publish(completed)
+		bus.Close()
+
+		assert.Equal(t, []*Event{started}, receive(a))
+		_, ok := <-a.Events()
+		assert.False(t, ok)
+
+		_, ok = <-bus.Subscribe("closed").Events()
+		assert.False(t, ok, "subscribing to a closed bus returns a closed subscriber")
+	})
+}
@@ -0,0 +1,61 @@
+package eventbus
+
+import "github.com/fattymango/px-take-home/model"
+
+type EventType uint8
+
+const (
+	EventTaskCreated EventType = iota + 1
+	EventTaskQueued
+	EventTaskStarted
+	EventTaskLog
+	EventTaskCompleted
+	EventTaskFailed
+	EventTaskCancelled
+	EventTaskRejected
+)
+
+var EventType_name = map[EventType]string{
+	EventTaskCreated:   "created",
+	EventTaskQueued:    "queued",
+	EventTaskStarted:   "started",
+	EventTaskLog:       "log",
+	EventTaskCompleted: "completed",
+	EventTaskFailed:    "failed",
+	EventTaskCancelled: "cancelled",
+	EventTaskRejected:  "rejected",
+}
+
+// TaskMsg is the status of a task after a status event
+type TaskMsg struct {
+	TaskID   uint64           `json:"task_id"`
+	Status   model.TaskStatus `json:"status"`
+	Reason   string           `json:"reason"`
+	ExitCode int              `json:"exit_code"`
+}
+
+// LogMsg is a line of the output of a task
+type LogMsg struct {
+	TaskID     uint64          `json:"task_id"`
+	LineNumber int             `json:"line_number"`
+	Stream     model.LogStream `json:"stream"`
+	Timestamp  int64           `json:"timestamp"` // unix nano
+	Line       string          `json:"line"`
+}
+
+// Event is an event of a task, Task is set for the status events and Log for the log line events
+type Event struct {
+	Type   EventType
+	TaskID uint64
+	Task   *TaskMsg
+	Log    *LogMsg
+}
+
+// NewTaskEvent returns a status event of the task
+func NewTaskEvent(eventType EventType, msg *TaskMsg) *Event {
+	return &Event{Type: eventType, TaskID: msg.TaskID, Task: msg}
+}
+
+func NewLogEvent(msg *LogMsg) *Event {
+	return &Event{Type: EventTaskLog, TaskID: msg.TaskID, Log: msg}
+}
@@ -0,0 +1,212 @@
+package janitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/logger"
+)
+
+// Reasons a task is removed
+const (
+	ReasonMaxAge      = "max_age"
+	ReasonMaxTasks    = "max_tasks"
+	ReasonMaxLogBytes = "max_log_bytes"
+)
+
+// finished tasks read at once by a run
+const batchSize = 500
+
+type Store interface {
+	// GetFinishedTasks returns at most limit tasks in a terminal state with an ID below beforeID, newest first,
+	// a beforeID of 0 starts at the newest task
+	GetFinishedTasks(beforeID uint64, limit int) ([]*model.Task, error)
+	DeleteTasks(ids []uint64) error
+}
+
+// Logs is the part of the log store used by the janitor
+type Logs interface {
+	// Size returns the bytes used by the log of a task
+	Size(taskID uint64) (int64, error)
+	Delete(taskID uint64) error
+}
+
+// Removal is a task removed by the janitor, with the bytes used by its log
+type Removal struct {
+	Task   *model.Task
+	Reason string
+	Bytes  int64
+}
+
+// Report is what a janitor run removed, or would remove on a dry run
+type Report struct {
+	DryRun         bool
+	StartedAt      time.Time
+	Removals       []*Removal
+	ReclaimedBytes int64
+	KeptTasks      int
+	KeptBytes      int64
+}
+
+// Janitor removes finished tasks and their logs according to the retention config.
+// Tasks are soft deleted, their logs are removed from the log store.
+// Only finished tasks are considered, the logs of running tasks are never removed.
+type Janitor struct {
+	config *config.Config
+	logger *logger.Logger
+	store  Store
+	logs   Logs
+
+	// only one run at a time, so a dry run always reflects the current state
+	mu sync.Mutex
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewJanitor(config *config.Config, logger *logger.Logger, store Store, logs Logs) *Janitor {
+	return &Janitor{
+		config: config,
+		logger: logger,
+		store:  store,
+		logs:   logs,
+		done:   make(chan struct{}),
+	}
+}
+
+// Start runs the janitor every retention interval
+func (j *Janitor) Start() {
+	j.wg.Add(1)
+	ticker := time.NewTicker(j.config.Retention.Interval)
+
+	go func() {
+		defer j.wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report, err := j.Run(false)
+				if err != nil {
+					j.logger.Errorf("retention run failed: %s", err)
+					continue
+				}
+				if len(report.Removals) > 0 {
+					j.logger.Infof("retention run removed %d tasks, reclaimed %d bytes", len(report.Removals), report.ReclaimedBytes)
+				}
+			case <-j.done:
+				return
+			}
+		}
+	}()
+	j.logger.Infof("janitor started, running every %s", j.config.Retention.Interval)
+}
+
+func (j *Janitor) Stop() {
+	close(j.done)
+	j.wg.Wait()
+}
+
+// Run removes the tasks that are out of retention, on a dry run nothing is removed
+func (j *Janitor) Run(dryRun bool) (*Report, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	report, err := j.plan(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = dryRun
+
+	if dryRun || len(report.Removals) == 0 {
+		return report, nil
+	}
+
+	ids := make([]uint64, 0, len(report.Removals))
+	for _, removal := range report.Removals {
+		ids = append(ids, removal.Task.ID)
+	}
+
+	// Tasks are deleted first, so a task is never listed without its logs
+	if err := j.store.DeleteTasks(ids); err != nil {
+		return nil, fmt.Errorf("failed to delete tasks: %w", err)
+	}
+
+	for _, removal := range report.Removals {
+		if err := j.logs.Delete(removal.Task.ID); err != nil {
+			j.logger.Errorf("failed to remove log of task #%d: %s", removal.Task.ID, err)
+		}
+	}
+
+	return report, nil
+}
+
+// plan walks the finished tasks from the newest, a batch at a time, and picks the ones out of retention
+func (j *Janitor) plan(now time.Time) (*Report, error) {
+	retention := j.config.Retention
+
+	report := &Report{StartedAt: now}
+	// once a task doesn't fit in the disk budget, older tasks are removed as well
+	diskFull := false
+
+	var beforeID uint64
+	for {
+		tasks, err := j.store.GetFinishedTasks(beforeID, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get finished tasks: %w", err)
+		}
+
+		for _, task := range tasks {
+			size, err := j.logs.Size(task.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get log size of task #%d: %w", task.ID, err)
+			}
+
+			var reason string
+			switch {
+			case j.expired(task, now):
+				reason = ReasonMaxAge
+			case retention.MaxTasks > 0 && report.KeptTasks >= retention.MaxTasks:
+				reason = ReasonMaxTasks
+			case retention.MaxLogBytes > 0 && (diskFull || report.KeptBytes+size > retention.MaxLogBytes):
+				diskFull = true
+				reason = ReasonMaxLogBytes
+			}
+
+			if reason == "" {
+				report.KeptTasks++
+				report.KeptBytes += size
+				continue
+			}
+
+			report.Removals = append(report.Removals, &Removal{Task: task, Reason: reason, Bytes: size})
+			report.ReclaimedBytes += size
+		}
+
+		if len(tasks) < batchSize {
+			return report, nil
+		}
+		beforeID = tasks[len(tasks)-1].ID
+	}
+}
+
+// expired reports whether the task finished longer ago than the max age of its status
+func (j *Janitor) expired(task *model.Task, now time.Time) bool {
+	maxAge := j.config.Retention.MaxAge
+	if override, ok := j.config.Retention.MaxAgeByStatus[model.TaskStatus_name[task.Status]]; ok {
+		maxAge = override
+	}
+	if maxAge <= 0 {
+		return false
+	}
+
+	// Tasks that never ran, like rejected ones, have no end time
+	finishedAt := time.Unix(int64(task.EndTime), 0)
+	if task.EndTime == 0 {
+		finishedAt = time.Unix(0, task.UpdatedAt)
+	}
+
+	return now.Sub(finishedAt) > maxAge
+}
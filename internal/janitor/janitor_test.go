@@ -0,0 +1,142 @@
+package janitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fattymango/px-take-home/config"
+	logstore "github.com/fattymango/px-take-home/internal/log_store"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore struct {
+	tasks   []*model.Task
+	deleted []uint64
+	reads   int
+}
+
+// GetFinishedTasks pages through the tasks, they are newest first
+func (f *fakeStore) GetFinishedTasks(beforeID uint64, limit int) ([]*model.Task, error) {
+	f.reads++
+	var tasks []*model.Task
+	for _, task := range f.tasks {
+		if (beforeID == 0 || task.ID < beforeID) && len(tasks) < limit {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+func (f *fakeStore) DeleteTasks(ids []uint64) error {
+	f.deleted = append(f.deleted, ids...)
+	return nil
+}
+
+func writeTaskFiles(t *testing.T, dir string, taskID uint64, size int) {
+	for _, ext := range []string{"log", "stream", "ts"} {
+		err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.%s", taskID, ext)), make([]byte, size), 0644)
+		assert.NoError(t, err)
+	}
+}
+
+func TestJanitor_Run(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "janitor_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	now := time.Now()
+	daysAgo := func(days int) uint64 { return uint64(now.Add(-time.Duration(days) * 24 * time.Hour).Unix()) }
+
+	// newest first, like the store returns them
+	store := &fakeStore{tasks: []*model.Task{
+		{ID: 5, Status: model.TaskStatus_Completed, EndTime: daysAgo(0)},
+		{ID: 4, Status: model.TaskStatus_Failed, EndTime: daysAgo(5)},    // failed tasks are kept longer
+		{ID: 3, Status: model.TaskStatus_Completed, EndTime: daysAgo(5)}, // too old
+		{ID: 2, Status: model.TaskStatus_Completed, EndTime: daysAgo(1)}, // over the disk budget
+		{ID: 1, Status: model.TaskStatus_Completed, EndTime: daysAgo(1)}, // older than a task over the budget
+	}}
+	writeTaskFiles(t, tmpDir, 5, 10)
+	writeTaskFiles(t, tmpDir, 4, 10)
+	writeTaskFiles(t, tmpDir, 3, 10)
+	writeTaskFiles(t, tmpDir, 2, 10)
+	writeTaskFiles(t, tmpDir, 1, 1)
+
+	cfg := &config.Config{
+		TaskLogger: config.TaskLogger{DirPath: tmpDir},
+		Retention: config.Retention{
+			MaxAge:         3 * 24 * time.Hour,
+			MaxAgeByStatus: map[string]time.Duration{"failed": 7 * 24 * time.Hour},
+			MaxLogBytes:    70,
+		},
+	}
+
+	j := NewJanitor(cfg, logger.NewTestLogger(), store, logstore.NewFileStore(cfg, logger.NewTestLogger()))
+
+	report, err := j.Run(true)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Len(t, report.Removals, 3)
+	assert.Equal(t, ReasonMaxAge, report.Removals[0].Reason)
+	assert.Equal(t, ReasonMaxLogBytes, report.Removals[1].Reason)
+	assert.Equal(t, ReasonMaxLogBytes, report.Removals[2].Reason)
+	assert.Equal(t, int64(30+30+3), report.ReclaimedBytes)
+	assert.Equal(t, 2, report.KeptTasks)
+	assert.Empty(t, store.deleted)
+
+	// A dry run removes nothing
+	files, _ := filepath.Glob(filepath.Join(tmpDir, "*"))
+	assert.Len(t, files, 15)
+
+	report, err = j.Run(false)
+	assert.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Equal(t, []uint64{3, 2, 1}, store.deleted)
+
+	files, _ = filepath.Glob(filepath.Join(tmpDir, "*"))
+	assert.Len(t, files, 6)
+}
+
+func TestJanitor_MaxTasks(t *testing.T) {
+	store := &fakeStore{tasks: []*model.Task{
+		{ID: 3, Status: model.TaskStatus_Completed},
+		{ID: 2, Status: model.TaskStatus_Rejected},
+		{ID: 1, Status: model.TaskStatus_Cancelled},
+	}}
+
+	cfg := &config.Config{
+		TaskLogger: config.TaskLogger{DirPath: t.TempDir()},
+		Retention:  config.Retention{MaxTasks: 1},
+	}
+
+	report, err := NewJanitor(cfg, logger.NewTestLogger(), store, logstore.NewFileStore(cfg, logger.NewTestLogger())).Run(false)
+	assert.NoError(t, err)
+	assert.Len(t, report.Removals, 2)
+	assert.Equal(t, ReasonMaxTasks, report.Removals[0].Reason)
+	assert.Equal(t, []uint64{2, 1}, store.deleted)
+}
+
+func TestJanitor_Batches(t *testing.T) {
+	store := &fakeStore{}
+	for id := uint64(1200); id >= 1; id-- {
+		store.tasks = append(store.tasks, &model.Task{ID: id, Status: model.TaskStatus_Completed})
+	}
+
+	cfg := &config.Config{
+		TaskLogger: config.TaskLogger{DirPath: t.TempDir()},
+		Retention:  config.Retention{MaxTasks: 1000},
+	}
+
+	// The tasks are read a batch at a time, the kept tasks are counted across batches
+	report, err := NewJanitor(cfg, logger.NewTestLogger(), store, logstore.NewFileStore(cfg, logger.NewTestLogger())).Run(true)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, store.reads)
+	assert.Equal(t, 1000, report.KeptTasks)
+	assert.Len(t, report.Removals, 200)
+	assert.Equal(t, uint64(200), report.Removals[0].Task.ID)
+	assert.Equal(t, uint64(1), report.Removals[199].Task.ID)
+}
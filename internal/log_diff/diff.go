@@ -0,0 +1,164 @@
+package logdiff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"os"
+	"regexp"
+
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+)
+
+const (
+	DefaultContext    = 3
+	MaxContext        = 100
+	MaxIgnorePatterns = 10
+	MaxPatternLength  = 1024
+
+	// lines scanned between two checks of the context
+	checkInterval = 1024
+)
+
+// timestamps commonly printed by commands: ISO 8601 and RFC 3339 dates, slash separated dates and times of day
+var timestampRegex = regexp.MustCompile(
+	`\d{4}[-/]\d{2}[-/]\d{2}(?:[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?)?|\b\d{2}:\d{2}:\d{2}(?:[.,]\d+)?\b`,
+)
+
+// Scanner reads every line of a task log in order, like logstore.LogStore.Scan
+type Scanner interface {
+	Scan(taskID uint64, fn func(line *logreader.Line) error) error
+}
+
+// Options selects what the comparison ignores and the lines of context around changes
+type Options struct {
+	// Timestamps printed in the lines are ignored, see timestampRegex
+	IgnoreTimestamps bool
+	// The matches of these patterns are ignored, e.g. ids or durations that change on every run
+	Ignore []*regexp.Regexp
+	// Unchanged lines shown before and after every change
+	Context int
+}
+
+// normalize returns the part of the line that is compared
+func (o *Options) normalize(text string) string {
+	if o.IgnoreTimestamps {
+		text = timestampRegex.ReplaceAllLiteralString(text, "")
+	}
+	for _, re := range o.Ignore {
+		text = re.ReplaceAllLiteralString(text, "")
+	}
+	return text
+}
+
+// Diff is the line diff of the logs of two tasks. Only the hash of every line is kept to compute it,
+// the lines of the hunks are read again from the logs by Write, so large logs are never held in memory.
+type Diff struct {
+	A, B           uint64 // tasks compared, A is the old log and B the new one
+	ALines, BLines int
+	Deleted        int // lines of A not in B
+	Inserted       int // lines of B not in A
+	Hunks          []*Hunk
+
+	scanner Scanner
+}
+
+// Hunk is a group of changes with their context, starts are 0-based line indexes
+type Hunk struct {
+	AStart, AEnd int // lines [AStart, AEnd) of A
+	BStart, BEnd int // lines [BStart, BEnd) of B
+	blocks       []block
+}
+
+// Header returns the unified diff header of the hunk, e.g. @@ -1,3 +1,4 @@
+func (h *Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", unifiedRange(h.AStart, h.AEnd), unifiedRange(h.BStart, h.BEnd))
+}
+
+// unifiedRange formats a range like diff -u, the start of an empty range is the line before it
+func unifiedRange(start, end int) string {
+	switch end - start {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, end-start)
+	}
+}
+
+// block replaces the lines [a0, a1) of A by the lines [b0, b1) of B
+type block struct {
+	a0, a1 int
+	b0, b1 int
+}
+
+// Compare reads both logs and computes their diff. A task without log compares as an empty log.
+func Compare(ctx context.Context, scanner Scanner, a, b uint64, opts *Options) (*Diff, error) {
+	seed := maphash.MakeSeed()
+
+	x, err := hashLines(ctx, scanner, a, seed, opts)
+	if err != nil {
+		return nil, err
+	}
+	y, err := hashLines(ctx, scanner, b, seed, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &Diff{A: a, B: b, ALines: len(x), BLines: len(y), scanner: scanner}
+	blocks := diffLines(x, y, 0, 0, nil, 0)
+	for _, block := range blocks {
+		diff.Deleted += block.a1 - block.a0
+		diff.Inserted += block.b1 - block.b0
+	}
+	diff.Hunks = hunks(blocks, len(x), len(y), opts.Context)
+	return diff, nil
+}
+
+func hashLines(ctx context.Context, scanner Scanner, taskID uint64, seed maphash.Seed, opts *Options) ([]uint64, error) {
+	var hashes []uint64
+	err := scanner.Scan(taskID, func(line *logreader.Line) error {
+		if line.Number%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		hashes = append(hashes, maphash.String(seed, opts.normalize(line.Text)))
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log of task #%d: %w", taskID, err)
+	}
+	return hashes, nil
+}
+
+// hunks groups the blocks closer than twice the context, every hunk shows the context lines around its blocks
+func hunks(blocks []block, lenA, lenB, context int) []*Hunk {
+	var out []*Hunk
+	for i := 0; i < len(blocks); {
+		first := blocks[i]
+		j := i + 1
+		for j < len(blocks) && blocks[j].a0-blocks[j-1].a1 <= 2*context {
+			j++
+		}
+		last := blocks[j-1]
+
+		// Unchanged lines are the same number of lines on both sides
+		before := min(context, first.a0)
+		after := min(context, lenA-last.a1)
+		out = append(out, &Hunk{
+			AStart: first.a0 - before,
+			AEnd:   last.a1 + after,
+			BStart: first.b0 - before,
+			BEnd:   min(last.b1+after, lenB),
+			blocks: blocks[i:j],
+		})
+		i = j
+	}
+	return out
+}
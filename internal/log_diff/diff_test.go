@@ -0,0 +1,125 @@
+package logdiff
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeLogs map[uint64][]string
+
+func (f fakeLogs) Scan(taskID uint64, fn func(line *logreader.Line) error) error {
+	for i, text := range f[taskID] {
+		if err := fn(&logreader.Line{Number: i + 1, Text: text}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unified writes the diff like diff -u without the file headers
+type unified struct {
+	strings.Builder
+}
+
+func (u *unified) WriteHunk(hunk *Hunk) error {
+	u.WriteString(hunk.Header() + "\n")
+	return nil
+}
+
+func (u *unified) WriteLine(line *Line) error {
+	text := line.A
+	if line.Op == OpInsert {
+		text = line.B
+	}
+	u.WriteString(string(line.Op) + text.Text + "\n")
+	return nil
+}
+
+func diff(t *testing.T, a, b []string, opts *Options) (*Diff, string) {
+	d, err := Compare(context.Background(), fakeLogs{1: a, 2: b}, 1, 2, opts)
+	assert.NoError(t, err)
+	out := &unified{}
+	assert.NoError(t, d.Write(out))
+	return d, out.String()
+}
+
+func TestDiff(t *testing.T) {
+	t.Run("Equal", func(t *testing.T) {
+		d, out := diff(t, []string{"a", "b"}, []string{"a", "b"}, &Options{Context: 3})
+		assert.Empty(t, d.Hunks)
+		assert.Empty(t, out)
+	})
+
+	t.Run("Change", func(t *testing.T) {
+		d, out := diff(t,
+			[]string{"start", "one", "two", "three", "four", "five", "end"},
+			[]string{"start", "one", "2", "three", "four", "five", "end", "extra"},
+			&Options{Context: 1})
+		assert.Equal(t, 1, d.Deleted)
+		assert.Equal(t, 2, d.Inserted)
+		assert.Equal(t, "@@ -2,3 +2,3 @@\n one\n-two\n+2\n three\n@@ -7 +7,2 @@\n end\n+extra\n", out)
+	})
+
+	t.Run("MergedHunks", func(t *testing.T) {
+		_, out := diff(t, []string{"a", "b", "c", "d"}, []string{"A", "b", "c", "D"}, &Options{Context: 1})
+		assert.Equal(t, "@@ -1,4 +1,4 @@\n-a\n+A\n b\n c\n-d\n+D\n", out)
+	})
+
+	t.Run("EmptyLog", func(t *testing.T) {
+		d, out := diff(t, nil, []string{"a", "b"}, &Options{Context: 3})
+		assert.Equal(t, 2, d.Inserted)
+		assert.Equal(t, "@@ -0,0 +1,2 @@\n+a\n+b\n", out)
+	})
+
+	t.Run("RepeatedLines", func(t *testing.T) {
+		// No line is unique, the prefix and suffix still match
+		d, _ := diff(t, []string{"x", "x", "y", "x", "x"}, []string{"x", "x", "x", "x"}, &Options{})
+		assert.Equal(t, 1, d.Deleted)
+		assert.Equal(t, 0, d.Inserted)
+	})
+
+	t.Run("MovedBlock", func(t *testing.T) {
+		a := []string{"h", "1", "2", "3", "m", "4", "5", "t"}
+		b := []string{"h", "4", "5", "m", "1", "2", "3", "t"}
+		d, _ := diff(t, a, b, &Options{})
+		assert.Equal(t, d.Deleted, d.Inserted)
+		assert.LessOrEqual(t, d.Deleted, 5)
+	})
+
+	t.Run("IgnoreTimestamps", func(t *testing.T) {
+		d, out := diff(t,
+			[]string{"2025-01-02T15:04:05.123Z started", "[10:00:01] step 1", "done"},
+			[]string{"2025-03-04T08:00:00Z started", "[11:30:59] step 1", "failed"},
+			&Options{IgnoreTimestamps: true, Context: 3})
+		assert.Equal(t, 1, d.Deleted)
+		assert.Equal(t, "@@ -1,3 +1,3 @@\n 2025-01-02T15:04:05.123Z started\n [10:00:01] step 1\n-done\n+failed\n", out)
+	})
+
+	t.Run("IgnorePatterns", func(t *testing.T) {
+		d, _ := diff(t,
+			[]string{"request id=abc took 12ms", "ok"},
+			[]string{"request id=def took 15ms", "ok"},
+			&Options{Ignore: []*regexp.Regexp{regexp.MustCompile(`id=\w+`), regexp.MustCompile(`\d+ms`)}})
+		assert.Empty(t, d.Hunks)
+	})
+
+	t.Run("LargeLogs", func(t *testing.T) {
+		var a, b []string
+		for i := 0; i < 100000; i++ {
+			a = append(a, fmt.Sprintf("line %d", i))
+			if i%10000 != 0 {
+				b = append(b, fmt.Sprintf("line %d", i))
+			}
+		}
+		d, _ := diff(t, a, b, &Options{Context: 3})
+		assert.Equal(t, 10, d.Deleted)
+		assert.Equal(t, 0, d.Inserted)
+		assert.Len(t, d.Hunks, 10)
+	})
+}
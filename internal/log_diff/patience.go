@@ -0,0 +1,102 @@
+package logdiff
+
+import "sort"
+
+// past this depth, the lines left between two anchors are a single block
+const maxDepth = 32
+
+type pair struct {
+	x, y int
+}
+
+// diffLines appends the blocks of changed lines of x and y, offset by ox and oy, with a patience diff:
+// the lines found once in both are anchors, the longest sequence of anchors in the same order is kept
+// and extended to the equal lines around it, and the lines between two anchors are diffed the same way.
+// It runs in O(n log n) whatever the number of changes, its result is not always the shortest diff.
+func diffLines(x, y []uint64, ox, oy int, blocks []block, depth int) []block {
+	done := pair{}
+	for _, m := range anchors(x, y) {
+		if m.x < done.x || m.y < done.y {
+			// already part of the equal lines after the previous anchor
+			continue
+		}
+
+		start := m
+		for start.x > done.x && start.y > done.y && x[start.x-1] == y[start.y-1] {
+			start.x--
+			start.y--
+		}
+		end := m
+		for end.x < len(x) && end.y < len(y) && x[end.x] == y[end.y] {
+			end.x++
+			end.y++
+		}
+
+		if start.x > done.x || start.y > done.y {
+			dx, dy := start.x-done.x, start.y-done.y
+			if dx > 0 && dy > 0 && dx+dy < len(x)+len(y) && depth < maxDepth {
+				blocks = diffLines(x[done.x:start.x], y[done.y:start.y], ox+done.x, oy+done.y, blocks, depth+1)
+			} else {
+				blocks = append(blocks, block{a0: ox + done.x, a1: ox + start.x, b0: oy + done.y, b1: oy + start.y})
+			}
+		}
+		done = end
+	}
+	return blocks
+}
+
+// anchors returns the longest sequence of lines found once in x and once in y that are in the same order in both,
+// between the sentinels {0, 0} and {len(x), len(y)}
+func anchors(x, y []uint64) []pair {
+	// occurrences in x in the low bits and in y in the high bits, 2 means many
+	const once = 1 | 1<<2
+	counts := make(map[uint64]int)
+	for _, h := range x {
+		if c := counts[h]; c&3 < 2 {
+			counts[h] = c + 1
+		}
+	}
+	for _, h := range y {
+		if c := counts[h]; c>>2 < 2 {
+			counts[h] = c + 1<<2
+		}
+	}
+
+	yIndex := make(map[uint64]int)
+	for j, h := range y {
+		if counts[h] == once {
+			yIndex[h] = j
+		}
+	}
+	var unique []pair // in the order of x
+	for i, h := range x {
+		if counts[h] == once {
+			unique = append(unique, pair{i, yIndex[h]})
+		}
+	}
+
+	// Longest increasing subsequence of the y indexes, by patience sorting
+	var tails []int // tails[k] is the unique pair ending the best sequence of length k+1
+	prev := make([]int, len(unique))
+	for i, p := range unique {
+		k := sort.Search(len(tails), func(k int) bool { return unique[tails[k]].y >= p.y })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	seq := make([]pair, len(tails)+2)
+	seq[len(seq)-1] = pair{len(x), len(y)}
+	if len(tails) > 0 {
+		for k, i := len(tails), tails[len(tails)-1]; k > 0; k, i = k-1, prev[i] {
+			seq[k] = unique[i]
+		}
+	}
+	return seq
+}
@@ -0,0 +1,148 @@
+package logdiff
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+)
+
+type Op string
+
+const (
+	OpEqual  Op = " "
+	OpDelete Op = "-"
+	OpInsert Op = "+"
+)
+
+// Line is a line of a hunk, A is the line of the old log and B the line of the new log,
+// unchanged lines have both, they may differ by the ignored parts
+type Line struct {
+	Op Op
+	A  *logreader.Line
+	B  *logreader.Line
+}
+
+// Writer receives the hunks of a diff in order, each followed by its lines
+type Writer interface {
+	WriteHunk(hunk *Hunk) error
+	WriteLine(line *Line) error
+}
+
+var errStopped = errors.New("scan stopped")
+
+// Write reads the lines of the hunks from both logs, in a single pass over each of them
+func (d *Diff) Write(w Writer) error {
+	a := openCursor(d.scanner, d.A)
+	defer a.close()
+	b := openCursor(d.scanner, d.B)
+	defer b.close()
+
+	for _, hunk := range d.Hunks {
+		if err := w.WriteHunk(hunk); err != nil {
+			return err
+		}
+
+		ai, bi := hunk.AStart, hunk.BStart
+		for _, block := range hunk.blocks {
+			if err := writeEqual(w, a, b, ai, bi, block.a0-ai); err != nil {
+				return err
+			}
+			if err := writeChanged(w, a, OpDelete, block.a0, block.a1); err != nil {
+				return err
+			}
+			if err := writeChanged(w, b, OpInsert, block.b0, block.b1); err != nil {
+				return err
+			}
+			ai, bi = block.a1, block.b1
+		}
+		if err := writeEqual(w, a, b, ai, bi, hunk.AEnd-ai); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeEqual(w Writer, a, b *cursor, ai, bi, n int) error {
+	for i := 0; i < n; i++ {
+		lineA, err := a.line(ai + i)
+		if err != nil {
+			return err
+		}
+		lineB, err := b.line(bi + i)
+		if err != nil {
+			return err
+		}
+		if err := w.WriteLine(&Line{Op: OpEqual, A: lineA, B: lineB}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeChanged(w Writer, c *cursor, op Op, from, to int) error {
+	for i := from; i < to; i++ {
+		line, err := c.line(i)
+		if err != nil {
+			return err
+		}
+		diffLine := &Line{Op: op}
+		if op == OpDelete {
+			diffLine.A = line
+		} else {
+			diffLine.B = line
+		}
+		if err := w.WriteLine(diffLine); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cursor reads the lines of a log forward, on demand
+type cursor struct {
+	taskID uint64
+	next   func() (*logreader.Line, bool)
+	stop   func()
+	index  int // index of the next line
+	err    error
+}
+
+func openCursor(scanner Scanner, taskID uint64) *cursor {
+	c := &cursor{taskID: taskID}
+	c.next, c.stop = iter.Pull(func(yield func(*logreader.Line) bool) {
+		err := scanner.Scan(taskID, func(line *logreader.Line) error {
+			if !yield(line) {
+				return errStopped
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopped) && !errors.Is(err, os.ErrNotExist) {
+			c.err = err
+		}
+	})
+	return c
+}
+
+// line returns the line at index i, the lines before it are skipped
+func (c *cursor) line(i int) (*logreader.Line, error) {
+	for {
+		line, ok := c.next()
+		if !ok {
+			if c.err != nil {
+				return nil, fmt.Errorf("failed to read log of task #%d: %w", c.taskID, c.err)
+			}
+			return nil, fmt.Errorf("log of task #%d changed during the diff", c.taskID)
+		}
+		c.index++
+		if c.index > i {
+			return line, nil
+		}
+	}
+}
+
+func (c *cursor) close() {
+	c.stop()
+}
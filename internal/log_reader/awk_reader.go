@@ -3,7 +3,6 @@ package logreader
 import (
 	"fmt"
 	"os/exec"
-	"strings"
 
 	"github.com/fattymango/px-take-home/config"
 	"github.com/fattymango/px-take-home/pkg/logger"
@@ -43,7 +42,7 @@ func (l *AwkReader) Read(from, to int) ([]string, int, error) {
 
 	switch {
 	case from == 0 && to == 0: // Get last 100 lines
-		from = totalLines - 100
+		from = totalLines - 99
 		if from < 1 {
 			from = 1
 		}
@@ -58,10 +57,5 @@ func (l *AwkReader) Read(from, to int) ([]string, int, error) {
 		return nil, 0, fmt.Errorf("failed to read task logs: %w", err)
 	}
 
-	lines := strings.Split(string(output), "\n")
-	if len(lines) > 0 {
-		return lines[:len(lines)-1], totalLines, nil
-	}
-
-	return nil, 0, nil
+	return splitOutput(output), totalLines, nil
 }
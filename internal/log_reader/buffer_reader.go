@@ -2,6 +2,7 @@ package logreader
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 
@@ -24,16 +25,13 @@ func NewBufferReader(config *config.Config, logger *logger.Logger, taskID uint64
 }
 
 func (l *BufferReader) Read(from, to int) ([]string, int, error) {
-	filePath := FormatFileName(l.config.TaskLogger.DirPath, l.taskID)
-
-	// Check file exists
-	if !CheckFileExists(filePath) {
+	// The log file is decompressed transparently
+	file, err := OpenLog(NewFileSource(l.config.TaskLogger.DirPath), l.taskID)
+	if errors.Is(err, os.ErrNotExist) {
 		return nil, 0, nil
 	}
-
-	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to open task log file: %w", err)
+		return nil, 0, err
 	}
 	defer file.Close()
 
@@ -0,0 +1,183 @@
+package logreader
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var (
+	compressionExt = map[string]string{
+		CompressionGzip: ".gz",
+		CompressionZstd: ".zst",
+	}
+)
+
+// FormatCompressedFileName returns the name of the log file compressed with the given compression
+func FormatCompressedFileName(dirpath string, taskID uint64, compression string) string {
+	return FormatFileName(dirpath, taskID) + compressionExt[compression]
+}
+
+// FindLog returns the file name of the task log in the source and its compression, an empty compression means a plain file.
+// The plain file is preferred, it is only removed once the compressed file is complete.
+func FindLog(src Source, taskID uint64) (string, string, error) {
+	name := FormatFileName("", taskID)
+	if exists(src, name) {
+		return name, "", nil
+	}
+
+	for _, compression := range []string{CompressionGzip, CompressionZstd} {
+		name := FormatCompressedFileName("", taskID, compression)
+		if exists(src, name) {
+			return name, compression, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("log file of task #%d: %w", taskID, os.ErrNotExist)
+}
+
+// TaskFiles returns all the files of a task: the log file, compressed or not, and its sidecars.
+func TaskFiles(dirpath string, taskID uint64) ([]string, error) {
+	return filepath.Glob(filepath.Join(dirpath, fmt.Sprintf("%d.*", taskID)))
+}
+
+// OpenLog opens the task log, compressed logs are decompressed transparently.
+func OpenLog(src Source, taskID uint64) (io.ReadCloser, error) {
+	name, compression, err := FindLog(src, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := src.Open(name, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open task log file: %w", err)
+	}
+
+	reader, err := NewDecompressReader(compression, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+type decompressReader struct {
+	io.Reader
+	close func()
+	file  io.Closer
+}
+
+func (d *decompressReader) Close() error {
+	d.close()
+	return d.file.Close()
+}
+
+// NewDecompressReader wraps the file with a decompressor, the file is closed with the returned reader
+func NewDecompressReader(compression string, file io.ReadCloser) (io.ReadCloser, error) {
+	switch compression {
+	case "", CompressionNone:
+		return file, nil
+	case CompressionGzip:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return &decompressReader{Reader: gz, close: func() { gz.Close() }, file: file}, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		return &decompressReader{Reader: zr, close: zr.Close, file: file}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", compression)
+	}
+}
+
+// NewCompressWriter wraps w with a compressor, closing the returned writer does not close w
+func NewCompressWriter(compression string, w io.Writer) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", compression)
+	}
+}
+
+// resetWriter is a compressor that starts a new stream on another writer, gzip and zstd writers are
+type resetWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// countWriter counts the bytes written to w
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// CompressFrames compresses in to out as independent frames of FrameSize bytes, and writes the offset in out
+// of every frame to frames, see FormatFrameFileName. Concatenated frames are a valid gzip or zstd stream,
+// so the compressed log is still decompressed as a whole, and each frame from its offset.
+func CompressFrames(compression string, out, frames io.Writer, in io.Reader) error {
+	counter := &countWriter{w: out}
+	compressor, err := NewCompressWriter(compression, counter)
+	if err != nil {
+		return err
+	}
+	w, ok := compressor.(resetWriter)
+	if !ok {
+		return fmt.Errorf("compression %s can't be written in frames", compression)
+	}
+
+	buf := make([]byte, FrameSize)
+	offset := make([]byte, FrameOffsetSize)
+	for frame := 0; ; frame++ {
+		n, err := io.ReadFull(in, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read task log file: %w", err)
+		}
+		// An empty log is a single empty frame
+		if n == 0 && frame > 0 {
+			return nil
+		}
+
+		if frame > 0 {
+			w.Reset(counter)
+		}
+		binary.LittleEndian.PutUint64(offset, uint64(counter.n))
+		if _, err := frames.Write(offset); err != nil {
+			return fmt.Errorf("failed to write frame file: %w", err)
+		}
+		if _, err := w.Write(buf[:n]); err != nil {
+			return fmt.Errorf("failed to compress task log file: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to compress task log file: %w", err)
+		}
+
+		if n < FrameSize {
+			return nil
+		}
+	}
+}
@@ -3,7 +3,6 @@ package logreader
 import (
 	"fmt"
 	"os/exec"
-	"strings"
 
 	"github.com/fattymango/px-take-home/config"
 	"github.com/fattymango/px-take-home/pkg/logger"
@@ -62,7 +61,5 @@ func (l *TailHeadReader) Read(from, to int) ([]string, int, error) {
 		return nil, 0, fmt.Errorf("failed to read task logs: %w", err)
 	}
 
-	lines := strings.Split(string(output), "\n")
-
-	return lines, totalLines, nil
+	return splitOutput(output), totalLines, nil
 }
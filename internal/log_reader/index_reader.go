@@ -0,0 +1,98 @@
+package logreader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/pkg/logger"
+)
+
+// IndexReader reads a range of lines by jumping to the closest checkpoint of the index file,
+// so the cost depends on the size of the range and not on the size of the log.
+// Compressed logs are decompressed from the frame holding the checkpoint, at most FrameSize bytes before it.
+// The total number of lines comes from the stream file, the log is never counted.
+type IndexReader struct {
+	config *config.Config
+	logger *logger.Logger
+	source Source
+	taskID uint64
+}
+
+func NewIndexReader(config *config.Config, logger *logger.Logger, source Source, taskID uint64) Reader {
+	return &IndexReader{
+		config: config,
+		logger: logger,
+		source: source,
+		taskID: taskID,
+	}
+}
+
+// HasIndex reports whether the task log can be read with the IndexReader
+func HasIndex(src Source, taskID uint64) bool {
+	return exists(src, FormatIndexFileName("", taskID)) && exists(src, FormatStreamFileName("", taskID))
+}
+
+func (l *IndexReader) Read(from, to int) ([]string, int, error) {
+	totalLines, _, err := CountLines(l.source, l.taskID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch {
+	case from == 0 && to == 0: // Get last 100 lines
+		from, to = totalLines-99, totalLines
+	case from == 0:
+		from = to - 100
+	case to == 0:
+		to = from + 100
+	}
+	if from < 1 {
+		from = 1
+	}
+	if to > totalLines {
+		to = totalLines
+	}
+	if from > to {
+		return nil, totalLines, nil
+	}
+
+	line, offset, _, err := SearchCheckpoint(l.source, l.taskID, from)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reader, err := l.open(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+
+	buffered := bufio.NewReader(reader)
+	lines := make([]string, 0, to-from+1)
+	for ; line <= to; line++ {
+		text, err := buffered.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, 0, fmt.Errorf("failed to read task log file: %w", err)
+		}
+		if line >= from {
+			lines = append(lines, string(bytes.TrimSuffix(text, []byte{'\n'})))
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return lines, totalLines, nil
+}
+
+// open returns the log positioned at the given offset of the uncompressed log
+func (l *IndexReader) open(offset int64) (io.ReadCloser, error) {
+	name, compression, err := FindLog(l.source, l.taskID)
+	if err != nil {
+		return nil, err
+	}
+	return OpenAt(l.source, l.taskID, name, compression, offset)
+}
@@ -0,0 +1,29 @@
+package logreader
+
+// LineMap maps the lines of a log truncated to its max size to the lines of the output.
+// The log has the Head first lines of the output, a marker line in place of the Dropped next ones, then the kept tail.
+// Output lines are numbered as they were produced, the marker takes the number of the last dropped line.
+// The zero value maps every line to itself, like a log that isn't truncated.
+type LineMap struct {
+	Head    int
+	Dropped int
+}
+
+// Output returns the number in the output of a line of the log
+func (m LineMap) Output(line int) int {
+	if m.Dropped == 0 || line <= m.Head {
+		return line
+	}
+	return line + m.Dropped - 1
+}
+
+// Log returns the first line of the log at or after a line of the output, the marker for a dropped line
+func (m LineMap) Log(output int) int {
+	switch {
+	case m.Dropped == 0 || output <= m.Head:
+		return output
+	case output <= m.Head+m.Dropped:
+		return m.Head + 1
+	}
+	return output - m.Dropped + 1
+}
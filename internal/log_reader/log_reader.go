@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/model"
 	"github.com/fattymango/px-take-home/pkg/logger"
 )
 
@@ -16,6 +17,29 @@ const (
 	MaxFileSize = 1024 * 1024 // 1MB
 )
 
+// Line is a single line of a task log.
+// Stream and Time are 0 for lines written before they were recorded.
+type Line struct {
+	Number int
+	Stream model.LogStream
+	Time   int64 // unix nano
+	Text   string
+}
+
+// Filter selects the lines returned by LogReader.Read.
+type Filter struct {
+	// Line range, both 0 means the last 100 lines
+	From int
+	To   int
+	// Only lines of this stream, 0 means all streams
+	Stream model.LogStream
+	// Only lines captured in this time range (unix nano, inclusive), 0 means unbounded
+	Since int64
+	Until int64
+	// At most Limit lines of the time range, the last ones when only Until is set, 0 means unbounded
+	Limit int
+}
+
 // Reader is an interface for reading file logs.
 type Reader interface {
 	Read(from, to int) ([]string, int, error)
@@ -24,24 +48,141 @@ type Reader interface {
 type LogReader struct {
 	config *config.Config
 	logger *logger.Logger
+	source Source
 }
 
-func NewLogReader(config *config.Config, logger *logger.Logger) *LogReader {
+// NewLogReader returns a reader of the task logs of the source, only a FileSource of the task logs directory
+// can read logs written before the index existed.
+func NewLogReader(config *config.Config, logger *logger.Logger, source Source) *LogReader {
 	return &LogReader{
 		config: config,
 		logger: logger,
+		source: source,
+	}
+}
+
+// Read reads the log file from the given task ID and returns the lines selected by the filter.
+// The time range is resolved to a line range first, the stream is filtered within the line range.
+func (l *LogReader) Read(taskID uint64, filter *Filter) ([]*Line, int, error) {
+	from, to := filter.From, filter.To
+	if filter.Since != 0 || filter.Until != 0 {
+		var total int
+		var err error
+		from, to, total, err = l.timeRange(taskID, filter)
+		if err != nil {
+			return nil, 0, err
+		}
+		if from > to {
+			return nil, total, nil
+		}
+	}
+
+	output, totalLines, err := l.readText(taskID, from, to)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(output) == 0 {
+		return nil, totalLines, nil
+	}
+
+	first := from
+	if from == 0 && to == 0 {
+		first = totalLines - len(output) + 1
+	}
+	if first < 1 {
+		first = 1
+	}
+
+	streams, err := ReadStreams(l.source, taskID, first, len(output))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	timestamps, err := ReadTimestamps(l.source, taskID, first, len(output))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	lines := make([]*Line, 0, len(output))
+	for i, text := range output {
+		if filter.Stream != 0 && streams[i] != filter.Stream {
+			continue
+		}
+		lines = append(lines, &Line{Number: first + i, Stream: streams[i], Time: timestamps[i], Text: text})
+	}
+
+	return lines, totalLines, nil
+}
+
+// timeRange returns the line range captured between filter.Since and filter.Until,
+// intersected with the filter line range if set and cut to filter.Limit lines, and the number of lines with a timestamp.
+func (l *LogReader) timeRange(taskID uint64, filter *Filter) (int, int, int, error) {
+	from, total, err := SearchTimestamp(l.source, taskID, filter.Since)
+	if err != nil {
+		return 0, 0, 0, err
 	}
+
+	to := total
+	if filter.Until != 0 {
+		next, _, err := SearchTimestamp(l.source, taskID, filter.Until+1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		to = next - 1
+	}
+
+	if filter.From != 0 && filter.From > from {
+		from = filter.From
+	}
+	if filter.To != 0 && filter.To < to {
+		to = filter.To
+	}
+
+	if filter.Limit > 0 && to-from+1 > filter.Limit {
+		if filter.Since == 0 {
+			from = to - filter.Limit + 1
+		} else {
+			to = from + filter.Limit - 1
+		}
+	}
+
+	return from, to, total, nil
 }
 
-// Read reads the log file from the given task ID and returns the lines in the range of from and to.
-// It uses different readers based on the file size and the range of lines to read.
-func (l *LogReader) Read(taskID uint64, from, to int) ([]string, int, error) {
+// readText uses the index when the log has one, logs written before the index existed are read in process by the
+// NativeReader, or with sed and tail based on the file size and the range of lines when the exec reader is configured.
+func (l *LogReader) readText(taskID uint64, from, to int) ([]string, int, error) {
 	var reader Reader
-	var output []string
-	var err error
-	var totalLines int
 
-	fileSize, err := GetFileSize(FormatFileName(l.config.TaskLogger.DirPath, taskID))
+	name, compression, err := FindLog(l.source, taskID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("file does not exist: %w", err)
+	}
+
+	if HasIndex(l.source, taskID) {
+		l.logger.Info("using index reader")
+		return NewIndexReader(l.config, l.logger, l.source, taskID).Read(from, to)
+	}
+
+	if compression == "" && l.config.TaskLogger.Reader != ReaderExec {
+		l.logger.Info("using native reader")
+		return NewNativeReader(l.config, l.logger, l.source, taskID).Read(from, to)
+	}
+
+	// The readers below read the task logs directory
+	if _, ok := l.source.(*FileSource); !ok {
+		return nil, 0, fmt.Errorf("log of task #%d has no index", taskID)
+	}
+	path := filepath.Join(l.config.TaskLogger.DirPath, name)
+
+	if compression != "" {
+		// Compressed logs can only be read by decompressing them in process
+		l.logger.Infof("log file is compressed with %s, using buffer reader", compression)
+		return NewBufferReader(l.config, l.logger, taskID).Read(from, to)
+	}
+
+	fileSize, err := GetFileSize(path)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -61,16 +202,7 @@ func (l *LogReader) Read(taskID uint64, from, to int) ([]string, int, error) {
 		}
 	}
 
-	output, totalLines, err = reader.Read(from, to)
-
-	if err != nil {
-		return nil, 0, err
-	}
-
-	if len(output) > 0 {
-		return output[:len(output)-1], totalLines, nil
-	}
-	return nil, 0, nil
+	return reader.Read(from, to)
 }
 
 func FormatFileName(dirpath string, taskID uint64) string {
@@ -88,6 +220,15 @@ func GetFileSize(filename string) (int64, error) {
 	}
 	return info.Size(), nil
 }
+
+// splitOutput splits the output of a command printing whole lines
+func splitOutput(output []byte) []string {
+	if len(output) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+}
+
 func getTotalLines(filename string) (int, error) {
 	cmd := exec.Command("wc", "-l", filename)
 	output, err := cmd.Output()
@@ -0,0 +1,260 @@
+package logreader
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/pkg/logger"
+)
+
+const (
+	ReaderNative = "native"
+	ReaderExec   = "exec"
+
+	// size of the read buffer, and of the chunks read backwards from the end of the file by the tail
+	readBufSize = 64 * 1024
+)
+
+// NativeReader reads a plain log file without index in process through the source, the tail reads chunks backwards
+// from the end of the file and ranges are read with a buffered forward scan that stops parsing lines after the range.
+// The total number of lines comes from the stream file, or from the last checkpoint of the index file,
+// the log is only counted when it has neither.
+// A last line without a trailing newline is a line, like for the BufferReader.
+type NativeReader struct {
+	config *config.Config
+	logger *logger.Logger
+	source Source
+	taskID uint64
+}
+
+func NewNativeReader(config *config.Config, logger *logger.Logger, source Source, taskID uint64) Reader {
+	return &NativeReader{
+		config: config,
+		logger: logger,
+		source: source,
+		taskID: taskID,
+	}
+}
+
+func (l *NativeReader) Read(from, to int) ([]string, int, error) {
+	name := FormatFileName("", l.taskID)
+	size, err := l.source.Size(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to stat task log file: %w", err)
+	}
+
+	if from == 0 && to == 0 { // Get last 100 lines
+		return l.tail(name, size, 100)
+	}
+
+	switch {
+	case from == 0:
+		from = to - 100
+	case to == 0:
+		to = from + 100
+	}
+	if from < 1 {
+		from = 1
+	}
+
+	return l.scan(name, from, to)
+}
+
+// scan returns the lines in [from, to] and the total number of lines, it starts from the closest checkpoint
+// of the index file if the log has one
+func (l *NativeReader) scan(name string, from, to int) ([]string, int, error) {
+	line, offset, _, err := SearchCheckpoint(l.source, l.taskID, from)
+	if err != nil {
+		return nil, 0, err
+	}
+	totalLines := max(line-1, 0)
+
+	file, err := l.source.Open(name, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open task log file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, readBufSize)
+	var lines []string
+
+	// Lines before the range are skipped without copying them
+	for totalLines < from-1 {
+		text, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if len(text) > 0 {
+			totalLines++
+		}
+		if err == io.EOF {
+			return nil, totalLines, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read task log file: %w", err)
+		}
+	}
+
+	for totalLines < to {
+		text, err := reader.ReadBytes('\n')
+		if len(text) > 0 {
+			totalLines++
+			if totalLines >= from {
+				lines = append(lines, string(bytes.TrimSuffix(text, []byte{'\n'})))
+			}
+		}
+		if err == io.EOF {
+			return lines, totalLines, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read task log file: %w", err)
+		}
+	}
+
+	count, ok, err := CountLines(l.source, l.taskID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if ok {
+		return lines, max(count, totalLines), nil
+	}
+	rest, err := countLines(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	return lines, totalLines + rest, nil
+}
+
+// tail returns the last n lines, reading chunks backwards from the end of the file, and the total number of lines
+func (l *NativeReader) tail(name string, size int64, n int) ([]string, int, error) {
+	if size == 0 {
+		return nil, 0, nil
+	}
+
+	// The newline ending the last line does not start a line
+	end := size
+	last := make([]byte, 1)
+	if _, err := l.source.ReadAt(name, last, size-1); err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("failed to read task log file: %w", err)
+	}
+	if last[0] == '\n' {
+		end--
+	}
+
+	// Chunks are collected from the last one and joined once, newlines are counted as they are read
+	var chunks [][]byte
+	off, start := end, int64(0)
+	newlines := 0
+	for off > 0 {
+		next := max(off-readBufSize, 0)
+		chunk := make([]byte, off-next)
+		if _, err := l.source.ReadAt(name, chunk, next); err != nil && err != io.EOF {
+			return nil, 0, fmt.Errorf("failed to read task log file: %w", err)
+		}
+		chunks = append(chunks, chunk)
+		off = next
+
+		count := bytes.Count(chunk, []byte{'\n'})
+		if newlines+count >= n {
+			start = off + int64(nthLastIndex(chunk, '\n', n-newlines)) + 1
+			break
+		}
+		newlines += count
+	}
+
+	slices.Reverse(chunks)
+	buf := bytes.Join(chunks, nil)
+	parts := bytes.Split(buf[start-off:], []byte{'\n'})
+	lines := make([]string, len(parts))
+	for i, part := range parts {
+		lines[i] = string(part)
+	}
+
+	total, err := l.countTail(name, buf, off, start, len(lines))
+	if err != nil {
+		return nil, 0, err
+	}
+	return lines, total, nil
+}
+
+// countTail returns the total number of lines of a log whose last tailLines lines start at the byte offset start,
+// buf holds the bytes of the log from off. Only the lines before the tail and after the last checkpoint are read.
+func (l *NativeReader) countTail(name string, buf []byte, off, start int64, tailLines int) (int, error) {
+	count, ok, err := CountLines(l.source, l.taskID)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return max(count, tailLines), nil
+	}
+
+	// From the last checkpoint when the log has an index file, from the start of the log otherwise
+	line, offset, _, err := SearchCheckpoint(l.source, l.taskID, math.MaxInt32)
+	if err != nil {
+		return 0, err
+	}
+	before := max(line-1, 0)
+	if offset >= start {
+		// The checkpoint is one of the tail lines
+		return before + tailLines - bytes.Count(buf[start-off:min(offset-off, int64(len(buf)))], []byte{'\n'}), nil
+	}
+
+	file, err := l.source.Open(name, offset)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open task log file: %w", err)
+	}
+	defer file.Close()
+
+	count, err = countLines(io.LimitReader(file, start-offset))
+	if err != nil {
+		return 0, err
+	}
+	return before + count + tailLines, nil
+}
+
+// nthLastIndex returns the index of the n-th last occurrence of sep in b, -1 if b has less
+func nthLastIndex(b []byte, sep byte, n int) int {
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] == sep {
+			n--
+			if n == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// countLines counts the lines of r, a last line without a trailing newline included
+func countLines(r io.Reader) (int, error) {
+	buf := make([]byte, readBufSize)
+	count := 0
+	last := byte('\n')
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			count += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to count task log lines: %w", err)
+		}
+	}
+	if last != '\n' {
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,278 @@
+package logreader
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position between two lines of a log: Line is the number of the line after it and Offset the byte offset
+// of that line in the uncompressed log, -1 if unknown. Lines are only appended to a log, so a cursor stays valid
+// while the log grows. Forward pages start at the cursor, backward pages end before it.
+type Cursor struct {
+	Line     int
+	Offset   int64
+	Backward bool
+}
+
+// Range returns the lines [first, last] of the page of the cursor in a log of total lines, last < first for an empty page
+func (c *Cursor) Range(total, limit int) (int, int) {
+	if c.Backward {
+		return max(c.Line-limit, 1), c.Line - 1
+	}
+	return c.Line, min(c.Line+limit-1, total)
+}
+
+// Validate checks that the cursor is within a log of total lines
+func (c *Cursor) Validate(total int) error {
+	if c.Line < 1 || c.Line > total+1 {
+		return fmt.Errorf("%w: line %d is not in the log", ErrInvalidCursor, c.Line)
+	}
+	return nil
+}
+
+// Page is a page of lines read from a cursor. Next reads the lines after the page, Prev the lines before it,
+// it is nil at the start of the log. At the end of a growing log, Next returns the lines written since.
+type Page struct {
+	Lines []*Line
+	Total int // complete lines of the log when the page was read
+	Next  *Cursor
+	Prev  *Cursor
+}
+
+// Page reads up to limit lines from the cursor, a nil cursor reads the last lines of the log.
+// Only complete lines are returned, a line still being written is returned once it ends.
+// A forward cursor with an offset is read from it directly, other pages are read from the closest checkpoint of the index.
+func (l *LogReader) Page(taskID uint64, cursor *Cursor, limit int) (*Page, error) {
+	name, compression, err := FindLog(l.source, taskID)
+	if errors.Is(err, os.ErrNotExist) {
+		if cursor != nil && cursor.Line > 1 {
+			return nil, fmt.Errorf("%w: task #%d has no log", ErrInvalidCursor, taskID)
+		}
+		return &Page{Next: &Cursor{Line: 1, Offset: 0}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := l.completeLines(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if cursor == nil {
+		cursor = &Cursor{Line: total + 1, Offset: -1, Backward: true}
+	}
+	if err := cursor.Validate(total); err != nil {
+		return nil, err
+	}
+	first, last := cursor.Range(total, limit)
+
+	// Lines are read from startLine at startOffset
+	startLine, startOffset := 1, int64(0)
+	if !cursor.Backward && cursor.Offset >= 0 {
+		if err := l.checkOffset(taskID, name, compression, cursor); err != nil {
+			return nil, err
+		}
+		startLine, startOffset = cursor.Line, cursor.Offset
+	} else {
+		line, offset, ok, err := SearchCheckpoint(l.source, taskID, first)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			startLine, startOffset = line, offset
+		}
+	}
+
+	reader, err := OpenAt(l.source, taskID, name, compression, startOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	buffered := bufio.NewReaderSize(reader, readBufSize)
+	offset, firstOffset := startOffset, startOffset
+	var texts []string
+	for line := startLine; line <= max(last, first-1); line++ {
+		if line == first {
+			firstOffset = offset
+		}
+		if line > last {
+			break
+		}
+
+		text, err := buffered.ReadBytes('\n')
+		if err == io.EOF {
+			// The log is shorter than its sidecars, e.g. the last line is not flushed yet
+			last = line - 1
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read task log file: %w", err)
+		}
+		offset += int64(len(text))
+		if line >= first {
+			texts = append(texts, string(bytes.TrimSuffix(text, []byte{'\n'})))
+		}
+	}
+	if last < first {
+		firstOffset = offset
+	}
+
+	// A backward cursor with an offset must end where the page ends
+	if cursor.Backward && cursor.Offset >= 0 && offset != cursor.Offset && len(texts) == cursor.Line-first {
+		return nil, fmt.Errorf("%w: offset %d is not the start of line %d", ErrInvalidCursor, cursor.Offset, cursor.Line)
+	}
+
+	lines, err := l.withSidecars(taskID, first, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Lines: lines, Total: total, Next: &Cursor{Line: first + len(texts), Offset: offset}}
+	if first > 1 {
+		page.Prev = &Cursor{Line: first, Offset: firstOffset, Backward: true}
+	}
+	return page, nil
+}
+
+// completeLines returns the number of complete lines of the log, from the stream file if the log has one
+func (l *LogReader) completeLines(taskID uint64) (int, error) {
+	total, ok, err := CountLines(l.source, taskID)
+	if err != nil || ok {
+		return total, err
+	}
+
+	reader, err := OpenLog(l.source, taskID)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	buf := make([]byte, readBufSize)
+	for {
+		n, err := reader.Read(buf)
+		total += bytes.Count(buf[:n], []byte{'\n'})
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to count task log lines: %w", err)
+		}
+	}
+}
+
+// checkOffset checks that the offset of a forward cursor can be the start of its line: it is after the checkpoint
+// of the line and, in a plain log, right after a new line
+func (l *LogReader) checkOffset(taskID uint64, name, compression string, cursor *Cursor) error {
+	invalid := fmt.Errorf("%w: offset %d is not the start of line %d", ErrInvalidCursor, cursor.Offset, cursor.Line)
+
+	line, offset, ok, err := SearchCheckpoint(l.source, taskID, cursor.Line)
+	if err != nil {
+		return err
+	}
+	if ok && (offset > cursor.Offset || (line == cursor.Line && offset != cursor.Offset)) {
+		return invalid
+	}
+	if (cursor.Line == 1) != (cursor.Offset == 0) {
+		return invalid
+	}
+
+	if compression == "" && cursor.Offset > 0 {
+		b := make([]byte, 1)
+		if _, err := l.source.ReadAt(name, b, cursor.Offset-1); err != nil {
+			if err == io.EOF {
+				return invalid
+			}
+			return fmt.Errorf("failed to read task log file: %w", err)
+		}
+		if b[0] != '\n' {
+			return invalid
+		}
+	}
+	return nil
+}
+
+// withSidecars returns the lines numbered from first with their stream and capture time
+func (l *LogReader) withSidecars(taskID uint64, first int, texts []string) ([]*Line, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	streams, err := ReadStreams(l.source, taskID, first, len(texts))
+	if err != nil {
+		return nil, err
+	}
+	timestamps, err := ReadTimestamps(l.source, taskID, first, len(texts))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]*Line, len(texts))
+	for i, text := range texts {
+		lines[i] = &Line{Number: first + i, Stream: streams[i], Time: timestamps[i], Text: text}
+	}
+	return lines, nil
+}
+
+// OpenAt returns the log found by FindLog positioned at the given offset of the uncompressed log.
+// Compressed logs are decompressed from the start of the frame holding the offset, logs compressed before
+// frames were written are decompressed from their start, past the end they are at their end.
+func OpenAt(src Source, taskID uint64, name, compression string, offset int64) (io.ReadCloser, error) {
+	if compression == "" {
+		file, err := src.Open(name, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open task log file: %w", err)
+		}
+		return file, nil
+	}
+
+	start, frameOffset, _, err := SearchFrame(src, taskID, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := src.Open(name, frameOffset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open task log file: %w", err)
+	}
+	reader, err := NewDecompressReader(compression, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if _, err := io.CopyN(io.Discard, reader, offset-start); err != nil && err != io.EOF {
+		reader.Close()
+		return nil, fmt.Errorf("failed to skip to offset %d of task log file: %w", offset, err)
+	}
+	return reader, nil
+}
+
+// DecompressedSize returns the size of a compressed log once decompressed, the start of its last frame plus the
+// size of that frame, so only the last frame is decompressed. It returns false if the log has no frame file.
+func DecompressedSize(src Source, taskID uint64, name, compression string) (int64, bool, error) {
+	start, _, ok, err := SearchFrame(src, taskID, math.MaxInt64)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	reader, err := OpenAt(src, taskID, name, compression, start)
+	if err != nil {
+		return 0, false, err
+	}
+	defer reader.Close()
+
+	n, err := io.Copy(io.Discard, reader)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read task log file: %w", err)
+	}
+	return start + n, true, nil
+}
@@ -1,14 +1,18 @@
 package logreader
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/model"
 	"github.com/fattymango/px-take-home/pkg/logger"
+	"github.com/stretchr/testify/assert"
 )
 
 const (
@@ -40,23 +44,35 @@ func setupBenchmark(b *testing.B) {
 
 	testLogger = logger.NewTestLogger()
 
-	logFile := filepath.Join(tempDir, fmt.Sprintf("%d.log", testTaskID))
-	f, err := os.Create(logFile)
-	if err != nil {
-		b.Fatalf("Failed to create test file: %v", err)
-	}
-	defer f.Close()
-
 	padding := make([]byte, lineSize)
 	for i := range padding {
 		padding[i] = 'x'
 	}
-	for i := 0; i < numLines; i++ {
-		_, err := fmt.Fprintf(f, "Test log line %d with additional padding: %s\n", i, padding)
-		if err != nil {
-			b.Fatalf("Failed to write test data: %v", err)
+	if err := writeTestLog(tempDir, testTaskID, numLines, func(i int) string {
+		return fmt.Sprintf("Test log line %d with additional padding: %s", i, padding)
+	}); err != nil {
+		b.Fatalf("Failed to write test data: %v", err)
+	}
+}
+
+// writeTestLog writes a log file with its stream and index sidecars, like the task logger does
+func writeTestLog(dir string, taskID uint64, lines int, line func(i int) string) error {
+	var log, streams, index []byte
+	for i := 0; i < lines; i++ {
+		if i%IndexInterval == 0 {
+			index = binary.LittleEndian.AppendUint64(index, uint64(len(log)))
 		}
+		log = append(log, line(i)+"\n"...)
+		streams = append(streams, byte(model.LogStream_Stdout))
+	}
+
+	if err := os.WriteFile(FormatFileName(dir, taskID), log, 0644); err != nil {
+		return err
 	}
+	if err := os.WriteFile(FormatStreamFileName(dir, taskID), streams, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(FormatIndexFileName(dir, taskID), index, 0644)
 }
 
 func cleanupBenchmark() {
@@ -126,3 +142,267 @@ func BenchmarkBufferReader(b *testing.B) {
 	reader := NewBufferReader(testConfig, testLogger, testTaskID)
 	runReaderBenchmark(b, reader)
 }
+
+func BenchmarkNativeReader(b *testing.B) {
+	setupBenchmark(b)
+	defer cleanupBenchmark()
+	reader := NewNativeReader(testConfig, testLogger, NewFileSource(tempDir), testTaskID)
+	runReaderBenchmark(b, reader)
+}
+
+func BenchmarkIndexReader(b *testing.B) {
+	setupBenchmark(b)
+	defer cleanupBenchmark()
+	reader := NewIndexReader(testConfig, testLogger, NewFileSource(tempDir), testTaskID)
+	runReaderBenchmark(b, reader)
+}
+
+// testReader checks the range semantics shared by the readers on a log of 1000 lines
+func testReader(t *testing.T, reader Reader) {
+	const lines = 1000
+
+	// Ranges around checkpoints
+	for _, r := range []struct{ from, to int }{{1, 1}, {63, 66}, {64, 65}, {65, 129}, {900, 1000}} {
+		output, total, err := reader.Read(r.from, r.to)
+		assert.NoError(t, err)
+		assert.Equal(t, lines, total)
+		assert.Len(t, output, r.to-r.from+1)
+		assert.Equal(t, fmt.Sprintf("line %d", r.from), output[0])
+		assert.Equal(t, fmt.Sprintf("line %d", r.to), output[len(output)-1])
+	}
+
+	// Last 100 lines
+	output, total, err := reader.Read(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, lines, total)
+	assert.Len(t, output, 100)
+	assert.Equal(t, "line 901", output[0])
+	assert.Equal(t, "line 1000", output[99])
+
+	// Past the end
+	output, _, err = reader.Read(990, 1200)
+	assert.NoError(t, err)
+	assert.Len(t, output, 11)
+}
+
+func TestIndexReader(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{TaskLogger: config.TaskLogger{DirPath: dir}}
+
+	err := writeTestLog(dir, testTaskID, 1000, func(i int) string { return fmt.Sprintf("line %d", i+1) })
+	assert.NoError(t, err)
+
+	testReader(t, NewIndexReader(cfg, logger.NewTestLogger(), NewFileSource(dir), testTaskID))
+}
+
+func TestIndexReader_Frames(t *testing.T) {
+	for _, compression := range []string{CompressionGzip, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.Config{TaskLogger: config.TaskLogger{DirPath: dir}}
+			line := func(i int) string { return fmt.Sprintf("line %d %s", i+1, strings.Repeat("x", 40)) }
+			// About 3 frames
+			const lines = 60000
+			assert.NoError(t, writeTestLog(dir, testTaskID, lines, line))
+
+			log, err := os.ReadFile(FormatFileName(dir, testTaskID))
+			assert.NoError(t, err)
+			out, err := os.Create(FormatCompressedFileName(dir, testTaskID, compression))
+			assert.NoError(t, err)
+			frames, err := os.Create(FormatFrameFileName(dir, testTaskID))
+			assert.NoError(t, err)
+			assert.NoError(t, CompressFrames(compression, out, frames, strings.NewReader(string(log))))
+			assert.NoError(t, out.Close())
+			assert.NoError(t, frames.Close())
+			assert.NoError(t, os.Remove(FormatFileName(dir, testTaskID)))
+
+			// The frames are a single stream for readers of the whole log
+			reader, err := OpenLog(NewFileSource(dir), testTaskID)
+			assert.NoError(t, err)
+			content, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.NoError(t, reader.Close())
+			assert.Equal(t, log, content)
+
+			// A range is read from the frame holding it
+			start, offset, ok, err := SearchFrame(NewFileSource(dir), testTaskID, int64(len(log)-1))
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, int64(2*FrameSize), start)
+			assert.Greater(t, offset, int64(0))
+
+			// The size is taken from the last frame
+			size, ok, err := DecompressedSize(NewFileSource(dir), testTaskID, FormatCompressedFileName("", testTaskID, compression), compression)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, int64(len(log)), size)
+
+			output, total, err := NewIndexReader(cfg, logger.NewTestLogger(), NewFileSource(dir), testTaskID).Read(lines-1, lines)
+			assert.NoError(t, err)
+			assert.Equal(t, lines, total)
+			assert.Equal(t, []string{line(lines - 2), line(lines - 1)}, output)
+
+			// A range across two frames
+			first := strings.Count(string(log[:FrameSize]), "\n") - 4
+			output, _, err = NewIndexReader(cfg, logger.NewTestLogger(), NewFileSource(dir), testTaskID).Read(first, first+10)
+			assert.NoError(t, err)
+			assert.Len(t, output, 11)
+			assert.Equal(t, line(first-1), output[0])
+			assert.Equal(t, line(first+9), output[10])
+		})
+	}
+}
+
+func TestNativeReader(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{TaskLogger: config.TaskLogger{DirPath: dir}}
+	reader := NewNativeReader(cfg, logger.NewTestLogger(), NewFileSource(dir), testTaskID)
+
+	err := writeTestLog(dir, testTaskID, 1000, func(i int) string { return fmt.Sprintf("line %d", i+1) })
+	assert.NoError(t, err)
+
+	// The count is taken from the stream file, then from the last checkpoint, then by reading the whole log
+	testReader(t, reader)
+	assert.NoError(t, os.Remove(FormatStreamFileName(dir, testTaskID)))
+	testReader(t, reader)
+	assert.NoError(t, os.Remove(FormatIndexFileName(dir, testTaskID)))
+	testReader(t, reader)
+
+	write := func(content string) {
+		assert.NoError(t, os.WriteFile(FormatFileName(dir, testTaskID), []byte(content), 0644))
+	}
+
+	// A last line without newline and empty lines are lines
+	write("a\n\nb")
+	output, total, err := reader.Read(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []string{"a", "", "b"}, output)
+	output, total, err = reader.Read(2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []string{"", "b"}, output)
+
+	// The tail reads back across chunks
+	long := strings.Repeat("x", readBufSize)
+	write("first\n" + long + "\n" + long + "\nlast\n")
+	output, total, err = reader.Read(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []string{"first", long, long, "last"}, output)
+
+	write("")
+	output, total, err = reader.Read(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, output)
+}
+
+func TestExecReaders(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{TaskLogger: config.TaskLogger{DirPath: dir}}
+
+	err := writeTestLog(dir, testTaskID, 1000, func(i int) string { return fmt.Sprintf("line %d", i+1) })
+	assert.NoError(t, err)
+
+	t.Run("Sed", func(t *testing.T) { testReader(t, NewSedReader(cfg, logger.NewTestLogger(), testTaskID)) })
+	t.Run("Awk", func(t *testing.T) { testReader(t, NewAwkReader(cfg, logger.NewTestLogger(), testTaskID)) })
+	t.Run("TailHead", func(t *testing.T) { testReader(t, NewTailHeadReader(cfg, logger.NewTestLogger(), testTaskID)) })
+}
+
+// Logs without index keep their last line, whatever the reader
+func TestLogReader_NoIndex(t *testing.T) {
+	for _, name := range []string{ReaderNative, ReaderExec} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.Config{TaskLogger: config.TaskLogger{DirPath: dir, Reader: name}}
+			assert.NoError(t, os.WriteFile(FormatFileName(dir, testTaskID), []byte("a\nb\nc\n"), 0644))
+
+			reader := NewLogReader(cfg, logger.NewTestLogger(), NewFileSource(dir))
+			for _, filter := range []*Filter{{}, {From: 1, To: 3}} {
+				lines, total, err := reader.Read(testTaskID, filter)
+				assert.NoError(t, err)
+				assert.Equal(t, 3, total)
+				if assert.Len(t, lines, 3) {
+					assert.Equal(t, "c", lines[2].Text)
+					assert.Equal(t, 3, lines[2].Number)
+				}
+			}
+		})
+	}
+}
+
+func TestLogReader_Page(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{TaskLogger: config.TaskLogger{DirPath: dir}}
+	line := func(i int) string { return fmt.Sprintf("line %d", i+1) }
+	assert.NoError(t, writeTestLog(dir, testTaskID, 150, line))
+	reader := NewLogReader(cfg, logger.NewTestLogger(), NewFileSource(dir))
+
+	texts := func(page *Page) []string {
+		var texts []string
+		for _, l := range page.Lines {
+			texts = append(texts, l.Text)
+		}
+		return texts
+	}
+
+	// The tail, then backward to the start of the log
+	page, err := reader.Page(testTaskID, nil, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 150, page.Total)
+	assert.Equal(t, "line 51", page.Lines[0].Text)
+	assert.Equal(t, 51, page.Lines[0].Number)
+	prev := page.Prev
+	page, err = reader.Page(testTaskID, prev, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"line 1", "line 50"}, []string{texts(page)[0], texts(page)[49]})
+	assert.Nil(t, page.Prev)
+
+	// Forward from the start with the offsets of the pages
+	page, err = reader.Page(testTaskID, &Cursor{Line: 1, Offset: 0}, 100)
+	assert.NoError(t, err)
+	assert.Len(t, page.Lines, 100)
+	next := page.Next
+	assert.Equal(t, 101, next.Line)
+	page, err = reader.Page(testTaskID, next, 100)
+	assert.NoError(t, err)
+	assert.Len(t, page.Lines, 50)
+	assert.Equal(t, "line 101", page.Lines[0].Text)
+
+	// The log grows, the cursor at its end returns the new lines
+	end := page.Next
+	assert.NoError(t, writeTestLog(dir, testTaskID, 160, line))
+	page, err = reader.Page(testTaskID, end, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"line 151", "line 152"}, texts(page)[:2])
+	assert.Len(t, page.Lines, 10)
+
+	t.Run("InvalidCursor", func(t *testing.T) {
+		for _, cursor := range []*Cursor{{Line: 0, Offset: -1}, {Line: 200, Offset: -1}, {Line: 101, Offset: next.Offset + 1}, {Line: 2, Offset: 0}} {
+			_, err := reader.Page(testTaskID, cursor, 100)
+			assert.ErrorIs(t, err, ErrInvalidCursor, "%+v", cursor)
+		}
+	})
+
+	t.Run("Compressed", func(t *testing.T) {
+		log, err := os.ReadFile(FormatFileName(dir, testTaskID))
+		assert.NoError(t, err)
+		file, err := os.Create(FormatCompressedFileName(dir, testTaskID, CompressionGzip))
+		assert.NoError(t, err)
+		w, err := NewCompressWriter(CompressionGzip, file)
+		assert.NoError(t, err)
+		_, err = w.Write(log)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		assert.NoError(t, file.Close())
+		assert.NoError(t, os.Remove(FormatFileName(dir, testTaskID)))
+
+		page, err := reader.Page(testTaskID, next, 100)
+		assert.NoError(t, err)
+		assert.Len(t, page.Lines, 60)
+		assert.Equal(t, "line 101", page.Lines[0].Text)
+		assert.Equal(t, "line 151", page.Lines[50].Text)
+		assert.Equal(t, int64(len(log)), page.Next.Offset)
+	})
+}
@@ -0,0 +1,85 @@
+package logreader
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fattymango/px-take-home/model"
+)
+
+// ScanLines calls fn for every line of the log in order, with its stream and capture time, until fn returns an error.
+// The log and its sidecars are read sequentially, so the whole log is never held in memory.
+// A last line without a new line, still being written by a running task, is not returned.
+func ScanLines(src Source, taskID uint64, fn func(line *Line) error) error {
+	log, err := OpenLog(src, taskID)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	streams, err := openSidecar(src, FormatStreamFileName("", taskID))
+	if err != nil {
+		return err
+	}
+	if streams != nil {
+		defer streams.Close()
+	}
+
+	timestamps, err := openSidecar(src, FormatTimestampFileName("", taskID))
+	if err != nil {
+		return err
+	}
+	if timestamps != nil {
+		defer timestamps.Close()
+	}
+
+	reader := bufio.NewReaderSize(log, 64*1024)
+	ts := make([]byte, TimestampSize)
+	for number := 1; ; number++ {
+		text, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read task log: %w", err)
+		}
+
+		line := &Line{Number: number, Text: strings.TrimSuffix(text, "\n")}
+		if streams != nil {
+			if b, err := streams.ReadByte(); err == nil {
+				line.Stream = model.LogStream(b)
+			}
+		}
+		if timestamps != nil {
+			if _, err := io.ReadFull(timestamps, ts); err == nil {
+				line.Time = int64(binary.LittleEndian.Uint64(ts))
+			}
+		}
+
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+}
+
+type sidecarReader struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// openSidecar opens a sidecar for sequential reads, it returns nil if the sidecar does not exist
+func openSidecar(src Source, name string) (*sidecarReader, error) {
+	file, err := src.Open(name, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sidecar file: %w", err)
+	}
+	return &sidecarReader{Reader: bufio.NewReader(file), Closer: file}, nil
+}
@@ -3,7 +3,6 @@ package logreader
 import (
 	"fmt"
 	"os/exec"
-	"strings"
 
 	"github.com/fattymango/px-take-home/config"
 	"github.com/fattymango/px-take-home/pkg/logger"
@@ -43,7 +42,7 @@ func (l *SedReader) Read(from, to int) ([]string, int, error) {
 
 	switch {
 	case from == 0 && to == 0: // Get last 100 lines
-		from = totalLines - 100
+		from = max(totalLines-99, 1)
 		to = totalLines
 		cmd = exec.Command("sed", "-n", fmt.Sprintf("%d,%dp", from, to), file)
 
@@ -56,13 +55,5 @@ func (l *SedReader) Read(from, to int) ([]string, int, error) {
 		return nil, 0, fmt.Errorf("failed to read task logs: %w", err)
 	}
 
-	lines := strings.Split(string(output), "\n")
-
-	for _, line := range lines {
-		if trimmed := strings.TrimSpace(line); trimmed != "" {
-			result = append(result, trimmed)
-		}
-	}
-
-	return result, totalLines, nil
+	return splitOutput(output), totalLines, nil
 }
@@ -0,0 +1,193 @@
+package logreader
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fattymango/px-take-home/model"
+)
+
+const (
+	TimestampSize = 8 // bytes per line in the timestamp file
+
+	IndexInterval  = 64 // lines between two checkpoints of the index file
+	CheckpointSize = 8  // bytes per checkpoint in the index file
+
+	FrameSize       = 1024 * 1024 // bytes of the uncompressed log per frame of a compressed log
+	FrameOffsetSize = 8           // bytes per frame in the frame file
+)
+
+// FormatStreamFileName returns the sidecar file holding the stream of every log line, one byte per line.
+func FormatStreamFileName(dirpath string, taskID uint64) string {
+	return filepath.Join(dirpath, fmt.Sprintf("%d.stream", taskID))
+}
+
+// FormatTimestampFileName returns the sidecar file holding the capture time of every log line,
+// 8 bytes (little endian unix nano) per line.
+func FormatTimestampFileName(dirpath string, taskID uint64) string {
+	return filepath.Join(dirpath, fmt.Sprintf("%d.ts", taskID))
+}
+
+// FormatIndexFileName returns the sidecar file holding the byte offset of every IndexInterval-th line,
+// starting with line 1, 8 bytes (little endian) per checkpoint. Offsets are in the uncompressed log.
+func FormatIndexFileName(dirpath string, taskID uint64) string {
+	return filepath.Join(dirpath, fmt.Sprintf("%d.idx", taskID))
+}
+
+// FormatFrameFileName returns the sidecar file of a compressed log holding the offset in the compressed log of every
+// frame, 8 bytes (little endian) per frame. Frame i holds the bytes of the uncompressed log from i*FrameSize and
+// is decompressed on its own.
+func FormatFrameFileName(dirpath string, taskID uint64) string {
+	return filepath.Join(dirpath, fmt.Sprintf("%d.frames", taskID))
+}
+
+// CountLines returns the number of lines of the log from the size of the stream file, without reading the log.
+// The stream file is flushed after the log file, so every counted line is complete in the log.
+// It returns false if the task has no stream file, e.g. logs written before streams were recorded.
+func CountLines(src Source, taskID uint64) (int, bool, error) {
+	size, err := src.Size(FormatStreamFileName("", taskID))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to stat stream file: %w", err)
+	}
+	return int(size), true, nil
+}
+
+// SearchCheckpoint returns the closest checkpointed line at or before line (1-based) and its byte offset.
+// Checkpoints are written after the log lines, a line past the last flushed checkpoint gets the last one.
+// It returns false if the task has no index file.
+func SearchCheckpoint(src Source, taskID uint64, line int) (int, int64, bool, error) {
+	name := FormatIndexFileName("", taskID)
+	size, err := src.Size(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to stat index file: %w", err)
+	}
+
+	checkpoints := int(size / CheckpointSize)
+	if checkpoints == 0 {
+		return 1, 0, true, nil
+	}
+
+	checkpoint := min((line-1)/IndexInterval, checkpoints-1)
+	buf := make([]byte, CheckpointSize)
+	if _, err := src.ReadAt(name, buf, int64(checkpoint)*CheckpointSize); err != nil && err != io.EOF {
+		return 0, 0, false, fmt.Errorf("failed to read index file: %w", err)
+	}
+
+	return checkpoint*IndexInterval + 1, int64(binary.LittleEndian.Uint64(buf)), true, nil
+}
+
+// SearchFrame returns the frame of a compressed log holding the given offset of the uncompressed log,
+// as the offset of its first byte in the uncompressed log and its offset in the compressed log.
+// It returns false if the log has no frame file, e.g. logs compressed before frames were written.
+func SearchFrame(src Source, taskID uint64, offset int64) (int64, int64, bool, error) {
+	name := FormatFrameFileName("", taskID)
+	size, err := src.Size(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to stat frame file: %w", err)
+	}
+
+	frames := size / FrameOffsetSize
+	if frames == 0 {
+		return 0, 0, false, nil
+	}
+
+	frame := min(offset/FrameSize, frames-1)
+	buf := make([]byte, FrameOffsetSize)
+	if _, err := src.ReadAt(name, buf, frame*FrameOffsetSize); err != nil && err != io.EOF {
+		return 0, 0, false, fmt.Errorf("failed to read frame file: %w", err)
+	}
+
+	return frame * FrameSize, int64(binary.LittleEndian.Uint64(buf)), true, nil
+}
+
+// readSidecar reads count records of the given size starting at line from (1-based),
+// it returns the number of complete records read, 0 if the sidecar does not exist.
+func readSidecar(src Source, name string, size, from, count int) ([]byte, int, error) {
+	buf := make([]byte, count*size)
+
+	n, err := src.ReadAt(name, buf, int64(from-1)*int64(size))
+	if errors.Is(err, os.ErrNotExist) {
+		return buf, 0, nil
+	}
+	if err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("failed to read sidecar file: %w", err)
+	}
+
+	return buf, n / size, nil
+}
+
+// ReadStreams returns the stream of count lines starting at line from (1-based).
+// Lines without a recorded stream, e.g. logs written before streams were recorded, are returned as 0.
+func ReadStreams(src Source, taskID uint64, from, count int) ([]model.LogStream, error) {
+	buf, n, err := readSidecar(src, FormatStreamFileName("", taskID), 1, from, count)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make([]model.LogStream, count)
+	for i := 0; i < n; i++ {
+		streams[i] = model.LogStream(buf[i])
+	}
+
+	return streams, nil
+}
+
+// ReadTimestamps returns the capture time (unix nano) of count lines starting at line from (1-based).
+// Lines without a recorded timestamp are returned as 0.
+func ReadTimestamps(src Source, taskID uint64, from, count int) ([]int64, error) {
+	buf, n, err := readSidecar(src, FormatTimestampFileName("", taskID), TimestampSize, from, count)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamps := make([]int64, count)
+	for i := 0; i < n; i++ {
+		timestamps[i] = int64(binary.LittleEndian.Uint64(buf[i*TimestampSize:]))
+	}
+
+	return timestamps, nil
+}
+
+// SearchTimestamp returns the first line (1-based) captured at or after ts, and the number of lines with a timestamp.
+// Lines are written in capture order, so the timestamp file is sorted and can be binary searched.
+// If every line is older than ts, total+1 is returned.
+func SearchTimestamp(src Source, taskID uint64, ts int64) (int, int, error) {
+	name := FormatTimestampFileName("", taskID)
+	size, err := src.Size(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return 1, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat timestamp file: %w", err)
+	}
+	total := int(size / TimestampSize)
+
+	var searchErr error
+	buf := make([]byte, TimestampSize)
+	idx := sort.Search(total, func(i int) bool {
+		if _, err := src.ReadAt(name, buf, int64(i)*TimestampSize); err != nil && err != io.EOF {
+			searchErr = err
+			return true
+		}
+		return int64(binary.LittleEndian.Uint64(buf)) >= ts
+	})
+	if searchErr != nil {
+		return 0, 0, fmt.Errorf("failed to read timestamp file: %w", searchErr)
+	}
+
+	return idx + 1, total, nil
+}
@@ -0,0 +1,68 @@
+package logreader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Source gives access to the log file and the sidecars of tasks by file name, e.g. "12.log" or "12.stream".
+// FileSource reads them from the task logs directory, a remote log store provides its own source.
+type Source interface {
+	// Size returns the size of a file, the error wraps os.ErrNotExist if the file does not exist
+	Size(name string) (int64, error)
+	// ReadAt reads len(p) bytes of a file at off, like io.ReaderAt
+	ReadAt(name string, p []byte, off int64) (int, error)
+	// Open opens a file positioned at off
+	Open(name string, off int64) (io.ReadCloser, error)
+}
+
+// FileSource reads task log files from a local directory
+type FileSource struct {
+	dirpath string
+}
+
+func NewFileSource(dirpath string) *FileSource {
+	return &FileSource{dirpath: dirpath}
+}
+
+func (s *FileSource) Size(name string) (int64, error) {
+	info, err := os.Stat(filepath.Join(s.dirpath, name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (s *FileSource) ReadAt(name string, p []byte, off int64) (int, error) {
+	file, err := os.Open(filepath.Join(s.dirpath, name))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return file.ReadAt(p, off)
+}
+
+func (s *FileSource) Open(name string, off int64) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(s.dirpath, name))
+	if err != nil {
+		return nil, err
+	}
+	if off == 0 {
+		return file, nil
+	}
+
+	if _, err := file.Seek(off, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek %s: %w", name, err)
+	}
+	return file, nil
+}
+
+// exists reports whether the source has the file
+func exists(src Source, name string) bool {
+	_, err := src.Size(name)
+	return err == nil
+}
@@ -0,0 +1,163 @@
+package logsearch
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/model"
+)
+
+const (
+	MaxPatternLength = 1024
+	MaxContext       = 10
+
+	// lines scanned between two checks of the context
+	checkInterval = 1024
+)
+
+// Scanner reads every line of a task log in order, like logstore.LogStore.Scan
+type Scanner interface {
+	Scan(taskID uint64, fn func(line *logreader.Line) error) error
+}
+
+// Query selects the lines to return, a line matches if the pattern is found anywhere in it
+type Query struct {
+	Pattern    string
+	Regex      bool // the pattern is a regular expression (RE2 syntax), otherwise plain text
+	IgnoreCase bool
+	// Lines returned before and after every match
+	Context int
+	// Only lines of this stream match, 0 means all streams. Context lines are returned from every stream.
+	Stream model.LogStream
+	// Page of matches to return
+	Offset int
+	Limit  int
+}
+
+// Match is a matching line with its context, Highlights are the [start, end) rune offsets of the matches in the line
+type Match struct {
+	Line       *logreader.Line
+	Highlights [][2]int
+	Before     []*logreader.Line
+	After      []*logreader.Line
+}
+
+type Result struct {
+	Matches      []*Match
+	TotalMatches int // matching lines in the whole log
+	TotalLines   int
+}
+
+// Matcher finds a plain text or regex pattern in lines
+type Matcher struct {
+	re *regexp.Regexp
+}
+
+func NewMatcher(pattern string, isRegex, ignoreCase bool) (*Matcher, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("pattern is required")
+	}
+	if len(pattern) > MaxPatternLength {
+		return nil, fmt.Errorf("pattern is longer than %d bytes", MaxPatternLength)
+	}
+
+	if !isRegex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	return &Matcher{re: re}, nil
+}
+
+func (m *Matcher) MatchString(text string) bool {
+	return m.re.MatchString(text)
+}
+
+// Highlights returns the [start, end) rune offsets of the non empty matches in text
+func (m *Matcher) Highlights(text string) [][2]int {
+	var highlights [][2]int
+	runes, last := 0, 0
+	for _, loc := range m.re.FindAllStringIndex(text, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		runes += utf8.RuneCountInString(text[last:loc[0]])
+		start := runes
+		runes += utf8.RuneCountInString(text[loc[0]:loc[1]])
+		last = loc[1]
+		highlights = append(highlights, [2]int{start, runes})
+	}
+	return highlights
+}
+
+// Search scans the whole log of a task and returns the requested page of matches, with their context.
+// Matches close to each other share context lines, each match carries its own copy.
+func Search(ctx context.Context, scanner Scanner, taskID uint64, query *Query) (*Result, error) {
+	matcher, err := NewMatcher(query.Pattern, query.Regex, query.IgnoreCase)
+	if err != nil {
+		return nil, err
+	}
+	return SearchWith(ctx, scanner, taskID, matcher, query)
+}
+
+// SearchWith is Search with a compiled matcher, so a query run on many logs is compiled once
+func SearchWith(ctx context.Context, scanner Scanner, taskID uint64, matcher *Matcher, query *Query) (*Result, error) {
+	result := &Result{}
+	before := make([]*logreader.Line, 0, query.Context) // last lines, for the context before a match
+	var open []*Match                                   // matches of the page still collecting their context after
+
+	err := scanner.Scan(taskID, func(line *logreader.Line) error {
+		if line.Number%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		result.TotalLines = line.Number
+
+		still := open[:0]
+		for _, match := range open {
+			match.After = append(match.After, line)
+			if len(match.After) < query.Context {
+				still = append(still, match)
+			}
+		}
+		open = still
+
+		if (query.Stream == 0 || line.Stream == query.Stream) && matcher.MatchString(line.Text) {
+			if result.TotalMatches >= query.Offset && len(result.Matches) < query.Limit {
+				match := &Match{
+					Line:       line,
+					Highlights: matcher.Highlights(line.Text),
+					Before:     append([]*logreader.Line(nil), before...),
+				}
+				result.Matches = append(result.Matches, match)
+				if query.Context > 0 {
+					open = append(open, match)
+				}
+			}
+			result.TotalMatches++
+		}
+
+		if query.Context > 0 {
+			if len(before) == query.Context {
+				before = append(before[:0], before[1:]...)
+			}
+			before = append(before, line)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search log of task #%d: %w", taskID, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package logsearch
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeScanner []string
+
+func (f fakeScanner) Scan(taskID uint64, fn func(line *logreader.Line) error) error {
+	for i, text := range f {
+		stream := model.LogStream_Stdout
+		if i%2 == 1 {
+			stream = model.LogStream_Stderr
+		}
+		if err := fn(&logreader.Line{Number: i + 1, Stream: stream, Text: text}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func numbers(lines []*logreader.Line) []int {
+	out := make([]int, len(lines))
+	for i, line := range lines {
+		out[i] = line.Number
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	log := fakeScanner{"start", "ERROR one", "ok", "ok", "error two", "ok", "Error three", "end"}
+
+	t.Run("PlainIgnoreCase", func(t *testing.T) {
+		result, err := Search(context.Background(), log, 1, &Query{Pattern: "error", IgnoreCase: true, Context: 1, Limit: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, result.TotalMatches)
+		assert.Equal(t, 8, result.TotalLines)
+		assert.Equal(t, 2, result.Matches[0].Line.Number)
+		assert.Equal(t, []int{1}, numbers(result.Matches[0].Before))
+		assert.Equal(t, []int{3}, numbers(result.Matches[0].After))
+		assert.Equal(t, [][2]int{{0, 5}}, result.Matches[0].Highlights)
+		assert.Equal(t, []int{8}, numbers(result.Matches[2].After))
+	})
+
+	t.Run("CaseSensitive", func(t *testing.T) {
+		result, err := Search(context.Background(), log, 1, &Query{Pattern: "error", Limit: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result.TotalMatches)
+		assert.Equal(t, 5, result.Matches[0].Line.Number)
+	})
+
+	t.Run("RegexPage", func(t *testing.T) {
+		result, err := Search(context.Background(), log, 1, &Query{Pattern: `(?i)^error \w+$`, Regex: true, Offset: 1, Limit: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, result.TotalMatches)
+		assert.Len(t, result.Matches, 1)
+		assert.Equal(t, 5, result.Matches[0].Line.Number)
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		result, err := Search(context.Background(), log, 1, &Query{Pattern: "ok", Stream: model.LogStream_Stderr, Limit: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, result.TotalMatches)
+	})
+
+	t.Run("InvalidRegex", func(t *testing.T) {
+		_, err := Search(context.Background(), log, 1, &Query{Pattern: "(", Regex: true, Limit: 10})
+		assert.Error(t, err)
+	})
+}
+
+func TestMatcher_Highlights(t *testing.T) {
+	// Offsets are in runes, not bytes
+	matcher, err := NewMatcher("ü", false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{1, 2}, {4, 5}}, matcher.Highlights("aübcü"))
+
+	matcher, err = NewMatcher("x*", true, false)
+	assert.NoError(t, err)
+	assert.True(t, matcher.MatchString("abc"))
+	assert.Empty(t, matcher.Highlights("abc"))
+}
+
+func TestSearch_Canceled(t *testing.T) {
+	log := make(fakeScanner, checkInterval*2)
+	for i := range log {
+		log[i] = fmt.Sprintf("line %d", i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Search(ctx, log, 1, &Query{Pattern: "line", Limit: 10})
+	assert.ErrorIs(t, err, context.Canceled)
+}
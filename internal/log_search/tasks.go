@@ -0,0 +1,97 @@
+package logsearch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+)
+
+// TaskResult is the search result of the log of a task
+type TaskResult struct {
+	TaskID uint64
+	*Result
+}
+
+type TasksResult struct {
+	Tasks    []*TaskResult // tasks with at least a match, in the order of the searched tasks
+	Searched int           // tasks whose log was searched completely, tasks without log included
+	Complete bool          // every task was searched, false if the context ended first
+}
+
+// Pool bounds the number of logs searched at the same time, it is shared by the searches of the server
+// so concurrent requests can't scan more logs at once than configured.
+type Pool struct {
+	slots chan struct{}
+}
+
+func NewPool(size int) *Pool {
+	return &Pool{slots: make(chan struct{}, max(size, 1))}
+}
+
+// SearchTasks runs the query on the log of every task, the matcher is compiled once for all of them.
+// Once the context ends, the search stops and the result holds the tasks searched so far.
+func (p *Pool) SearchTasks(ctx context.Context, scanner Scanner, taskIDs []uint64, matcher *Matcher, query *Query) (*TasksResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*Result, len(taskIDs))
+	searched := make([]bool, len(taskIDs))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var searchErr error
+
+loop:
+	for i, taskID := range taskIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+
+		wg.Add(1)
+		go func(i int, taskID uint64) {
+			defer wg.Done()
+			defer func() { <-p.slots }()
+
+			result, err := SearchWith(ctx, scanner, taskID, matcher, query)
+			switch {
+			case err == nil:
+				results[i], searched[i] = result, true
+			case errors.Is(err, os.ErrNotExist):
+				searched[i] = true
+			case ctx.Err() != nil:
+				// stopped before the end of the log
+			default:
+				mu.Lock()
+				if searchErr == nil {
+					searchErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}(i, taskID)
+	}
+	wg.Wait()
+
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	out := &TasksResult{Complete: true}
+	for i, taskID := range taskIDs {
+		if !searched[i] {
+			out.Complete = false
+			continue
+		}
+		out.Searched++
+		if results[i] != nil && results[i].TotalMatches > 0 {
+			out.Tasks = append(out.Tasks, &TaskResult{TaskID: taskID, Result: results[i]})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,81 @@
+package logsearch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTasks holds the logs of many tasks and records the number of logs scanned at the same time
+type fakeTasks struct {
+	logs    map[uint64]fakeScanner
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (f *fakeTasks) Scan(taskID uint64, fn func(line *logreader.Line) error) error {
+	log, ok := f.logs[taskID]
+	if !ok {
+		return fmt.Errorf("log file of task #%d: %w", taskID, os.ErrNotExist)
+	}
+
+	running := f.running.Add(1)
+	defer f.running.Add(-1)
+	for {
+		peak := f.peak.Load()
+		if running <= peak || f.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	return log.Scan(taskID, fn)
+}
+
+func TestPool_SearchTasks(t *testing.T) {
+	tasks := &fakeTasks{logs: map[uint64]fakeScanner{}}
+	taskIDs := []uint64{}
+	for id := uint64(1); id <= 20; id++ {
+		taskIDs = append(taskIDs, id)
+		if id == 7 {
+			continue // no log
+		}
+		tasks.logs[id] = fakeScanner{"start", "ok", "end"}
+		if id%5 == 0 {
+			tasks.logs[id] = fakeScanner{"start", "connection refused", "retry", "connection refused"}
+		}
+	}
+
+	matcher, err := NewMatcher("Connection Refused", false, true)
+	assert.NoError(t, err)
+
+	pool := NewPool(3)
+	result, err := pool.SearchTasks(context.Background(), tasks, taskIDs, matcher, &Query{Limit: 1})
+	assert.NoError(t, err)
+	assert.True(t, result.Complete)
+	assert.Equal(t, 20, result.Searched)
+	assert.LessOrEqual(t, tasks.peak.Load(), int32(3))
+
+	ids := []uint64{}
+	for _, task := range result.Tasks {
+		ids = append(ids, task.TaskID)
+		assert.Equal(t, 2, task.TotalMatches)
+		assert.Len(t, task.Matches, 1)
+		assert.Equal(t, 2, task.Matches[0].Line.Number)
+	}
+	assert.Equal(t, []uint64{5, 10, 15, 20}, ids)
+
+	// Stopped searches return the tasks searched so far
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err = pool.SearchTasks(ctx, tasks, taskIDs, matcher, &Query{Limit: 1})
+	assert.NoError(t, err)
+	assert.False(t, result.Complete)
+	assert.Equal(t, 0, result.Searched)
+}
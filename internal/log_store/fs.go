@@ -0,0 +1,366 @@
+package logstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fattymango/px-take-home/config"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/logger"
+)
+
+// FileStore keeps task logs in the task logs directory, the log file is plain text and the metadata of every line
+// is written to sidecar files:
+//   - <id>.stream: the stream of every line, one byte per line
+//   - <id>.ts: the time every line was captured, 8 bytes (little endian unix nano) per line
+//   - <id>.idx: the byte offset of every logreader.IndexInterval-th line, so ranges are read without scanning the log
+//
+// Finished logs are compressed if configured, the sidecars are kept as is so they stay seekable.
+type FileStore struct {
+	config *config.Config
+	logger *logger.Logger
+
+	dirpath string
+	source  *logreader.FileSource
+	reader  *logreader.LogReader
+}
+
+func NewFileStore(config *config.Config, logger *logger.Logger) *FileStore {
+	return newFileStore(config, logger, config.TaskLogger.DirPath)
+}
+
+func newFileStore(config *config.Config, logger *logger.Logger, dirpath string) *FileStore {
+	source := logreader.NewFileSource(dirpath)
+	return &FileStore{
+		config:  config,
+		logger:  logger,
+		dirpath: dirpath,
+		source:  source,
+		reader:  logreader.NewLogReader(config, logger, source),
+	}
+}
+
+func (s *FileStore) Create(taskID uint64) (Writer, error) {
+	if err := os.MkdirAll(s.dirpath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create task log directory: %w", err)
+	}
+
+	logFile, err := os.Create(logreader.FormatFileName(s.dirpath, taskID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create task log file: %w", err)
+	}
+
+	streams, err := createSidecar(logreader.FormatStreamFileName(s.dirpath, taskID))
+	if err != nil {
+		logFile.Close()
+		return nil, fmt.Errorf("failed to create task stream file: %w", err)
+	}
+
+	timestamps, err := createSidecar(logreader.FormatTimestampFileName(s.dirpath, taskID))
+	if err != nil {
+		logFile.Close()
+		streams.close()
+		return nil, fmt.Errorf("failed to create task timestamp file: %w", err)
+	}
+
+	index, err := createSidecar(logreader.FormatIndexFileName(s.dirpath, taskID))
+	if err != nil {
+		logFile.Close()
+		streams.close()
+		timestamps.close()
+		return nil, fmt.Errorf("failed to create task index file: %w", err)
+	}
+
+	return &fileWriter{
+		logFile:    logFile,
+		buffer:     bufio.NewWriterSize(logFile, MAX_BUF_SIZE),
+		streams:    streams,
+		timestamps: timestamps,
+		index:      index,
+	}, nil
+}
+
+// Finalize replaces the log file with a compressed copy written in frames, so ranges of lines are read without
+// decompressing the log from its start. The plain file is only removed once the compressed one is complete,
+// readers always find one of them.
+func (s *FileStore) Finalize(taskID uint64) error {
+	compression := s.config.TaskLogger.Compression
+	if compression == "" || compression == logreader.CompressionNone {
+		return nil
+	}
+
+	src := logreader.FormatFileName(s.dirpath, taskID)
+	dst := logreader.FormatCompressedFileName(s.dirpath, taskID, compression)
+	tmp := dst + ".tmp"
+	framesDst := logreader.FormatFrameFileName(s.dirpath, taskID)
+	framesTmp := framesDst + ".tmp"
+
+	in, err := os.Open(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open task log file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create compressed task log file: %w", err)
+	}
+
+	frames, err := os.Create(framesTmp)
+	if err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to create frame file: %w", err)
+	}
+
+	if err := logreader.CompressFrames(compression, out, frames, in); err != nil {
+		out.Close()
+		frames.Close()
+		os.Remove(tmp)
+		os.Remove(framesTmp)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		frames.Close()
+		os.Remove(tmp)
+		os.Remove(framesTmp)
+		return fmt.Errorf("failed to close compressed task log file: %w", err)
+	}
+
+	// The frames are in place before the compressed log, a reader never finds the log without them
+	if err := frames.Close(); err != nil {
+		os.Remove(tmp)
+		os.Remove(framesTmp)
+		return fmt.Errorf("failed to close frame file: %w", err)
+	}
+	if err := os.Rename(framesTmp, framesDst); err != nil {
+		os.Remove(tmp)
+		os.Remove(framesTmp)
+		return fmt.Errorf("failed to rename frame file: %w", err)
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rename compressed task log file: %w", err)
+	}
+
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("failed to remove task log file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) Read(taskID uint64, filter *logreader.Filter) ([]*logreader.Line, int, error) {
+	return s.reader.Read(taskID, filter)
+}
+
+func (s *FileStore) Page(taskID uint64, cursor *logreader.Cursor, limit int) (*logreader.Page, error) {
+	return s.reader.Page(taskID, cursor, limit)
+}
+
+func (s *FileStore) Tail(taskID uint64, n int) ([]*logreader.Line, int, error) {
+	return tail(s.reader, s.source, taskID, n)
+}
+
+func (s *FileStore) Scan(taskID uint64, fn func(line *logreader.Line) error) error {
+	return logreader.ScanLines(s.source, taskID, fn)
+}
+
+func (s *FileStore) Open(taskID uint64, acceptGzip bool, offset int64) (*Download, error) {
+	return openLog(s.source, taskID, acceptGzip, offset)
+}
+
+// openLog opens the log of the source from offset, gzip logs are sent as is to clients that accept it.
+// Plain and gzip logs sent as is are read from offset directly and have a known size, a plain log being written
+// is cut after its last complete line. Decompressed logs are read from the frame holding offset, their size is
+// taken from their last frame, it is unknown for logs compressed before frames were written.
+func openLog(src logreader.Source, taskID uint64, acceptGzip bool, offset int64) (*Download, error) {
+	name, compression, err := logreader.FindLog(src, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if compression == "" || (compression == logreader.CompressionGzip && acceptGzip) {
+		size, err := src.Size(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get task log file size: %w", err)
+		}
+		if compression == "" {
+			if size, err = lastLineEnd(src, name, size); err != nil {
+				return nil, err
+			}
+		}
+		offset = min(offset, size)
+
+		file, err := src.Open(name, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open task log file: %w", err)
+		}
+
+		download := &Download{ReadCloser: newLimitReadCloser(file, size-offset), Size: size}
+		if compression != "" {
+			download.Encoding = "gzip"
+		}
+		return download, nil
+	}
+
+	size, ok, err := logreader.DecompressedSize(src, taskID, name, compression)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		size = -1
+	}
+
+	reader, err := logreader.OpenAt(src, taskID, name, compression, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &Download{ReadCloser: reader, Size: size}, nil
+}
+
+// lastLineEnd returns the size of the file up to the end of its last complete line, the log of a running task
+// may end with part of a line. Lines are looked for in the last readBufSize bytes, longer lines are kept as is.
+func lastLineEnd(src logreader.Source, name string, size int64) (int64, error) {
+	const readBufSize = 64 * 1024
+
+	off := max(size-readBufSize, 0)
+	buf := make([]byte, size-off)
+	n, err := src.ReadAt(name, buf, off)
+	if err != nil && err != io.EOF {
+		return 0, fmt.Errorf("failed to read task log file: %w", err)
+	}
+
+	if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+		return off + int64(i) + 1, nil
+	}
+	return size, nil
+}
+
+func (s *FileStore) Size(taskID uint64) (int64, error) {
+	files, err := logreader.TaskFiles(s.dirpath, taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+func (s *FileStore) Delete(taskID uint64) error {
+	files, err := logreader.TaskFiles(s.dirpath, taskID)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// sidecar is a fixed width per line metadata file written next to the log file
+type sidecar struct {
+	file   *os.File
+	buffer *bufio.Writer
+}
+
+func createSidecar(path string) (*sidecar, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &sidecar{file: file, buffer: bufio.NewWriterSize(file, MAX_BUF_SIZE)}, nil
+}
+
+func (s *sidecar) close() error {
+	if err := s.buffer.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+type fileWriter struct {
+	logFile *os.File
+	buffer  *bufio.Writer
+
+	streams    *sidecar
+	timestamps *sidecar
+	index      *sidecar
+
+	lines   int   // lines written to the log file
+	written int64 // bytes written to the log file
+}
+
+func (w *fileWriter) Write(stream model.LogStream, ts int64, line []byte) error {
+	// Sidecars must never get ahead of the log file, flush everything in order before a sidecar buffer fills up
+	if w.streams.buffer.Available() < 1 || w.timestamps.buffer.Available() < logreader.TimestampSize || w.index.buffer.Available() < logreader.CheckpointSize {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	offset := w.written
+	if _, err := w.buffer.Write(line); err != nil {
+		return err
+	}
+	w.written += int64(len(line))
+
+	if w.lines%logreader.IndexInterval == 0 {
+		if _, err := w.index.buffer.Write(binary.LittleEndian.AppendUint64(nil, uint64(offset))); err != nil {
+			return err
+		}
+	}
+	w.lines++
+
+	if err := w.streams.buffer.WriteByte(byte(stream)); err != nil {
+		return err
+	}
+	_, err := w.timestamps.buffer.Write(binary.LittleEndian.AppendUint64(nil, uint64(ts)))
+	return err
+}
+
+// Flush flushes the log file before the sidecars, so readers never see metadata for lines that are not written yet
+func (w *fileWriter) Flush() error {
+	if err := w.buffer.Flush(); err != nil {
+		return err
+	}
+	if err := w.streams.buffer.Flush(); err != nil {
+		return err
+	}
+	if err := w.timestamps.buffer.Flush(); err != nil {
+		return err
+	}
+	return w.index.buffer.Flush()
+}
+
+func (w *fileWriter) Close() error {
+	w.Flush()
+	w.streams.close()
+	w.timestamps.close()
+	w.index.close()
+	return w.logFile.Close()
+}
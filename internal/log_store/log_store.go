@@ -0,0 +1,114 @@
+package logstore
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fattymango/px-take-home/config"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/db"
+	"github.com/fattymango/px-take-home/pkg/logger"
+)
+
+const (
+	BackendFS  = "fs"
+	BackendSQL = "sql"
+	BackendS3  = "s3"
+
+	MAX_BUF_SIZE = 4096 // Max buffer capacity of the log writers, if this is exceeded, the buffer will be flushed
+)
+
+// LogStore stores the output of tasks. Lines are appended while the task runs, the log is finalized once
+// the task reaches a terminal state, and can then be read by range, tailed or downloaded.
+type LogStore interface {
+	// Create starts the log of a task, lines are appended through the returned writer
+	Create(taskID uint64) (Writer, error)
+	// Finalize is called once the writer of a finished task is closed, e.g. to compress or upload the log
+	Finalize(taskID uint64) error
+	// Read returns the lines selected by the filter and the total number of lines
+	Read(taskID uint64, filter *logreader.Filter) ([]*logreader.Line, int, error)
+	// Page returns up to limit lines from the cursor, a nil cursor returns the last lines,
+	// the error wraps logreader.ErrInvalidCursor if the cursor is not a position of the log
+	Page(taskID uint64, cursor *logreader.Cursor, limit int) (*logreader.Page, error)
+	// Tail returns the last n lines and the total number of lines
+	Tail(taskID uint64, n int) ([]*logreader.Line, int, error)
+	// Scan calls fn for every line in order until fn returns an error, which is returned by Scan
+	Scan(taskID uint64, fn func(line *logreader.Line) error) error
+	// Open returns the log as text from the byte offset of the downloaded content,
+	// the error wraps os.ErrNotExist if the task has no log
+	Open(taskID uint64, acceptGzip bool, offset int64) (*Download, error)
+	// Size returns the bytes used by the log of a task
+	Size(taskID uint64) (int64, error)
+	// Delete removes the log of a task
+	Delete(taskID uint64) error
+}
+
+// Writer appends the lines of a running task, writes are buffered until Flush
+type Writer interface {
+	// Write appends a line of the given stream captured at ts (unix nano), the line must end with a new line
+	Write(stream model.LogStream, ts int64, line []byte) error
+	Flush() error
+	Close() error
+}
+
+// Download is the log of a task from the requested offset
+type Download struct {
+	io.ReadCloser
+	// Content encoding of the reader, gzip if the log is stored gzip compressed and the caller accepts it, empty for plain text
+	Encoding string
+	// Size of the whole content in this encoding, -1 if it is only known by reading it, e.g. a log compressed without frames
+	Size int64
+}
+
+// limitReadCloser reads at most n bytes of the underlying reader
+type limitReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func newLimitReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	return &limitReadCloser{Reader: io.LimitReader(rc, n), Closer: rc}
+}
+
+// skip discards the first n bytes of a reader whose content can't be seeked
+func skip(rc io.ReadCloser, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	if _, err := io.CopyN(io.Discard, rc, n); err != nil && err != io.EOF {
+		rc.Close()
+		return fmt.Errorf("failed to read task log: %w", err)
+	}
+	return nil
+}
+
+// NewLogStore returns the log store of the configured backend
+func NewLogStore(config *config.Config, logger *logger.Logger, db *db.DB) (LogStore, error) {
+	switch config.LogStore.Backend {
+	case BackendFS, "":
+		return NewFileStore(config, logger), nil
+	case BackendSQL:
+		return NewSQLStore(config, logger, db), nil
+	case BackendS3:
+		return NewS3Store(config, logger)
+	default:
+		return nil, fmt.Errorf("unknown log store backend: %s", config.LogStore.Backend)
+	}
+}
+
+// tail reads the last n lines with a reader of indexed logs, logs without a stream file return the last 100 lines
+func tail(reader *logreader.LogReader, src logreader.Source, taskID uint64, n int) ([]*logreader.Line, int, error) {
+	total, ok, err := logreader.CountLines(src, taskID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		return reader.Read(taskID, &logreader.Filter{})
+	}
+	if total == 0 {
+		return nil, 0, nil
+	}
+
+	return reader.Read(taskID, &logreader.Filter{From: max(total-n+1, 1), To: total})
+}
@@ -0,0 +1,285 @@
+package logstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fattymango/px-take-home/config"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/pkg/logger"
+)
+
+const (
+	S3_UPLOAD_ATTEMPTS    = 3           // attempts to upload a file before Finalize gives up
+	S3_UPLOAD_RETRY_DELAY = time.Second // delay before the second attempt, doubled for every attempt
+	S3_SIZE_CACHE_SIZE    = 4096        // object sizes cached by the source
+)
+
+// S3Store keeps finished task logs in an S3 compatible object store, one object per file of the FileStore layout
+// under the configured prefix. Running tasks are written to the task logs directory, the files are compressed and
+// uploaded by Finalize then removed locally. Range reads use the index sidecar and HTTP range requests,
+// so reading a few lines of a big log never downloads it.
+type S3Store struct {
+	config *config.Config
+	logger *logger.Logger
+
+	local  *FileStore
+	client *s3Client
+	source *s3Source
+	reader *logreader.LogReader
+}
+
+func NewS3Store(config *config.Config, logger *logger.Logger) (*S3Store, error) {
+	cfg := config.LogStore.S3
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 log store requires an endpoint and a bucket")
+	}
+
+	client, err := newS3Client(cfg.Endpoint, cfg.Region, cfg.Bucket, cfg.AccessKey, cfg.SecretKey, cfg.PathStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &s3Source{client: client, prefix: cfg.Prefix, sizes: newSizeCache(S3_SIZE_CACHE_SIZE)}
+	return &S3Store{
+		config: config,
+		logger: logger,
+		local:  NewFileStore(config, logger),
+		client: client,
+		source: source,
+		reader: logreader.NewLogReader(config, logger, source),
+	}, nil
+}
+
+// taskObjects returns the names of every file a task may have in the bucket
+func taskObjects(taskID uint64) []string {
+	return []string{
+		logreader.FormatFileName("", taskID),
+		logreader.FormatCompressedFileName("", taskID, logreader.CompressionGzip),
+		logreader.FormatCompressedFileName("", taskID, logreader.CompressionZstd),
+		logreader.FormatStreamFileName("", taskID),
+		logreader.FormatTimestampFileName("", taskID),
+		logreader.FormatIndexFileName("", taskID),
+		logreader.FormatFrameFileName("", taskID),
+	}
+}
+
+// isLocal reports whether the log of the task is still in the task logs directory
+func (s *S3Store) isLocal(taskID uint64) bool {
+	_, _, err := logreader.FindLog(s.local.source, taskID)
+	return err == nil
+}
+
+func (s *S3Store) Create(taskID uint64) (Writer, error) {
+	return s.local.Create(taskID)
+}
+
+// Finalize compresses the log and uploads the files of the task, every upload is attempted S3_UPLOAD_ATTEMPTS times.
+// The local files are only removed once every upload succeeded, a log that could not be uploaded stays readable
+// on this instance only and the error is returned.
+func (s *S3Store) Finalize(taskID uint64) error {
+	if err := s.local.Finalize(taskID); err != nil {
+		return err
+	}
+
+	files, err := logreader.TaskFiles(s.local.dirpath, taskID)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := s.uploadWithRetry(file); err != nil {
+			return err
+		}
+	}
+
+	return s.local.Delete(taskID)
+}
+
+func (s *S3Store) uploadWithRetry(path string) error {
+	delay := S3_UPLOAD_RETRY_DELAY
+	for attempt := 1; ; attempt++ {
+		err := s.upload(path)
+		if err == nil || attempt == S3_UPLOAD_ATTEMPTS {
+			return err
+		}
+		s.logger.Warnf("upload attempt %d of %s failed, retrying in %s: %s", attempt, filepath.Base(path), delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (s *S3Store) upload(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	name := filepath.Base(path)
+	if err := s.client.put(s.source.key(name), file, info.Size()); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	s.source.sizes.store(name, info.Size())
+	return nil
+}
+
+func (s *S3Store) Read(taskID uint64, filter *logreader.Filter) ([]*logreader.Line, int, error) {
+	if s.isLocal(taskID) {
+		return s.local.Read(taskID, filter)
+	}
+	return s.reader.Read(taskID, filter)
+}
+
+func (s *S3Store) Page(taskID uint64, cursor *logreader.Cursor, limit int) (*logreader.Page, error) {
+	if s.isLocal(taskID) {
+		return s.local.Page(taskID, cursor, limit)
+	}
+	return s.reader.Page(taskID, cursor, limit)
+}
+
+func (s *S3Store) Tail(taskID uint64, n int) ([]*logreader.Line, int, error) {
+	if s.isLocal(taskID) {
+		return s.local.Tail(taskID, n)
+	}
+	return tail(s.reader, s.source, taskID, n)
+}
+
+func (s *S3Store) Scan(taskID uint64, fn func(line *logreader.Line) error) error {
+	if s.isLocal(taskID) {
+		return s.local.Scan(taskID, fn)
+	}
+	return logreader.ScanLines(s.source, taskID, fn)
+}
+
+func (s *S3Store) Open(taskID uint64, acceptGzip bool, offset int64) (*Download, error) {
+	if s.isLocal(taskID) {
+		return s.local.Open(taskID, acceptGzip, offset)
+	}
+	return openLog(s.source, taskID, acceptGzip, offset)
+}
+
+func (s *S3Store) Size(taskID uint64) (int64, error) {
+	size, err := s.local.Size(taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, name := range taskObjects(taskID) {
+		n, err := s.source.Size(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+func (s *S3Store) Delete(taskID uint64) error {
+	if err := s.local.Delete(taskID); err != nil {
+		return err
+	}
+
+	for _, name := range taskObjects(taskID) {
+		s.source.sizes.delete(name)
+		if err := s.client.delete(s.source.key(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// s3Source reads the uploaded files of tasks. Objects are never modified once uploaded, their sizes are cached.
+type s3Source struct {
+	client *s3Client
+	prefix string
+	sizes  *sizeCache
+}
+
+func (s *s3Source) key(name string) string {
+	return s.prefix + name
+}
+
+func (s *s3Source) Size(name string) (int64, error) {
+	if size, ok := s.sizes.load(name); ok {
+		return size, nil
+	}
+
+	size, err := s.client.head(s.key(name))
+	if err != nil {
+		return 0, err
+	}
+	s.sizes.store(name, size)
+	return size, nil
+}
+
+func (s *s3Source) ReadAt(name string, p []byte, off int64) (int, error) {
+	body, err := s.client.get(s.key(name), off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (s *s3Source) Open(name string, off int64) (io.ReadCloser, error) {
+	return s.client.get(s.key(name), off, -1)
+}
+
+// sizeCache keeps the sizes of the last max objects stored, the oldest one is evicted first
+type sizeCache struct {
+	mu    sync.Mutex
+	max   int
+	sizes map[string]int64
+	order []string
+}
+
+func newSizeCache(max int) *sizeCache {
+	return &sizeCache{max: max, sizes: make(map[string]int64)}
+}
+
+func (c *sizeCache) load(name string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size, ok := c.sizes[name]
+	return size, ok
+}
+
+func (c *sizeCache) store(name string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.sizes[name]; !ok {
+		c.order = append(c.order, name)
+	}
+	c.sizes[name] = size
+
+	for len(c.order) > c.max {
+		delete(c.sizes, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// delete evicts the object, its name is kept in the order until it's the oldest
+func (c *sizeCache) delete(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sizes, name)
+}
@@ -0,0 +1,283 @@
+package logstore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/fattymango/px-take-home/config"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/db"
+	"github.com/fattymango/px-take-home/pkg/logger"
+)
+
+const (
+	SQL_BATCH_SIZE  = 500                 // Lines per insert, the writer also flushes once this many lines are pending
+	SQL_MAX_PENDING = 20 * SQL_BATCH_SIZE // Lines kept pending while inserts fail, they are dropped past this
+	DEFAULT_LINES   = 100                 // Lines returned when no range is given
+)
+
+// SQLStore keeps every log line as a row of the task log line table, in the database shared by the server instances.
+type SQLStore struct {
+	config *config.Config
+	logger *logger.Logger
+	db     *db.DB
+}
+
+func NewSQLStore(config *config.Config, logger *logger.Logger, db *db.DB) *SQLStore {
+	return &SQLStore{
+		config: config,
+		logger: logger,
+		db:     db,
+	}
+}
+
+// Create removes the lines left by a previous run of the task
+func (s *SQLStore) Create(taskID uint64) (Writer, error) {
+	if err := s.Delete(taskID); err != nil {
+		return nil, err
+	}
+	return &sqlWriter{db: s.db, taskID: taskID}, nil
+}
+
+func (s *SQLStore) Finalize(taskID uint64) error {
+	return nil
+}
+
+func (s *SQLStore) total(taskID uint64) (int, error) {
+	var total int
+	err := s.db.Model(&model.TaskLogLine{}).
+		Select("COALESCE(MAX(line_number), 0)").
+		Where("task_id = ?", taskID).
+		Scan(&total).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count task log lines: %w", err)
+	}
+	return total, nil
+}
+
+// Read returns the lines selected by the filter, without a line or time range the last 100 lines are returned
+func (s *SQLStore) Read(taskID uint64, filter *logreader.Filter) ([]*logreader.Line, int, error) {
+	total, err := s.total(taskID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	from, to := filter.From, filter.To
+	if from == 0 && to == 0 && filter.Since == 0 && filter.Until == 0 {
+		from, to = max(total-DEFAULT_LINES+1, 1), total
+	}
+
+	query := s.db.Where("task_id = ?", taskID)
+	if from != 0 {
+		query = query.Where("line_number >= ?", from)
+	}
+	if to != 0 {
+		query = query.Where("line_number <= ?", to)
+	}
+	if filter.Since != 0 {
+		query = query.Where("time >= ?", filter.Since)
+	}
+	if filter.Until != 0 {
+		query = query.Where("time <= ?", filter.Until)
+	}
+	if filter.Stream != 0 {
+		query = query.Where("stream = ?", filter.Stream)
+	}
+
+	// Until alone keeps the last lines of the time range
+	last := filter.Limit > 0 && filter.Since == 0 && filter.Until != 0
+	order := "line_number"
+	if last {
+		order = "line_number DESC"
+	}
+	if filter.Limit > 0 && (filter.Since != 0 || filter.Until != 0) {
+		query = query.Limit(filter.Limit)
+	}
+
+	var rows []*model.TaskLogLine
+	if err := query.Order(order).Find(&rows).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to read task log lines: %w", err)
+	}
+	if last {
+		slices.Reverse(rows)
+	}
+
+	return toLines(rows), total, nil
+}
+
+// Page reads the lines of the cursor by line number, rows have no byte offset so the cursors of SQL logs have none
+func (s *SQLStore) Page(taskID uint64, cursor *logreader.Cursor, limit int) (*logreader.Page, error) {
+	total, err := s.total(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if cursor == nil {
+		cursor = &logreader.Cursor{Line: total + 1, Offset: -1, Backward: true}
+	}
+	if err := cursor.Validate(total); err != nil {
+		return nil, err
+	}
+	first, last := cursor.Range(total, limit)
+
+	var rows []*model.TaskLogLine
+	if first <= last {
+		err := s.db.Where("task_id = ? AND line_number BETWEEN ? AND ?", taskID, first, last).
+			Order("line_number").Find(&rows).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to read task log lines: %w", err)
+		}
+	}
+
+	page := &logreader.Page{Lines: toLines(rows), Total: total, Next: &logreader.Cursor{Line: max(last, first-1) + 1, Offset: -1}}
+	if first > 1 {
+		page.Prev = &logreader.Cursor{Line: first, Offset: -1, Backward: true}
+	}
+	return page, nil
+}
+
+func (s *SQLStore) Tail(taskID uint64, n int) ([]*logreader.Line, int, error) {
+	total, err := s.total(taskID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rows []*model.TaskLogLine
+	err = s.db.Where("task_id = ?", taskID).Order("line_number DESC").Limit(n).Find(&rows).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read task log lines: %w", err)
+	}
+	slices.Reverse(rows)
+
+	return toLines(rows), total, nil
+}
+
+func toLines(rows []*model.TaskLogLine) []*logreader.Line {
+	if len(rows) == 0 {
+		return nil
+	}
+	lines := make([]*logreader.Line, len(rows))
+	for i, row := range rows {
+		lines[i] = &logreader.Line{Number: row.LineNumber, Stream: row.Stream, Time: row.Time, Text: row.Text}
+	}
+	return lines
+}
+
+// Scan reads the lines in batches, the log is never held in memory as a whole
+func (s *SQLStore) Scan(taskID uint64, fn func(line *logreader.Line) error) error {
+	last := 0
+	for {
+		var rows []*model.TaskLogLine
+		err := s.db.Where("task_id = ? AND line_number > ?", taskID, last).
+			Order("line_number").Limit(SQL_BATCH_SIZE).Find(&rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to read task log lines: %w", err)
+		}
+
+		for _, line := range toLines(rows) {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < SQL_BATCH_SIZE {
+			return nil
+		}
+		last = rows[len(rows)-1].LineNumber
+	}
+}
+
+// Open returns os.ErrNotExist if the task has no lines, a task without output has no log in the database
+func (s *SQLStore) Open(taskID uint64, acceptGzip bool, offset int64) (*Download, error) {
+	total, err := s.total(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("log of task #%d: %w", taskID, os.ErrNotExist)
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(s.Scan(taskID, func(line *logreader.Line) error {
+			_, err := io.WriteString(pw, line.Text+"\n")
+			return err
+		}))
+	}()
+
+	if err := skip(pr, offset); err != nil {
+		return nil, err
+	}
+	return &Download{ReadCloser: pr, Size: -1}, nil
+}
+
+func (s *SQLStore) Size(taskID uint64) (int64, error) {
+	var size int64
+	err := s.db.Model(&model.TaskLogLine{}).
+		Select("COALESCE(SUM(OCTET_LENGTH(text) + 1), 0)").
+		Where("task_id = ?", taskID).
+		Scan(&size).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get task log size: %w", err)
+	}
+	return size, nil
+}
+
+func (s *SQLStore) Delete(taskID uint64) error {
+	if err := s.db.Where("task_id = ?", taskID).Delete(&model.TaskLogLine{}).Error; err != nil {
+		return fmt.Errorf("failed to delete task log lines: %w", err)
+	}
+	return nil
+}
+
+// sqlWriter inserts the pending lines on flush, lines that failed to insert, e.g. while the database is busy,
+// stay pending and are retried on the next flush. Past SQL_MAX_PENDING lines they are dropped and the error
+// reports how many, their line numbers are missing from the log.
+type sqlWriter struct {
+	db      *db.DB
+	taskID  uint64
+	lines   int
+	pending []*model.TaskLogLine
+}
+
+func (w *sqlWriter) Write(stream model.LogStream, ts int64, line []byte) error {
+	w.lines++
+	w.pending = append(w.pending, &model.TaskLogLine{
+		TaskID:     w.taskID,
+		LineNumber: w.lines,
+		Stream:     stream,
+		Time:       ts,
+		Text:       strings.TrimSuffix(string(line), "\n"),
+	})
+
+	// Once a batch is pending, failed inserts are retried every batch rather than every line
+	if len(w.pending)%SQL_BATCH_SIZE == 0 {
+		return w.Flush()
+	}
+	return nil
+}
+
+func (w *sqlWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	if err := w.db.CreateInBatches(w.pending, SQL_BATCH_SIZE).Error; err != nil {
+		if len(w.pending) >= SQL_MAX_PENDING {
+			dropped := len(w.pending)
+			w.pending = w.pending[:0]
+			return fmt.Errorf("failed to insert task log lines, %d lines dropped: %w", dropped, err)
+		}
+		return fmt.Errorf("failed to insert task log lines: %w", err)
+	}
+	w.pending = w.pending[:0]
+	return nil
+}
+
+func (w *sqlWriter) Close() error {
+	return w.Flush()
+}
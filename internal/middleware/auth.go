@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/fattymango/px-take-home/dto"
+	"github.com/fattymango/px-take-home/pkg/ctxstore"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireAPIKey only lets requests through if they carry one of the given API keys in the header.
+func RequireAPIKey(header string, keys []string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := ctxstore.GetAPIKeyFromCtx(c, header)
+		if key == "" {
+			return dto.NewUnauthorizedResponse(c, "missing API key")
+		}
+
+		for _, allowed := range keys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(allowed)) == 1 {
+				return c.Next()
+			}
+		}
+
+		return dto.NewForbiddenResponse(c, "API key is not allowed to perform this action")
+	}
+}
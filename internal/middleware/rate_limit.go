@@ -1,23 +1,128 @@
 package middleware
 
 import (
+	"math"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/dto"
+	"github.com/fattymango/px-take-home/pkg/ctxstore"
 	"github.com/fattymango/px-take-home/pkg/logger"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
 )
 
-func RateLimiter(logger *logger.Logger) fiber.Handler {
-	return limiter.New(limiter.Config{
-		LimiterMiddleware: limiter.SlidingWindow{},
-		Max:               100,             // maximum requests allowed per duration
-		Expiration:        1 * time.Minute, // duration for which requests are counted
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "rate limit exceeded, please try again later",
-			})
-		},
-	})
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+)
+
+// window is a sliding window counter, the previous window is weighted by how much of it still overlaps
+type window struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+type rateLimiter struct {
+	config *config.Config
+	logger *logger.Logger
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+// RateLimiter limits requests per client, clients are identified by a configured API key, their certificate or IP.
+func RateLimiter(cfg *config.Config, logger *logger.Logger) fiber.Handler {
+	r := &rateLimiter{
+		config:    cfg,
+		logger:    logger,
+		windows:   make(map[string]*window),
+		lastSweep: time.Now(),
+	}
+
+	return r.handle
+}
+
+func (r *rateLimiter) handle(c *fiber.Ctx) error {
+	clientID := ctxstore.GetClientIDFromCtx(c, &r.config.Auth)
+	max := r.limitFor(clientID)
+	remaining, reset, ok := r.take(clientID, max)
+
+	c.Set(HeaderRateLimitLimit, strconv.Itoa(max))
+	c.Set(HeaderRateLimitRemaining, strconv.Itoa(remaining))
+	c.Set(HeaderRateLimitReset, strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+
+	if !ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+		return dto.NewTooManyRequestsResponse(c, "rate limit exceeded, please try again later")
+	}
+
+	return c.Next()
+}
+
+// limitFor returns the override of the client if it has one, unknown API keys never match since clients are
+// only identified by configured keys
+func (r *rateLimiter) limitFor(clientID string) int {
+	if max, ok := r.config.RateLimit.Overrides[clientID]; ok {
+		return max
+	}
+	return r.config.RateLimit.Max
+}
+
+// take counts a request for the client and returns the remaining requests, the time until the window resets
+// and whether the request is allowed.
+func (r *rateLimiter) take(clientID string, max int) (int, time.Duration, bool) {
+	size := r.config.RateLimit.Window
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(now)
+
+	w, ok := r.windows[clientID]
+	if !ok {
+		w = &window{start: now}
+		r.windows[clientID] = w
+	}
+
+	elapsed := now.Sub(w.start)
+	switch {
+	case elapsed >= 2*size:
+		w.start, w.previous, w.current = now, 0, 0
+		elapsed = 0
+	case elapsed >= size:
+		w.start, w.previous, w.current = w.start.Add(size), w.current, 0
+		elapsed -= size
+	}
+
+	reset := size - elapsed
+	weight := float64(reset) / float64(size)
+	used := int(float64(w.previous)*weight) + w.current
+
+	if used >= max {
+		return 0, reset, false
+	}
+
+	w.current++
+	return max - used - 1, reset, true
+}
+
+// sweep drops clients that have been idle for more than two windows, at most once per window
+func (r *rateLimiter) sweep(now time.Time) {
+	size := r.config.RateLimit.Window
+	if now.Sub(r.lastSweep) < size {
+		return
+	}
+	r.lastSweep = now
 
+	for id, w := range r.windows {
+		if now.Sub(w.start) >= 2*size {
+			delete(r.windows, id)
+		}
+	}
 }
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/pkg/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRateLimiter(max int) *rateLimiter {
+	return &rateLimiter{
+		config: &config.Config{
+			RateLimit: config.RateLimit{Max: max, Window: time.Minute},
+		},
+		logger:    logger.NewTestLogger(),
+		windows:   make(map[string]*window),
+		lastSweep: time.Now(),
+	}
+}
+
+func TestRateLimiter_Take(t *testing.T) {
+	tests := []struct {
+		name string
+		// previous and current counts of the window, and how long ago it started
+		previous, current int
+		started           time.Duration
+		wantRemaining     int
+		wantOK            bool
+	}{
+		{name: "new client", wantRemaining: 9, wantOK: true},
+		{name: "current window full", current: 10, wantRemaining: 0, wantOK: false},
+		{name: "previous window full", previous: 10, current: 1, wantRemaining: 0, wantOK: false},
+		{name: "previous window still overlapping", previous: 10, started: 15 * time.Second, wantRemaining: 2, wantOK: true},
+		{name: "previous window mostly slid out", previous: 10, started: 45 * time.Second, wantRemaining: 7, wantOK: true},
+		{name: "current window becomes the previous", current: 10, started: 75 * time.Second, wantRemaining: 2, wantOK: true},
+		{name: "both windows expired", previous: 10, current: 10, started: 3 * time.Minute, wantRemaining: 9, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRateLimiter(10)
+			if tt.previous > 0 || tt.current > 0 {
+				r.windows["client"] = &window{start: time.Now().Add(-tt.started), previous: tt.previous, current: tt.current}
+			}
+
+			remaining, reset, ok := r.take("client", 10)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantRemaining, remaining)
+			assert.True(t, reset > 0 && reset <= time.Minute)
+		})
+	}
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	r := newTestRateLimiter(10)
+	r.windows["idle"] = &window{start: time.Now().Add(-3 * time.Minute)}
+	r.windows["active"] = &window{start: time.Now()}
+	r.lastSweep = time.Now().Add(-2 * time.Minute)
+
+	r.take("active", 10)
+	assert.NotContains(t, r.windows, "idle")
+	assert.Contains(t, r.windows, "active")
+}
+
+func TestRateLimiter_Clients(t *testing.T) {
+	// Overrides are keyed by client ID, an API key as is doesn't match
+	vip := sha256.Sum256([]byte("vip"))
+	cfg := &config.Config{
+		Auth: config.Auth{APIKeyHeader: "X-API-Key", ClientKeys: []string{"known", "vip"}},
+		RateLimit: config.RateLimit{
+			Max:       2,
+			Window:    time.Minute,
+			Overrides: config.RateLimitOverrides{"key:" + hex.EncodeToString(vip[:8]): 3, "known": 100, "unknown": 100},
+		},
+	}
+
+	app := fiber.New()
+	app.Use(RateLimiter(cfg, logger.NewTestLogger()))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	request := func(key string) int {
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// unknown keys are not identities, they share the limit of the IP and don't get overrides
+	assert.Equal(t, fiber.StatusOK, request(""))
+	assert.Equal(t, fiber.StatusOK, request("unknown"))
+	assert.Equal(t, fiber.StatusTooManyRequests, request("other"))
+
+	// configured keys have their own limit
+	assert.Equal(t, fiber.StatusOK, request("known"))
+	assert.Equal(t, fiber.StatusOK, request("known"))
+	assert.Equal(t, fiber.StatusTooManyRequests, request("known"))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, fiber.StatusOK, request("vip"))
+	}
+	assert.Equal(t, fiber.StatusTooManyRequests, request("vip"))
+}
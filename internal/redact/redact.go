@@ -0,0 +1,91 @@
+package redact
+
+import (
+	"regexp"
+
+	"github.com/fattymango/px-take-home/config"
+)
+
+const (
+	DefaultReplacement = "[REDACTED]"
+)
+
+type rule struct {
+	name        string
+	re          *regexp.Regexp
+	replacement []byte
+}
+
+// Redactor masks configured patterns in task output lines.
+// It is safe for concurrent use, counters are kept by the caller.
+type Redactor struct {
+	rules []*rule
+}
+
+// NewRedactor compiles the given rules, patterns are already validated when the config is decoded.
+func NewRedactor(rules config.RedactRules) *Redactor {
+	r := &Redactor{rules: make([]*rule, 0, len(rules))}
+	for _, cfgRule := range rules {
+		replacement := cfgRule.Replacement
+		if replacement == "" {
+			replacement = DefaultReplacement
+		}
+		r.rules = append(r.rules, &rule{
+			name:        cfgRule.Name,
+			re:          regexp.MustCompile(cfgRule.Pattern),
+			replacement: []byte(replacement),
+		})
+	}
+
+	return r
+}
+
+// Redact applies every rule to the line in order and returns the redacted line.
+// The number of matches per rule name is added to counts.
+func (r *Redactor) Redact(line []byte, counts map[string]int64) []byte {
+	line, _ = r.RedactBefore(line, len(line), counts)
+	return line
+}
+
+// RedactBefore is Redact for the matches starting before n, the rest of the line is left as is.
+// It returns the redacted line and the position of n in it, a match crossing n moves it to the end of its replacement.
+// It lets a line be redacted in parts, as long as a match crossing n ends before the end of the line.
+func (r *Redactor) RedactBefore(line []byte, n int, counts map[string]int64) ([]byte, int) {
+	for _, rule := range r.rules {
+		matches := rule.re.FindAllSubmatchIndex(line, -1)
+		if len(matches) == 0 || matches[0][0] >= n {
+			continue
+		}
+
+		out := make([]byte, 0, len(line))
+		last := 0
+		applied := 0
+		pos := -1
+		for _, m := range matches {
+			if m[0] >= n {
+				break
+			}
+			out = append(out, line[last:m[0]]...)
+			out = rule.re.Expand(out, rule.replacement, line, m)
+			last = m[1]
+			applied++
+			if m[1] > n {
+				pos = len(out)
+			}
+		}
+		if pos < 0 {
+			pos = len(out) + n - last
+		}
+		line = append(out, line[last:]...)
+		n = pos
+
+		counts[rule.name] += int64(applied)
+	}
+
+	return line, n
+}
+
+// Empty reports whether no rules are configured.
+func (r *Redactor) Empty() bool {
+	return len(r.rules) == 0
+}
@@ -0,0 +1,76 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	redactor := NewRedactor(config.RedactRules{
+		{Name: "password", Pattern: `(password=)\S+`, Replacement: "${1}***"},
+		{Name: "card", Pattern: `\b\d{4}-\d{4}-\d{4}-\d{4}\b`},
+	})
+
+	counts := map[string]int64{}
+	line := redactor.Redact([]byte("login password=hunter2 card 4111-1111-1111-1111 and 4000-0000-0000-0002"), counts)
+
+	assert.Equal(t, "login password=*** card [REDACTED] and [REDACTED]", string(line))
+	assert.Equal(t, map[string]int64{"password": 1, "card": 2}, counts)
+}
+
+func TestRedactor_NoMatch(t *testing.T) {
+	redactor := NewRedactor(config.RedactRules{
+		{Name: "token", Pattern: `ghp_[A-Za-z0-9]{36}`},
+	})
+
+	counts := map[string]int64{}
+	line := redactor.Redact([]byte("nothing to see here"), counts)
+
+	assert.Equal(t, "nothing to see here", string(line))
+	assert.Empty(t, counts)
+}
+
+func TestRedactor_RedactBefore(t *testing.T) {
+	redactor := NewRedactor(config.RedactRules{
+		{Name: "password", Pattern: `password=\S+`},
+	})
+
+	tests := []struct {
+		name      string
+		line      string
+		n         int
+		wantLine  string
+		wantN     int
+		wantCount int64
+	}{
+		{name: "match before n", line: "password=a1 rest", n: 14, wantLine: "[REDACTED] rest", wantN: 13, wantCount: 1},
+		{name: "match after n is left", line: "abc password=a1", n: 3, wantLine: "abc password=a1", wantN: 3},
+		{name: "match crossing n moves it", line: "ab password=a1b2 cd", n: 8, wantLine: "ab [REDACTED] cd", wantN: 13, wantCount: 1},
+		{name: "match ending at n", line: "password=a1 cd", n: 11, wantLine: "[REDACTED] cd", wantN: 10, wantCount: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := map[string]int64{}
+			line, n := redactor.RedactBefore([]byte(tt.line), tt.n, counts)
+			assert.Equal(t, tt.wantLine, string(line))
+			assert.Equal(t, tt.wantN, n)
+			assert.Equal(t, tt.wantCount, counts["password"])
+		})
+	}
+}
+
+func TestRedactRules_Decode(t *testing.T) {
+	var rules config.RedactRules
+	err := rules.Decode(`[{"name":"token","pattern":"tok_[a-z]+","replacement":"[TOKEN]"}]`)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	err = rules.Decode(`[{"name":"bad","pattern":"("}]`)
+	assert.Error(t, err)
+
+	err = rules.Decode(`[{"pattern":"abc"}]`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,201 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/fattymango/px-take-home/internal/ansi"
+)
+
+const (
+	LongLinesSplit    = "split"
+	LongLinesTruncate = "truncate"
+
+	DefaultMaxLineLength = 64 * 1024
+
+	// LineSplitMarker ends every part of a split line but the last one
+	LineSplitMarker = " [line continues]"
+	// lineTruncatedMarker ends a truncated line, with the number of dropped bytes
+	lineTruncatedMarker = " [... %d bytes truncated]"
+
+	// RedactWindow is the number of bytes read past the cut of a long line before it is split or truncated,
+	// so a secret of up to this many bytes crossing the cut is redacted whole
+	RedactWindow = 4096
+)
+
+// RedactFunc redacts the matches of line starting before n, it returns the redacted line and the position of n in it.
+// See redact.Redactor.RedactBefore.
+type RedactFunc func(line []byte, n int) ([]byte, int)
+
+// LineLimit controls how lines longer than Max bytes are captured:
+//   - split: the line is emitted in parts of at most Max bytes, every part but the last ends with LineSplitMarker
+//   - truncate: only the first Max bytes are kept, the line ends with the number of dropped bytes
+type LineLimit struct {
+	Max  int
+	Mode string
+}
+
+var DefaultLineLimit = LineLimit{Max: DefaultMaxLineLength, Mode: LongLinesSplit}
+
+// lineReader reads lines of at most limit.Max bytes, it never stops on long lines so the pipe is always drained.
+// Emitted lines are copies, they are safe to use after the next read, and invalid UTF-8 is escaped.
+// Lines rewritten with carriage returns, like progress bars, are collapsed to their final state as they are read.
+// Lines are redacted before they are split or truncated, so a secret is never cut in two.
+type lineReader struct {
+	reader *bufio.Reader
+	limit  LineLimit
+	redact RedactFunc // nil if the output is not redacted
+
+	pending   []byte // start of the current line
+	dropped   int    // bytes of the current line dropped in truncate mode
+	truncated bool   // whether any line was truncated
+}
+
+func newLineReader(r io.Reader, limit LineLimit) *lineReader {
+	if limit.Max <= 0 {
+		limit.Max = DefaultMaxLineLength
+	}
+	return &lineReader{
+		reader: bufio.NewReaderSize(r, limit.Max),
+		limit:  limit,
+	}
+}
+
+// read calls emit for every line until the reader is exhausted
+func (l *lineReader) read(emit func(line []byte)) {
+	for {
+		chunk, err := l.reader.ReadSlice('\n')
+		complete := err == nil
+
+		if complete {
+			chunk = chunk[:len(chunk)-1]
+		}
+		l.append(chunk, emit)
+
+		if complete {
+			l.finish(emit)
+			continue
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		// EOF or read error, emit what is left of the last line
+		if len(l.pending) > 0 || l.dropped > 0 {
+			l.finish(emit)
+		}
+		return
+	}
+}
+
+// append adds a chunk to the current line, emitting the parts that exceed the limit in split mode
+func (l *lineReader) append(chunk []byte, emit func(line []byte)) {
+	if l.dropped > 0 {
+		l.dropped += len(chunk)
+		return
+	}
+
+	l.pending = append(l.pending, chunk...)
+	if ansi.NeedsCollapse(chunk) {
+		l.collapse()
+	}
+
+	window := 0
+	if l.redact != nil {
+		window = RedactWindow
+	}
+	l.cut(l.limit.Max+window, emit)
+}
+
+// cut splits or truncates the current line while it is longer than size bytes, the parts are redacted before
+func (l *lineReader) cut(size int, emit func(line []byte)) {
+	for len(l.pending) > size {
+		cut := runeBoundary(l.pending, l.limit.Max)
+		if l.redact != nil {
+			l.pending, cut = l.redact(l.pending, cut)
+			if cut == 0 {
+				continue
+			}
+		}
+
+		if l.limit.Mode == LongLinesTruncate {
+			l.dropped = len(l.pending) - cut
+			l.pending = l.pending[:cut]
+			return
+		}
+
+		part := append(escapeInvalidUTF8(l.pending[:cut]), LineSplitMarker...)
+		emit(part)
+		l.pending = append(l.pending[:0], l.pending[cut:]...)
+	}
+}
+
+// collapse rewrites the current line to its final state, see ansi.Collapse, so a line redrawn with carriage returns
+// doesn't grow. A trailing carriage return is kept until the next chunk, it either ends the line or rewrites it.
+func (l *lineReader) collapse() {
+	line, cr := bytes.CutSuffix(l.pending, []byte{'\r'})
+	if !ansi.NeedsCollapse(line) {
+		return
+	}
+	l.pending = ansi.Collapse(line)
+	if cr {
+		l.pending = append(l.pending, '\r')
+	}
+}
+
+// finish emits the rest of the current line and starts a new one
+func (l *lineReader) finish(emit func(line []byte)) {
+	l.collapse()
+	l.pending = bytes.TrimSuffix(l.pending, []byte{'\r'})
+	if l.dropped == 0 {
+		// The redact window or the collapse may have left the line over the limit
+		l.cut(l.limit.Max, emit)
+	}
+
+	line := l.pending
+	// A truncated line was redacted when it was cut
+	if l.redact != nil && l.dropped == 0 {
+		line, _ = l.redact(line, len(line))
+	}
+	line = escapeInvalidUTF8(line)
+	if l.dropped > 0 {
+		line = append(line, fmt.Sprintf(lineTruncatedMarker, l.dropped)...)
+		l.truncated = true
+	}
+
+	l.pending = l.pending[:0]
+	l.dropped = 0
+	emit(line)
+}
+
+// runeBoundary returns the largest cut <= max that doesn't split a UTF-8 sequence
+func runeBoundary(b []byte, max int) int {
+	for cut := max; cut > 0 && cut > max-utf8.UTFMax; cut-- {
+		if utf8.RuneStart(b[cut]) {
+			return cut
+		}
+	}
+	return max
+}
+
+// escapeInvalidUTF8 returns a copy of b with every byte that is not valid UTF-8 written as \xNN
+func escapeInvalidUTF8(b []byte) []byte {
+	if utf8.Valid(b) {
+		return bytes.Clone(b)
+	}
+
+	out := make([]byte, 0, len(b)+8)
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			out = fmt.Appendf(out, `\x%02x`, b[0])
+		} else {
+			out = append(out, b[:size]...)
+		}
+		b = b[size:]
+	}
+	return out
+}
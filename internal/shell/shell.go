@@ -1,37 +1,61 @@
 package shell
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
+)
+
+// StdinWriteTimeout is how long WriteStdin waits for a command that doesn't read its stdin
+const StdinWriteTimeout = time.Second
+
+var (
+	ErrStdinClosed = errors.New("stdin is not open")
+	ErrStdinFull   = errors.New("stdin is full, the command is not reading it")
 )
 
 type ShellExecutor struct {
-	command string
-	cmd     *exec.Cmd
-	stdout  chan []byte
-	stderr  chan []byte
+	command   string
+	lineLimit LineLimit
+	cmd       *exec.Cmd
+	stdout    chan []byte
+	stderr    chan []byte
 
 	stdoutPipe io.ReadCloser
 	stderrPipe io.ReadCloser
 
+	// nil unless the stdin of the command is kept open, see OpenStdin
+	stdinPipe *os.File
+	stdin     bool
+	stdinMu   sync.Mutex
+
+	// set when a line of either stream was truncated
+	truncated atomic.Bool
+
+	// applied to the lines of both streams as they are read, see Redact
+	redact RedactFunc
+
 	wg sync.WaitGroup
 
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
-func NewShellExecutor(command string) *ShellExecutor {
+func NewShellExecutor(command string, lineLimit LineLimit) *ShellExecutor {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &ShellExecutor{
-		command: command,
-		wg:      sync.WaitGroup{},
-		ctx:     ctx,
-		cancel:  cancel,
+		command:   command,
+		lineLimit: lineLimit,
+		wg:        sync.WaitGroup{},
+		ctx:       ctx,
+		cancel:    cancel,
 	}
 }
 
@@ -55,7 +79,27 @@ func (s *ShellExecutor) Execute() error {
 		return fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 	s.stderrPipe = stderrPipe
-	if err := s.cmd.Start(); err != nil {
+
+	// The pipe is created here rather than with StdinPipe, its writer is a file that supports write deadlines
+	var stdinReader *os.File
+	if s.stdin {
+		stdinReader, s.stdinPipe, err = os.Pipe()
+		if err != nil {
+			return fmt.Errorf("failed to create stdin pipe: %w", err)
+		}
+		s.cmd.Stdin = stdinReader
+	}
+
+	err = s.cmd.Start()
+	// The command has its own copy of the reader
+	if stdinReader != nil {
+		stdinReader.Close()
+	}
+	if err != nil {
+		if s.stdinPipe != nil {
+			s.stdinPipe.Close()
+			s.stdinPipe = nil
+		}
 		return fmt.Errorf("failed to start command: %w", err)
 	}
 
@@ -66,6 +110,56 @@ func (s *ShellExecutor) Execute() error {
 	return nil
 }
 
+// OpenStdin keeps the stdin of the command open for WriteStdin, it must be called before Execute.
+// Otherwise the command reads from the null device and gets EOF right away.
+func (s *ShellExecutor) OpenStdin() {
+	s.stdin = true
+}
+
+// Redact redacts the lines of the output before they are split or truncated, it must be called before Execute.
+// fn is called from the goroutines reading stdout and stderr at the same time.
+func (s *ShellExecutor) Redact(fn RedactFunc) {
+	s.redact = fn
+}
+
+// WriteStdin writes data to the stdin of the command. It returns ErrStdinFull if the pipe is still full after
+// StdinWriteTimeout, the error has the number of bytes written and the rest can be written again later.
+func (s *ShellExecutor) WriteStdin(data []byte) error {
+	s.stdinMu.Lock()
+	defer s.stdinMu.Unlock()
+
+	if s.stdinPipe == nil {
+		return ErrStdinClosed
+	}
+	if err := s.stdinPipe.SetWriteDeadline(time.Now().Add(StdinWriteTimeout)); err != nil {
+		return fmt.Errorf("failed to set stdin write deadline: %w", err)
+	}
+	n, err := s.stdinPipe.Write(data)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: %d of %d bytes written", ErrStdinFull, n, len(data))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write to stdin: %w", err)
+	}
+	return nil
+}
+
+// CloseStdin closes the stdin of the command, which reads EOF once it read the data written before
+func (s *ShellExecutor) CloseStdin() error {
+	s.stdinMu.Lock()
+	defer s.stdinMu.Unlock()
+
+	if s.stdinPipe == nil {
+		return ErrStdinClosed
+	}
+	err := s.stdinPipe.Close()
+	s.stdinPipe = nil
+	if err != nil {
+		return fmt.Errorf("failed to close stdin: %w", err)
+	}
+	return nil
+}
+
 func (s *ShellExecutor) StdOutPipe() (<-chan []byte, error) {
 	if s.stdoutPipe == nil {
 		return nil, fmt.Errorf("stdout pipe not created")
@@ -81,14 +175,14 @@ func (s *ShellExecutor) StdErrPipe() (<-chan []byte, error) {
 }
 
 func (s *ShellExecutor) Cancel() error {
-	s.cancel()   // calling cancel will kill the command since we are passing the context to the command
-	s.wg.Wait()  // wait for streams to finish
-	s.cmd.Wait() // wait for command to finish
+	s.cancel()  // calling cancel will kill the command since we are passing the context to the command
+	s.wg.Wait() // wait for streams to finish
+	s.wait()    // wait for command to finish
 	return nil
 }
 
 func (s *ShellExecutor) GetExitCode() (int, error) {
-	err := s.cmd.Wait()
+	err := s.wait()
 	if err != nil {
 		return -1, fmt.Errorf("failed to get exit code: %w", err)
 	}
@@ -97,12 +191,29 @@ func (s *ShellExecutor) GetExitCode() (int, error) {
 	return exitCode, nil
 }
 
+// wait waits for the command to exit and closes its stdin if it's still open
+func (s *ShellExecutor) wait() error {
+	err := s.cmd.Wait()
+	s.CloseStdin()
+	return err
+}
+
+// Truncated reports whether a line was truncated because of the line limit, it is only valid once the pipes are closed.
+func (s *ShellExecutor) Truncated() bool {
+	return s.truncated.Load()
+}
+
+// readPipe sends every line of the pipe to ch, lines are copies so the receiver can keep them
 func (s *ShellExecutor) readPipe(pipe io.ReadCloser, ch chan<- []byte) {
 	defer s.wg.Done()
 	defer close(ch)
 
-	scanner := bufio.NewScanner(pipe)
-	for scanner.Scan() {
-		ch <- scanner.Bytes()
+	reader := newLineReader(pipe, s.lineLimit)
+	reader.redact = s.redact
+	reader.read(func(line []byte) {
+		ch <- line
+	})
+	if reader.truncated {
+		s.truncated.Store(true)
 	}
 }
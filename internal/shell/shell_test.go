@@ -1,16 +1,20 @@
 package shell
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/internal/redact"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestShellExecutor_SuccessfulExecution(t *testing.T) {
 	// Create a shell executor with a simple echo command
 	command := `echo "test output" && echo "test error" >&2`
-	executor := NewShellExecutor(command)
+	executor := NewShellExecutor(command, DefaultLineLimit)
 
 	// Execute the command
 	err := executor.Execute()
@@ -62,7 +66,7 @@ func TestShellExecutor_SuccessfulExecution(t *testing.T) {
 func TestShellExecutor_CancelExecution(t *testing.T) {
 	// Create a shell executor with a long-running command that outputs periodically
 	command := `for i in {1..10}; do echo "output $i"; sleep 1; done`
-	executor := NewShellExecutor(command)
+	executor := NewShellExecutor(command, DefaultLineLimit)
 
 	// Execute the command
 	err := executor.Execute()
@@ -108,3 +112,205 @@ func TestShellExecutor_CancelExecution(t *testing.T) {
 	assert.Error(t, err, "GetExitCode should return an error for cancelled command")
 	assert.NotEqual(t, 0, exitCode)
 }
+
+func TestShellExecutor_LongLines(t *testing.T) {
+	// A line longer than the default scanner buffer, followed by a short one
+	command := `head -c 200000 /dev/zero | tr '\0' a; echo; echo after`
+	executor := NewShellExecutor(command, LineLimit{Max: 100000, Mode: LongLinesSplit})
+
+	err := executor.Execute()
+	assert.NoError(t, err)
+
+	stdoutChan, err := executor.StdOutPipe()
+	assert.NoError(t, err)
+	stderrChan, err := executor.StdErrPipe()
+	assert.NoError(t, err)
+
+	var lines []string
+	for line := range stdoutChan {
+		lines = append(lines, string(line))
+	}
+	for range stderrChan {
+	}
+
+	exitCode, err := executor.GetExitCode()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+
+	assert.Len(t, lines, 3)
+	assert.Equal(t, strings.Repeat("a", 100000)+LineSplitMarker, lines[0])
+	assert.Equal(t, strings.Repeat("a", 100000), lines[1])
+	assert.Equal(t, "after", lines[2])
+	assert.False(t, executor.Truncated())
+}
+
+func TestShellExecutor_Stdin(t *testing.T) {
+	executor := NewShellExecutor(`while read -r line; do echo "got $line"; done; echo done`, DefaultLineLimit)
+	executor.OpenStdin()
+
+	err := executor.Execute()
+	assert.NoError(t, err)
+
+	stdoutChan, err := executor.StdOutPipe()
+	assert.NoError(t, err)
+	stderrChan, err := executor.StdErrPipe()
+	assert.NoError(t, err)
+
+	assert.NoError(t, executor.WriteStdin([]byte("a\nb\n")))
+	assert.NoError(t, executor.CloseStdin())
+	assert.ErrorIs(t, executor.WriteStdin([]byte("c\n")), ErrStdinClosed)
+
+	var lines []string
+	for line := range stdoutChan {
+		lines = append(lines, string(line))
+	}
+	for range stderrChan {
+	}
+
+	exitCode, err := executor.GetExitCode()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{"got a", "got b", "done"}, lines)
+
+	t.Run("Full", func(t *testing.T) {
+		// The command doesn't read its stdin, the write stops once the pipe is full
+		executor := NewShellExecutor(`sleep 10`, DefaultLineLimit)
+		executor.OpenStdin()
+		assert.NoError(t, executor.Execute())
+
+		start := time.Now()
+		err := executor.WriteStdin(make([]byte, 4*1024*1024))
+		assert.ErrorIs(t, err, ErrStdinFull)
+		assert.Less(t, time.Since(start), 2*StdinWriteTimeout)
+
+		assert.NoError(t, executor.Cancel())
+		assert.ErrorIs(t, executor.WriteStdin([]byte("a\n")), ErrStdinClosed, "stdin is closed once the command exits")
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		// Without OpenStdin the command reads EOF
+		executor := NewShellExecutor(`cat; echo done`, DefaultLineLimit)
+		assert.NoError(t, executor.Execute())
+		stdoutChan, _ := executor.StdOutPipe()
+		stderrChan, _ := executor.StdErrPipe()
+		assert.ErrorIs(t, executor.WriteStdin([]byte("a\n")), ErrStdinClosed)
+
+		var lines []string
+		for line := range stdoutChan {
+			lines = append(lines, string(line))
+		}
+		for range stderrChan {
+		}
+		assert.Equal(t, []string{"done"}, lines)
+
+		exitCode, err := executor.GetExitCode()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, exitCode)
+	})
+}
+
+func TestLineReader(t *testing.T) {
+	read := func(input string, limit LineLimit) ([]string, bool) {
+		reader := newLineReader(strings.NewReader(input), limit)
+		var lines []string
+		reader.read(func(line []byte) {
+			lines = append(lines, string(line))
+		})
+		return lines, reader.truncated
+	}
+
+	t.Run("Truncate", func(t *testing.T) {
+		lines, truncated := read(strings.Repeat("x", 40)+"\nshort\r\nlast", LineLimit{Max: 16, Mode: LongLinesTruncate})
+		assert.True(t, truncated)
+		assert.Equal(t, []string{strings.Repeat("x", 16) + " [... 24 bytes truncated]", "short", "last"}, lines)
+	})
+
+	t.Run("SplitKeepsRunes", func(t *testing.T) {
+		// 15 ascii bytes and a 3 bytes rune, the rune is not split
+		lines, truncated := read(strings.Repeat("x", 15)+"€y\n", LineLimit{Max: 16, Mode: LongLinesSplit})
+		assert.False(t, truncated)
+		assert.Equal(t, []string{strings.Repeat("x", 15) + LineSplitMarker, "€y"}, lines)
+	})
+
+	t.Run("InvalidUTF8", func(t *testing.T) {
+		lines, _ := read("ok \xff\xfe done\n\x00\n", DefaultLineLimit)
+		assert.Equal(t, []string{`ok \xff\xfe done`, "\x00"}, lines)
+	})
+
+	t.Run("CarriageReturns", func(t *testing.T) {
+		// A progress bar longer than the limit once drawn is collapsed to its final state, not split
+		var bar strings.Builder
+		for i := 0; i <= 100; i += 10 {
+			fmt.Fprintf(&bar, "\r\x1b[Kprogress %d%%", i)
+		}
+		lines, _ := read(bar.String()+"\nabcdef\rXY\nend\r\n", LineLimit{Max: 32, Mode: LongLinesSplit})
+		assert.Equal(t, []string{"progress 100%", "XYcdef", "end"}, lines)
+	})
+}
+
+func TestLineReader_Redact(t *testing.T) {
+	redactor := redact.NewRedactor(config.RedactRules{{Name: "token", Pattern: `token=[a-z0-9]+`}})
+
+	read := func(input string, limit LineLimit) ([]string, map[string]int64) {
+		counts := map[string]int64{}
+		reader := newLineReader(strings.NewReader(input), limit)
+		reader.redact = func(line []byte, n int) ([]byte, int) {
+			return redactor.RedactBefore(line, n, counts)
+		}
+		var lines []string
+		reader.read(func(line []byte) {
+			lines = append(lines, string(line))
+		})
+		return lines, counts
+	}
+	secret := "token=" + strings.Repeat("s3cr3t", 10) + " "
+
+	tests := []struct {
+		name  string
+		input string
+		limit LineLimit
+		want  string // lines joined without the split markers
+	}{
+		{
+			name:  "secret crossing a split",
+			input: strings.Repeat("x", 10) + secret + "\n",
+			limit: LineLimit{Max: 16, Mode: LongLinesSplit},
+			want:  strings.Repeat("x", 10) + "[REDACTED] ",
+		},
+		{
+			name:  "secret crossing a split of a line longer than the window",
+			input: strings.Repeat("x", RedactWindow+10) + secret + strings.Repeat("y", RedactWindow) + "\n",
+			limit: LineLimit{Max: 16, Mode: LongLinesSplit},
+			want:  strings.Repeat("x", RedactWindow+10) + "[REDACTED] " + strings.Repeat("y", RedactWindow),
+		},
+		{
+			name:  "secret crossing the truncation",
+			input: strings.Repeat("x", 10) + secret + strings.Repeat("y", RedactWindow) + "\n",
+			limit: LineLimit{Max: 16, Mode: LongLinesTruncate},
+			want:  strings.Repeat("x", 10) + "[REDACTED]" + fmt.Sprintf(lineTruncatedMarker, RedactWindow+1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, counts := read(tt.input, tt.limit)
+			for _, line := range lines {
+				assert.NotContains(t, line, "s3cr")
+				// a part ends after the replacement of a secret crossing the cut
+				line, _, _ = strings.Cut(strings.TrimSuffix(line, LineSplitMarker), " [... ")
+				assert.LessOrEqual(t, len(line), tt.limit.Max+len(redact.DefaultReplacement))
+			}
+			assert.Equal(t, tt.want, strings.ReplaceAll(strings.Join(lines, ""), LineSplitMarker, ""))
+			assert.Equal(t, int64(1), counts["token"])
+		})
+	}
+}
+
+func TestValidateMaliciousCommand_ValidatorMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	findings, ok, err := ValidateMaliciousCommand("echo hello")
+	assert.ErrorContains(t, err, "failed to run shellcheck")
+	assert.False(t, ok)
+	assert.Empty(t, findings)
+}
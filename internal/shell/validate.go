@@ -1,6 +1,7 @@
 package shell
 
 import (
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -8,7 +9,9 @@ import (
 	"github.com/mattn/go-shellwords"
 )
 
-func ValidateMaliciousCommand(command string) (string, bool) {
+// ValidateMaliciousCommand runs shellcheck on the command, it returns the findings and whether there are none.
+// It returns an error when shellcheck can't run, e.g. when it isn't installed.
+func ValidateMaliciousCommand(command string) (string, bool, error) {
 	cmd := exec.Command("shellcheck", "-S", "warning", "-")
 	cmd.Stdin = strings.NewReader(
 		fmt.Sprintf(`#!/bin/bash
@@ -16,10 +19,16 @@ func ValidateMaliciousCommand(command string) (string, bool) {
 `, command),
 	)
 	output, err := cmd.CombinedOutput()
+
+	// shellcheck exits with 1 when it reports findings, other codes are failures
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return string(output), false, nil
+	}
 	if err != nil {
-		return string(output), false
+		return "", false, fmt.Errorf("failed to run shellcheck: %w: %s", err, strings.TrimSpace(string(output)))
 	}
-	return string(output), len(output) == 0
+	return string(output), len(output) == 0, nil
 }
 
 func ParseCommand(command string) ([]string, error) {
@@ -1,55 +1,130 @@
 package sse
 
 import (
-	"bufio"
 	"context"
-	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const CLIENT_PING_INTERVAL = 1 * time.Second
+
 type Client struct {
-	ID     string
-	Buffer *bufio.Writer
-	ctx    context.Context
-	cancel context.CancelFunc
+	ID          string
+	Writer      Writer
+	Filter      *Filter // set by the manager, see SseManager.Subscribe
+	ConnectedAt time.Time
+
+	subscribed bool // the client receives no event until it subscribes, set by the manager
+	queue      *queue
+	// written before the queued events: the replayed events, a resync if some are missing, then the connect event
+	backlog   []*event
+	resync    bool
+	connectID string
+	sent      atomic.Uint64
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// ClientStats are the counters of a client, dropped and coalesced events are counted once its queue is full
+type ClientStats struct {
+	ID          string
+	ConnectedAt time.Time
+	Queued      int
+	Sent        uint64
+	Dropped     uint64
+	Coalesced   uint64
 }
 
-func NewClient(buffer *bufio.Writer) *Client {
+func NewClient(writer Writer, filter *Filter, queueSize int, policy string) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Client{
-		ID:     uuid.New().String(),
-		Buffer: buffer,
-		ctx:    ctx,
-		cancel: cancel,
+		ID:          uuid.New().String(),
+		Writer:      writer,
+		Filter:      filter,
+		subscribed:  true,
+		ConnectedAt: time.Now(),
+		queue:       newQueue(queueSize, policy),
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 }
 
-func (c *Client) Write(data string) error {
-	c.Buffer.WriteString(data)
-	return c.Buffer.Flush()
+// writeQueued writes the queued events, preceded by a resync event if some were dropped since the last write
+func (c *Client) writeQueued() error {
+	events, dropped := c.queue.take()
+	if dropped > 0 {
+		if err := c.Writer.Resync(dropped); err != nil {
+			return err
+		}
+	}
+	if err := c.writeEvents(events); err != nil {
+		return err
+	}
+	return c.Writer.Flush()
 }
 
-func (c *Client) Ping() error {
-	_, err := fmt.Fprintf(c.Buffer, "data: {\"ping\": \"pong\"}\n\n")
-	return err
+func (c *Client) writeEvents(events []*event) error {
+	for _, e := range events {
+		if err := c.Writer.Event(e.eventID, e.data); err != nil {
+			return err
+		}
+		c.sent.Add(1)
+	}
+	return nil
+}
+
+// writeBacklog writes the events sent before the queued events
+func (c *Client) writeBacklog() error {
+	if err := c.writeEvents(c.backlog); err != nil {
+		return err
+	}
+	c.backlog = nil
+	if c.resync {
+		if err := c.Writer.Resync(0); err != nil {
+			return err
+		}
+	}
+	if err := c.Writer.Connect(c.connectID); err != nil {
+		return err
+	}
+	return c.Writer.Flush()
 }
 
 func (c *Client) Cancel() {
 	c.cancel()
 }
 
+// Done is closed once the client is cancelled
+func (c *Client) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+func (c *Client) Stats() *ClientStats {
+	queued, dropped, coalesced := c.queue.stats()
+	return &ClientStats{ID: c.ID, ConnectedAt: c.ConnectedAt, Queued: queued, Sent: c.sent.Load(), Dropped: dropped, Coalesced: coalesced}
+}
+
+// Wait is the writer of the client: it writes the events as they are queued and pings the client, until the client
+// disconnects, it is disconnected as a slow client or the manager stops. Only Wait writes the events of the client.
 func (c *Client) Wait() {
-	ticker := time.NewTicker(1 * time.Second)
+	if err := c.writeBacklog(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(CLIENT_PING_INTERVAL)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-c.ctx.Done():
 			return
+		case <-c.queue.ready:
+			if err := c.writeQueued(); err != nil {
+				return
+			}
 		case <-ticker.C:
-			err := c.Ping()
-			if err != nil {
+			if err := c.Writer.Ping(); err != nil {
 				return
 			}
 		}
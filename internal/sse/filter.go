@@ -0,0 +1,120 @@
+package sse
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	"github.com/fattymango/px-take-home/model"
+)
+
+var (
+	EventType_name = map[EventType]string{
+		MsgTypeTaskStatus: "status",
+		MsgTypeLog:        "log",
+	}
+	EventType_value = map[string]EventType{
+		"status": MsgTypeTaskStatus,
+		"log":    MsgTypeLog,
+	}
+)
+
+// Filter is the subscription of a client, an event is sent to it only if it matches every field of the filter.
+// Empty fields match every event, Statuses only applies to status events.
+type Filter struct {
+	TaskIDs  []uint64
+	Types    []EventType
+	Statuses []model.TaskStatus
+}
+
+// NewFilter returns the filter of the given tasks, event types (status, log) and statuses, empty values match every event
+func NewFilter(taskIDs []uint64, types, statuses []string) (*Filter, error) {
+	filter := &Filter{TaskIDs: taskIDs}
+
+	for _, value := range types {
+		event, ok := EventType_value[value]
+		if !ok {
+			return nil, fmt.Errorf("invalid type %q, must be status or log", value)
+		}
+		filter.Types = append(filter.Types, event)
+	}
+
+	for _, value := range statuses {
+		status, ok := model.TaskStatus_value[value]
+		if !ok {
+			return nil, fmt.Errorf("invalid status %q", value)
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+
+	return filter, nil
+}
+
+func (f *Filter) match(event EventType, taskID uint64) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Types) > 0 && !slices.Contains(f.Types, event) {
+		return false
+	}
+	return len(f.TaskIDs) == 0 || slices.Contains(f.TaskIDs, taskID)
+}
+
+// MatchTaskStatus reports whether the status update is sent to the client
+func (f *Filter) MatchTaskStatus(msg *eventbus.TaskMsg) bool {
+	if !f.match(MsgTypeTaskStatus, msg.TaskID) {
+		return false
+	}
+	return f == nil || len(f.Statuses) == 0 || slices.Contains(f.Statuses, msg.Status)
+}
+
+// MatchLog reports whether the log line is sent to the client
+func (f *Filter) MatchLog(msg *eventbus.LogMsg) bool {
+	return f.match(MsgTypeLog, msg.TaskID)
+}
+
+// Match reports whether a message of the manager is sent to the client
+func (f *Filter) Match(msg *Msg) bool {
+	switch value := msg.Value.(type) {
+	case *eventbus.TaskMsg:
+		return f.MatchTaskStatus(value)
+	case *eventbus.LogMsg:
+		return f.MatchLog(value)
+	}
+	return false
+}
+
+// AddTasks returns a copy of the filter also matching the events of the tasks, without tasks it matches every task
+func (f *Filter) AddTasks(taskIDs []uint64) *Filter {
+	added := f.clone()
+	if len(taskIDs) == 0 || len(added.TaskIDs) == 0 {
+		added.TaskIDs = nil
+		return added
+	}
+	for _, id := range taskIDs {
+		if !slices.Contains(added.TaskIDs, id) {
+			added.TaskIDs = append(added.TaskIDs, id)
+		}
+	}
+	return added
+}
+
+// RemoveTasks returns a copy of the filter no longer matching the events of the tasks, its TaskIDs are empty once
+// no task is left. The tasks can't be removed from a filter matching every task.
+func (f *Filter) RemoveTasks(taskIDs []uint64) (*Filter, error) {
+	removed := f.clone()
+	if len(removed.TaskIDs) == 0 {
+		return nil, fmt.Errorf("subscribed to every task, tasks can't be removed")
+	}
+	removed.TaskIDs = slices.DeleteFunc(removed.TaskIDs, func(id uint64) bool {
+		return slices.Contains(taskIDs, id)
+	})
+	return removed, nil
+}
+
+func (f *Filter) clone() *Filter {
+	if f == nil {
+		return &Filter{}
+	}
+	return &Filter{TaskIDs: slices.Clone(f.TaskIDs), Types: slices.Clone(f.Types), Statuses: slices.Clone(f.Statuses)}
+}
@@ -0,0 +1,84 @@
+package sse
+
+import (
+	"testing"
+
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	completed := &eventbus.TaskMsg{TaskID: 1, Status: model.TaskStatus_Completed}
+	running := &eventbus.TaskMsg{TaskID: 2, Status: model.TaskStatus_Running}
+	log1 := &eventbus.LogMsg{TaskID: 1, LineNumber: 1}
+	log2 := &eventbus.LogMsg{TaskID: 2, LineNumber: 1}
+
+	tests := []struct {
+		name   string
+		filter *Filter
+		want   []bool // completed, running, log1, log2
+	}{
+		{"Nil", nil, []bool{true, true, true, true}},
+		{"Empty", &Filter{}, []bool{true, true, true, true}},
+		{"TaskIDs", &Filter{TaskIDs: []uint64{1}}, []bool{true, false, true, false}},
+		{"Types", &Filter{Types: []EventType{MsgTypeTaskStatus}}, []bool{true, true, false, false}},
+		{"Statuses", &Filter{Statuses: []model.TaskStatus{model.TaskStatus_Completed}}, []bool{true, false, true, true}},
+		{"All", &Filter{TaskIDs: []uint64{2}, Types: []EventType{MsgTypeLog}, Statuses: []model.TaskStatus{model.TaskStatus_Running}}, []bool{false, false, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []bool{tt.filter.MatchTaskStatus(completed), tt.filter.MatchTaskStatus(running), tt.filter.MatchLog(log1), tt.filter.MatchLog(log2)}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		types    []string
+		statuses []string
+		want     *Filter
+		wantErr  string
+	}{
+		{name: "Empty", want: &Filter{TaskIDs: []uint64{1}}},
+		{name: "Values", types: []string{"log", "status"}, statuses: []string{"completed"}, want: &Filter{TaskIDs: []uint64{1}, Types: []EventType{MsgTypeLog, MsgTypeTaskStatus}, Statuses: []model.TaskStatus{model.TaskStatus_Completed}}},
+		{name: "InvalidType", types: []string{"stdout"}, wantErr: `invalid type "stdout"`},
+		{name: "InvalidStatus", statuses: []string{"done"}, wantErr: `invalid status "done"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewFilter([]uint64{1}, tt.types, tt.statuses)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, filter)
+		})
+	}
+}
+
+func TestFilter_Tasks(t *testing.T) {
+	filter := &Filter{TaskIDs: []uint64{1}, Types: []EventType{MsgTypeLog}}
+
+	added := filter.AddTasks([]uint64{2, 1, 3})
+	assert.Equal(t, []uint64{1, 2, 3}, added.TaskIDs)
+	assert.Equal(t, []EventType{MsgTypeLog}, added.Types)
+	assert.Equal(t, []uint64{1}, filter.TaskIDs, "the filter is copied")
+	assert.Nil(t, filter.AddTasks(nil).TaskIDs, "without tasks every task is matched")
+	assert.Nil(t, (&Filter{}).AddTasks([]uint64{1}).TaskIDs, "a filter matching every task keeps matching them")
+
+	removed, err := added.RemoveTasks([]uint64{1, 3, 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{2}, removed.TaskIDs)
+	assert.Equal(t, []uint64{1, 2, 3}, added.TaskIDs, "the filter is copied")
+
+	removed, err = removed.RemoveTasks([]uint64{2})
+	assert.NoError(t, err)
+	assert.Empty(t, removed.TaskIDs)
+
+	_, err = (&Filter{}).RemoveTasks([]uint64{1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package sse
+
+import (
+	"context"
+
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	"github.com/google/uuid"
+)
+
+const (
+	FOLLOW_LOG_BUF_SIZE    = 1000
+	FOLLOW_STATUS_BUF_SIZE = 16
+)
+
+// Follower receives the live logs and status updates of a single task.
+// Logs are dropped when the follower falls behind, the line numbers let it read the missing lines from the log store.
+// Missed is signaled when the SSE manager missed events of the bus, the follower reads the status of its task.
+type Follower struct {
+	ID     string
+	TaskID uint64
+	Logs   chan *eventbus.LogMsg
+	Status chan *eventbus.TaskMsg
+	Missed chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newFollower(taskID uint64) *Follower {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Follower{
+		ID:     uuid.New().String(),
+		TaskID: taskID,
+		Logs:   make(chan *eventbus.LogMsg, FOLLOW_LOG_BUF_SIZE),
+		Status: make(chan *eventbus.TaskMsg, FOLLOW_STATUS_BUF_SIZE),
+		Missed: make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Done is closed when the SSE manager stops
+func (f *Follower) Done() <-chan struct{} {
+	return f.ctx.Done()
+}
+
+// Follow registers a follower of the task, it must be removed with Unfollow
+func (s *SseManager) Follow(taskID uint64) *Follower {
+	follower := newFollower(taskID)
+	s.followers.Store(follower.ID, follower)
+	return follower
+}
+
+func (s *SseManager) Unfollow(follower *Follower) {
+	s.followers.Delete(follower.ID)
+	follower.cancel()
+}
+
+func (s *SseManager) followLog(msg *eventbus.LogMsg) {
+	s.followers.Range(func(key, value interface{}) bool {
+		follower := value.(*Follower)
+		if follower.TaskID != msg.TaskID {
+			return true
+		}
+		select {
+		case follower.Logs <- msg:
+		default:
+		}
+		return true
+	})
+}
+
+func (s *SseManager) followTaskStatus(msg *eventbus.TaskMsg) {
+	s.followers.Range(func(key, value interface{}) bool {
+		follower := value.(*Follower)
+		if follower.TaskID != msg.TaskID {
+			return true
+		}
+		select {
+		case follower.Status <- msg:
+		default:
+			s.logger.Errorf("follower %s of task #%d missed a status update", follower.ID, msg.TaskID)
+		}
+		return true
+	})
+}
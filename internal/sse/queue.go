@@ -0,0 +1,150 @@
+package sse
+
+import (
+	"sync"
+)
+
+// Policies for the events of slow clients, whose queue is full
+const (
+	PolicyDropOldest = "drop_oldest" // the oldest queued event is dropped
+	PolicyDisconnect = "disconnect"  // the client is disconnected, it reconnects and resumes with Last-Event-ID
+	PolicyCoalesce   = "coalesce"    // status updates replace the queued status update of their task, log lines are dropped
+)
+
+type pushResult uint8
+
+const (
+	pushQueued pushResult = iota
+	pushDropped
+	pushCoalesced
+	pushFull // the client must be disconnected
+)
+
+// queue is the bounded queue of the events of a client, filled by the manager without blocking
+// and emptied by the writer of the client
+type queue struct {
+	mu        sync.Mutex
+	events    []*event
+	size      int
+	policy    string
+	pending   uint64 // events dropped since the last take
+	dropped   uint64
+	coalesced uint64
+	ready     chan struct{} // signaled when events are queued
+}
+
+func newQueue(size int, policy string) *queue {
+	return &queue{size: size, policy: policy, ready: make(chan struct{}, 1)}
+}
+
+func (q *queue) push(e *event) pushResult {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.events) < q.size {
+		q.append(e)
+		return pushQueued
+	}
+
+	switch q.policy {
+	case PolicyDisconnect:
+		return pushFull
+
+	case PolicyCoalesce:
+		if e.msg.Event == MsgTypeLog {
+			q.drop()
+			return pushDropped
+		}
+		// Clients only need the last status of a task
+		if i := q.lastStatus(e.msg.TaskID); i >= 0 {
+			q.remove(i)
+			q.coalesced++
+			q.append(e)
+			return pushCoalesced
+		}
+		// Status updates are kept over log lines
+		if i := q.firstLog(); i >= 0 {
+			q.remove(i)
+		} else {
+			q.remove(0)
+		}
+
+	default:
+		q.remove(0)
+	}
+
+	q.drop()
+	q.append(e)
+	return pushDropped
+}
+
+func (q *queue) append(e *event) {
+	q.events = append(q.events, e)
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// remove removes the queued event at i, keeping the order of the others
+func (q *queue) remove(i int) {
+	if i == 0 {
+		q.events = q.events[1:]
+		return
+	}
+	q.events = append(q.events[:i], q.events[i+1:]...)
+}
+
+func (q *queue) drop() {
+	q.pending++
+	q.dropped++
+}
+
+func (q *queue) lastStatus(taskID uint64) int {
+	for i := len(q.events) - 1; i >= 0; i-- {
+		if q.events[i].msg.Event == MsgTypeTaskStatus && q.events[i].msg.TaskID == taskID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *queue) firstLog() int {
+	for i, e := range q.events {
+		if e.msg.Event == MsgTypeLog {
+			return i
+		}
+	}
+	return -1
+}
+
+// missed drops the queued events for a resync, the client missed events published after them and reloads its state
+func (q *queue) missed(n uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dropped := n + uint64(len(q.events))
+	q.pending += dropped
+	q.dropped += dropped
+	q.events = nil
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the queued events and the number of events dropped since the last take
+func (q *queue) take() ([]*event, uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	events, dropped := q.events, q.pending
+	q.events, q.pending = nil, 0
+	return events, dropped
+}
+
+func (q *queue) stats() (queued int, dropped, coalesced uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events), q.dropped, q.coalesced
+}
@@ -0,0 +1,82 @@
+package sse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	var id uint64
+	status := func(taskID uint64) *event {
+		id++
+		return &event{id: id, msg: &Msg{Event: MsgTypeTaskStatus, TaskID: taskID}}
+	}
+	log := func(taskID uint64) *event {
+		id++
+		return &event{id: id, msg: &Msg{Event: MsgTypeLog, TaskID: taskID}}
+	}
+	ids := func(q *queue) []uint64 {
+		events, _ := q.take()
+		var ids []uint64
+		for _, e := range events {
+			ids = append(ids, e.id)
+		}
+		return ids
+	}
+
+	t.Run("DropOldest", func(t *testing.T) {
+		id = 0
+		q := newQueue(2, PolicyDropOldest)
+		assert.Equal(t, pushQueued, q.push(log(1)))
+		assert.Equal(t, pushQueued, q.push(log(1)))
+		assert.Equal(t, pushDropped, q.push(status(1)))
+		_, dropped, _ := q.stats()
+		assert.Equal(t, uint64(1), dropped)
+		assert.Equal(t, []uint64{2, 3}, ids(q))
+
+		// The dropped events are reported once
+		q.push(log(1))
+		_, pending := q.take()
+		assert.Equal(t, uint64(0), pending)
+	})
+
+	t.Run("Missed", func(t *testing.T) {
+		// The queued events are dropped with the missed ones, the client reloads its state
+		q := newQueue(3, PolicyDropOldest)
+		q.push(log(1))
+		q.push(status(1))
+		q.missed(3)
+		_, dropped, _ := q.stats()
+		assert.Equal(t, uint64(5), dropped)
+
+		events, pending := q.take()
+		assert.Empty(t, events)
+		assert.Equal(t, uint64(5), pending)
+	})
+
+	t.Run("Disconnect", func(t *testing.T) {
+		q := newQueue(1, PolicyDisconnect)
+		assert.Equal(t, pushQueued, q.push(log(1)))
+		assert.Equal(t, pushFull, q.push(log(1)))
+	})
+
+	t.Run("Coalesce", func(t *testing.T) {
+		id = 0
+		q := newQueue(3, PolicyCoalesce)
+		q.push(status(1))                                 // 1
+		q.push(log(1))                                    // 2
+		q.push(log(2))                                    // 3
+		assert.Equal(t, pushDropped, q.push(log(1)))      // 4, dropped
+		assert.Equal(t, pushCoalesced, q.push(status(1))) // 5, replaces 1
+		assert.Equal(t, pushDropped, q.push(status(2)))   // 6, replaces the oldest log line
+		_, dropped, coalesced := q.stats()
+		assert.Equal(t, uint64(2), dropped)
+		assert.Equal(t, uint64(1), coalesced)
+
+		events, pending := q.take()
+		assert.Equal(t, uint64(2), pending)
+		assert.Len(t, events, 3)
+		assert.Equal(t, []uint64{3, 5, 6}, []uint64{events[0].id, events[1].id, events[2].id})
+	})
+}
@@ -0,0 +1,129 @@
+package sse
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// event is a message sent to the clients, kept encoded for replay
+type event struct {
+	id      uint64
+	eventID string // id sent to the clients, see formatEventID
+	msg     *Msg
+	data    []byte // JSON encoded msg
+}
+
+// taskEvents is a ring of the last events of a task, it grows up to its size as most tasks only have a few events
+type taskEvents struct {
+	events  []*event
+	head    int    // index of the oldest event once the ring is full
+	dropped uint64 // id of the last event dropped from the ring
+}
+
+func (t *taskEvents) add(e *event, size int) {
+	if len(t.events) < size {
+		t.events = append(t.events, e)
+		return
+	}
+	t.dropped = t.events[t.head].id
+	t.events[t.head] = e
+	t.head = (t.head + 1) % len(t.events)
+}
+
+// all returns the events in order
+func (t *taskEvents) all() []*event {
+	return append(t.events[t.head:len(t.events):len(t.events)], t.events[:t.head]...)
+}
+
+func (t *taskEvents) last() uint64 {
+	if len(t.events) == 0 {
+		return t.dropped
+	}
+	return t.events[(t.head+len(t.events)-1)%len(t.events)].id
+}
+
+// replayBuffer keeps the last events of the most recently active tasks, so reconnecting clients
+// get the events they missed. It is not safe for concurrent use.
+type replayBuffer struct {
+	size    int // events kept per task
+	tasks   int // tasks kept
+	buffers map[uint64]*taskEvents
+	removed uint64 // highest id of the events of the tasks no longer kept
+}
+
+func newReplayBuffer(size, tasks int) *replayBuffer {
+	return &replayBuffer{size: size, tasks: tasks, buffers: make(map[uint64]*taskEvents)}
+}
+
+func (r *replayBuffer) add(e *event) {
+	if r.size == 0 || r.tasks == 0 {
+		r.removed = e.id
+		return
+	}
+
+	buffer, ok := r.buffers[e.msg.TaskID]
+	if !ok {
+		if len(r.buffers) == r.tasks {
+			r.removeOldest()
+		}
+		buffer = &taskEvents{}
+		r.buffers[e.msg.TaskID] = buffer
+	}
+	buffer.add(e, r.size)
+}
+
+// removeOldest removes the events of the task whose last event is the oldest
+func (r *replayBuffer) removeOldest() {
+	var oldest, last uint64
+	for taskID, buffer := range r.buffers {
+		if id := buffer.last(); last == 0 || id < last {
+			oldest, last = taskID, id
+		}
+	}
+	r.removed = max(r.removed, last)
+	delete(r.buffers, oldest)
+}
+
+// since returns the events after lastID that match the filter, in order. complete is false when some of
+// the events after lastID are no longer kept.
+func (r *replayBuffer) since(lastID uint64, filter *Filter) ([]*event, bool) {
+	complete := lastID >= r.removed
+
+	var events []*event
+	for taskID, buffer := range r.buffers {
+		if filter != nil && len(filter.TaskIDs) > 0 && !slices.Contains(filter.TaskIDs, taskID) {
+			continue
+		}
+		if lastID < buffer.dropped {
+			complete = false
+		}
+		for _, e := range buffer.all() {
+			if e.id > lastID && filter.Match(e.msg) {
+				events = append(events, e)
+			}
+		}
+	}
+
+	slices.SortFunc(events, func(a, b *event) int {
+		return cmp.Compare(a.id, b.id)
+	})
+	return events, complete
+}
+
+// formatEventID returns the id of an event, the epoch tells the ids of this process from the ids of a previous one
+func formatEventID(epoch string, id uint64) string {
+	return fmt.Sprintf("%s-%d", epoch, id)
+}
+
+// parseEventID returns the sequence number of an event id of the epoch
+func parseEventID(epoch, s string) (uint64, bool) {
+	eventEpoch, seq, ok := strings.Cut(s, "-")
+	if !ok || eventEpoch != epoch {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(seq, 10, 64)
+	return id, err == nil
+}
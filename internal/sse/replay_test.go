@@ -0,0 +1,82 @@
+package sse
+
+import (
+	"testing"
+
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayBuffer(t *testing.T) {
+	r := newReplayBuffer(3, 2)
+	var id uint64
+	add := func(taskID uint64, eventType EventType) {
+		id++
+		msg := &Msg{Event: eventType, TaskID: taskID, Value: &eventbus.LogMsg{TaskID: taskID}}
+		if eventType == MsgTypeTaskStatus {
+			msg.Value = &eventbus.TaskMsg{TaskID: taskID}
+		}
+		r.add(&event{id: id, msg: msg})
+	}
+	ids := func(events []*event) []uint64 {
+		var ids []uint64
+		for _, e := range events {
+			ids = append(ids, e.id)
+		}
+		return ids
+	}
+
+	add(1, MsgTypeTaskStatus) // 1
+	add(2, MsgTypeTaskStatus) // 2
+	add(1, MsgTypeLog)        // 3
+	add(2, MsgTypeLog)        // 4
+	add(1, MsgTypeLog)        // 5
+
+	events, complete := r.since(0, nil)
+	assert.True(t, complete)
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5}, ids(events))
+
+	events, complete = r.since(2, &Filter{TaskIDs: []uint64{1}})
+	assert.True(t, complete)
+	assert.Equal(t, []uint64{3, 5}, ids(events))
+
+	events, _ = r.since(0, &Filter{Types: []EventType{MsgTypeTaskStatus}})
+	assert.Equal(t, []uint64{1, 2}, ids(events))
+
+	t.Run("Dropped", func(t *testing.T) {
+		add(1, MsgTypeLog) // 6, drops 1
+		events, complete := r.since(0, nil)
+		assert.False(t, complete)
+		assert.Equal(t, []uint64{2, 3, 4, 5, 6}, ids(events))
+
+		events, complete = r.since(1, nil)
+		assert.True(t, complete)
+		assert.Len(t, events, 5)
+
+		// The events of task 2 are still complete
+		_, complete = r.since(0, &Filter{TaskIDs: []uint64{2}})
+		assert.True(t, complete)
+	})
+
+	t.Run("RemovedTask", func(t *testing.T) {
+		add(3, MsgTypeLog) // 7, removes task 2 whose last event is the oldest
+		events, complete := r.since(3, nil)
+		assert.False(t, complete)
+		assert.Equal(t, []uint64{5, 6, 7}, ids(events))
+
+		events, complete = r.since(4, nil)
+		assert.True(t, complete)
+		assert.Equal(t, []uint64{5, 6, 7}, ids(events))
+	})
+}
+
+func TestParseEventID(t *testing.T) {
+	id, ok := parseEventID("abc", formatEventID("abc", 42))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(42), id)
+
+	_, ok = parseEventID("abc", formatEventID("def", 42))
+	assert.False(t, ok)
+	_, ok = parseEventID("abc", "abc-x")
+	assert.False(t, ok)
+}
@@ -1,13 +1,14 @@
 package sse
 
 import (
-	"bufio"
 	"encoding/json"
-	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fattymango/px-take-home/config"
-	"github.com/fattymango/px-take-home/internal/task"
+	"github.com/fattymango/px-take-home/internal/eventbus"
 	"github.com/fattymango/px-take-home/pkg/logger"
 )
 
@@ -25,94 +26,250 @@ type Msg struct {
 }
 
 type SseManager struct {
-	config     *config.Config
-	logger     *logger.Logger
-	taskStream <-chan *task.TaskMsg
-	logStream  <-chan *task.LogMsg
-	clients    sync.Map
+	config    *config.Config
+	logger    *logger.Logger
+	events    *eventbus.Subscriber
+	clients   sync.Map
+	followers sync.Map
+
+	// mu orders the events sent to the clients with the replay of the events missed by reconnecting clients
+	mu     sync.Mutex
+	epoch  string
+	lastID uint64
+	replay *replayBuffer
+	// id of the last event sent before the events missed by the manager, the events after it can't be replayed
+	gapID uint64
+
+	// Totals of the slow clients, including the disconnected ones
+	dropped      atomic.Uint64
+	coalesced    atomic.Uint64
+	disconnected atomic.Uint64
+	// events of the bus missed by the manager
+	missed atomic.Uint64
+}
+
+// Stats are the counters of the clients of the manager
+type Stats struct {
+	Policy       string
+	QueueSize    int
+	Clients      []*ClientStats
+	Dropped      uint64
+	Coalesced    uint64
+	Disconnected uint64 // slow clients disconnected by the disconnect policy
+	Missed       uint64 // events of the event bus missed by the manager
 }
 
-func NewSseManager(config *config.Config, logger *logger.Logger, taskStream <-chan *task.TaskMsg, logStream <-chan *task.LogMsg) *SseManager {
+func NewSseManager(config *config.Config, logger *logger.Logger, bus *eventbus.Bus) *SseManager {
 	return &SseManager{
-		config:     config,
-		logger:     logger,
-		taskStream: taskStream,
-		logStream:  logStream,
-		clients:    sync.Map{},
+		config:    config,
+		logger:    logger,
+		events:    bus.Subscribe("sse"),
+		clients:   sync.Map{},
+		followers: sync.Map{},
+		epoch:     strconv.FormatInt(time.Now().UnixNano(), 36),
+		replay:    newReplayBuffer(config.SSE.ReplaySize, config.SSE.ReplayTasks),
 	}
 }
 
+// Start sends the events of the bus to the clients until the bus is closed.
+// Events the manager missed because its buffer was full were published after the events in the buffer,
+// once those are sent every client gets a resync, see resync.
 func (s *SseManager) Start() {
 	go func() {
 		defer s.logger.Info("SSE manager stopped")
-		for s.taskStream != nil || s.logStream != nil {
-			select {
-			case msg, ok := <-s.taskStream:
-				if !ok {
-					s.logger.Debug("Task stream closed")
-					s.taskStream = nil
-					continue
-				}
-				s.sendTaskStatus(msg)
-			case msg, ok := <-s.logStream:
-				if !ok {
-					s.logger.Debug("Log stream closed")
-					s.logStream = nil
-					continue
-				}
-				s.sendLog(msg)
+		var dropped, missed uint64
+		before := 0 // events to send before the resync
+		for event := range s.events.Events() {
+			if event.Log != nil {
+				s.sendLog(event.Log)
+			} else {
+				s.sendTaskStatus(event.Task)
+			}
+
+			if d := s.events.Dropped(); d != dropped {
+				missed += d - dropped
+				dropped = d
+				before = len(s.events.Events())
+			} else if before > 0 {
+				before--
+			}
+			if missed > 0 && before == 0 {
+				s.resync(missed)
+				missed = 0
 			}
 		}
+		s.logger.Debug("Event bus closed")
 	}()
 }
 
+// resync tells every subscribed client it missed events, their queued events are dropped since they reload
+// their state, and wakes the followers to read the status of their task
+func (s *SseManager) resync(missed uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logger.Warnf("SSE manager missed %d events of the event bus, sending a resync to every client", missed)
+	s.missed.Add(missed)
+	s.gapID = s.lastID
+
+	s.clients.Range(func(key, value interface{}) bool {
+		client := value.(*Client)
+		if client.subscribed {
+			client.queue.missed(missed)
+		}
+		return true
+	})
+	s.followers.Range(func(key, value interface{}) bool {
+		select {
+		case value.(*Follower).Missed <- struct{}{}:
+		default:
+		}
+		return true
+	})
+}
+
 func (s *SseManager) Stop() {
 	s.clients.Range(func(key, value interface{}) bool {
 		s.logger.Info("Cancelling client", "client", value.(*Client).ID)
 		value.(*Client).Cancel()
 		return true
 	})
+	s.followers.Range(func(key, value interface{}) bool {
+		value.(*Follower).cancel()
+		return true
+	})
 }
 
-func (s *SseManager) NewSSEClient(buffer *bufio.Writer) *Client {
-	client := NewClient(buffer)
+// AddClient registers a client receiving the events that match the filter, a nil filter receives every event.
+// A client reconnecting with the id of the last event it received first gets the events it missed, followed by
+// a resync event if some of them are no longer kept. The connect event carries the id to resume from.
+// The events are written by the Wait method of the client.
+func (s *SseManager) AddClient(writer Writer, filter *Filter, lastEventID string) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client := NewClient(writer, filter, s.config.SSE.QueueSize, s.config.SSE.SlowClientPolicy)
+	if lastEventID != "" {
+		s.replayTo(client, lastEventID)
+	}
+	client.connectID = formatEventID(s.epoch, s.lastID)
+
 	s.clients.Store(client.ID, client)
 	return client
 }
 
-func (s *SseManager) RemoveSSEClient(id string) {
+// AddUnsubscribedClient registers a client receiving no event until it subscribes, see Subscribe
+func (s *SseManager) AddUnsubscribedClient(writer Writer) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client := NewClient(writer, nil, s.config.SSE.QueueSize, s.config.SSE.SlowClientPolicy)
+	client.subscribed = false
+	client.connectID = formatEventID(s.epoch, s.lastID)
+
+	s.clients.Store(client.ID, client)
+	return client
+}
+
+// replayTo writes the events after lastEventID to the client, the ids of a previous process can't be resumed
+func (s *SseManager) replayTo(client *Client, lastEventID string) {
+	var events []*event
+	lastID, ok := parseEventID(s.epoch, lastEventID)
+	complete := ok && lastID <= s.lastID && lastID >= s.gapID
+	if complete {
+		events, complete = s.replay.since(lastID, client.Filter)
+	}
+
+	client.backlog = append(client.backlog, events...)
+	if !complete {
+		s.logger.Infof("SSE client %s missed events after %s, sending a resync", client.ID, lastEventID)
+		client.resync = true
+	}
+}
+
+func (s *SseManager) RemoveClient(id string) {
 	s.clients.Delete(id)
 }
 
-func (s *SseManager) sendTaskStatus(msg *task.TaskMsg) {
-	sseMessage := s.formatSSEMessage(&Msg{
+// Subscribe replaces the filter of the client, the events sent after it returns match the new filter
+func (s *SseManager) Subscribe(client *Client, filter *Filter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client.Filter = filter
+	client.subscribed = true
+}
+
+// Unsubscribe stops sending events to the client until it subscribes again
+func (s *SseManager) Unsubscribe(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client.subscribed = false
+}
+
+func (s *SseManager) sendTaskStatus(msg *eventbus.TaskMsg) {
+	s.send(&Msg{
 		Event:  MsgTypeTaskStatus,
 		TaskID: msg.TaskID,
 		Value:  msg,
 	})
-
-	s.clients.Range(func(key, value interface{}) bool {
-		client := value.(*Client)
-		client.Write(sseMessage)
-		return true
-	})
+	s.followTaskStatus(msg)
 }
 
-func (s *SseManager) sendLog(msg *task.LogMsg) {
-	sseMessage := s.formatSSEMessage(&Msg{
+func (s *SseManager) sendLog(msg *eventbus.LogMsg) {
+	s.send(&Msg{
 		Event:  MsgTypeLog,
 		TaskID: msg.TaskID,
 		Value:  msg,
 	})
+	s.followLog(msg)
+}
+
+// send gives the message the next event id, keeps it for replay and queues it for the clients it matches.
+// It never blocks on a client, the events of slow clients are handled by the slow client policy.
+func (s *SseManager) send(msg *Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	data, _ := json.Marshal(msg)
+	e := &event{id: s.lastID, eventID: formatEventID(s.epoch, s.lastID), msg: msg, data: data}
+	s.replay.add(e)
 
 	s.clients.Range(func(key, value interface{}) bool {
 		client := value.(*Client)
-		client.Write(sseMessage)
+		if !client.subscribed || !client.Filter.Match(msg) {
+			return true
+		}
+		switch client.queue.push(e) {
+		case pushDropped:
+			s.dropped.Add(1)
+		case pushCoalesced:
+			s.coalesced.Add(1)
+		case pushFull:
+			s.logger.Warnf("SSE client %s is too slow, disconnecting it", client.ID)
+			s.disconnected.Add(1)
+			s.clients.Delete(client.ID)
+			client.Cancel()
+		}
 		return true
 	})
 }
 
-func (s *SseManager) formatSSEMessage(msg *Msg) string {
-	data, _ := json.Marshal(msg)
-	return fmt.Sprintf("data: %s\n\n", data)
+// Stats returns the counters of the connected clients and the totals of the slow clients
+func (s *SseManager) Stats() *Stats {
+	stats := &Stats{
+		Policy:       s.config.SSE.SlowClientPolicy,
+		QueueSize:    s.config.SSE.QueueSize,
+		Dropped:      s.dropped.Load(),
+		Coalesced:    s.coalesced.Load(),
+		Disconnected: s.disconnected.Load(),
+		Missed:       s.missed.Load(),
+	}
+	s.clients.Range(func(key, value interface{}) bool {
+		stats.Clients = append(stats.Clients, value.(*Client).Stats())
+		return true
+	})
+	return stats
 }
@@ -0,0 +1,50 @@
+package sse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSseManager_Missed(t *testing.T) {
+	cfg := &config.Config{
+		EventBus: config.EventBus{BufferSize: 2},
+		SSE:      config.SSE{QueueSize: 100, SlowClientPolicy: PolicyDropOldest, ReplaySize: 100, ReplayTasks: 10},
+	}
+	bus := eventbus.NewBus(cfg, logger.NewTestLogger())
+	manager := NewSseManager(cfg, logger.NewTestLogger(), bus)
+	client := manager.AddClient(nil, nil, "")
+	follower := manager.Follow(1)
+	defer manager.Unfollow(follower)
+
+	// The manager is not reading the bus yet, the events after the first two are missed
+	for i := 0; i < 5; i++ {
+		bus.Publish(eventbus.NewTaskEvent(eventbus.EventTaskStarted, &eventbus.TaskMsg{TaskID: 1, Status: model.TaskStatus_Running}))
+	}
+	manager.Start()
+	defer bus.Close()
+
+	assert.Eventually(t, func() bool { return manager.Stats().Missed == 3 }, time.Second, 10*time.Millisecond)
+
+	// The client gets a resync for the missed events and the two events sent before it
+	events, dropped := client.queue.take()
+	assert.Empty(t, events)
+	assert.Equal(t, uint64(5), dropped)
+
+	select {
+	case <-follower.Missed:
+	default:
+		t.Fatal("follower was not told about the missed events")
+	}
+
+	// Clients reconnecting from before the missed events can't get them from the replay
+	reconnected := manager.AddClient(nil, nil, formatEventID(manager.epoch, 1))
+	assert.True(t, reconnected.resync)
+	reconnected = manager.AddClient(nil, nil, formatEventID(manager.epoch, 2))
+	assert.False(t, reconnected.resync)
+}
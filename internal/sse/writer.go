@@ -0,0 +1,55 @@
+package sse
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// Writer writes the events of a client in the format of its transport, only the writer of the client calls it
+type Writer interface {
+	// Event writes an event, data is the JSON encoded Msg
+	Event(id string, data []byte) error
+	// Connect writes the connect event, id is the id to resume from
+	Connect(id string) error
+	// Resync tells the client it missed dropped events, 0 if their number is unknown
+	Resync(dropped uint64) error
+	Ping() error
+	Flush() error
+}
+
+// SSEWriter writes the events as server sent events
+type SSEWriter struct {
+	buffer *bufio.Writer
+}
+
+func NewSSEWriter(buffer *bufio.Writer) *SSEWriter {
+	return &SSEWriter{buffer: buffer}
+}
+
+func (w *SSEWriter) Event(id string, data []byte) error {
+	_, err := fmt.Fprintf(w.buffer, "id: %s\ndata: %s\n\n", id, data)
+	return err
+}
+
+func (w *SSEWriter) Connect(id string) error {
+	_, err := fmt.Fprintf(w.buffer, "id: %s\nevent: connect\ndata: {\"status\": \"connected\"}\n\n", id)
+	return err
+}
+
+func (w *SSEWriter) Resync(dropped uint64) error {
+	if dropped == 0 {
+		_, err := fmt.Fprintf(w.buffer, "event: resync\ndata: {}\n\n")
+		return err
+	}
+	_, err := fmt.Fprintf(w.buffer, "event: resync\ndata: {\"dropped\": %d}\n\n", dropped)
+	return err
+}
+
+func (w *SSEWriter) Ping() error {
+	fmt.Fprintf(w.buffer, "data: {\"ping\": \"pong\"}\n\n")
+	return w.buffer.Flush()
+}
+
+func (w *SSEWriter) Flush() error {
+	return w.buffer.Flush()
+}
@@ -2,10 +2,15 @@ package task
 
 import (
 	"fmt"
+	"maps"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	logstore "github.com/fattymango/px-take-home/internal/log_store"
+	"github.com/fattymango/px-take-home/internal/redact"
 	"github.com/fattymango/px-take-home/internal/shell"
 	tasklogger "github.com/fattymango/px-take-home/internal/task_logger"
 	"github.com/fattymango/px-take-home/model"
@@ -16,6 +21,7 @@ const (
 	ErrMalformedCommand = "malformed command"
 	ErrMaliciousCommand = "malicious command"
 	ErrFailedToExecute  = "failed to execute command"
+	ErrFailedToValidate = "failed to validate command"
 )
 
 type JobExecutor struct {
@@ -24,28 +30,39 @@ type JobExecutor struct {
 	job    *Job
 
 	taskLogger *tasklogger.TaskLogger
+	// nil until the command is started
+	shell *shell.ShellExecutor
 
-	taskChan  chan<- *JobMsg // channel to send task updates to the task manager
-	logStream chan<- *LogMsg // channel to send logs to the task manager
+	redactor *redact.Redactor
+	// number of redactions per rule, counted by the goroutines reading the output
+	redactions   map[string]int64
+	redactionsMu sync.Mutex
+
+	taskChan chan<- *JobMsg // channel to send task updates to the task manager
+	bus      *eventbus.Bus  // bus to publish the log lines to
 
 	lineNumber atomic.Int64
+	// the log is finalized once, before the terminal status is sent
+	finishOnce sync.Once
 }
 
-func NewJobExecutor(config *config.Config, logger *logger.Logger, job *Job, taskChan chan<- *JobMsg, logStream chan<- *LogMsg) *JobExecutor {
+func NewJobExecutor(config *config.Config, logger *logger.Logger, job *Job, logStore logstore.LogStore, redactor *redact.Redactor, taskChan chan<- *JobMsg, bus *eventbus.Bus) *JobExecutor {
 	return &JobExecutor{
 		config:     config,
 		logger:     logger,
 		job:        job,
+		redactor:   redactor,
+		redactions: make(map[string]int64),
 		taskChan:   taskChan,
-		logStream:  logStream,
-		taskLogger: tasklogger.NewTaskLogger(config, logger, job.task.ID),
+		bus:        bus,
+		taskLogger: tasklogger.NewTaskLogger(config, logger, logStore, job.task.ID),
 		lineNumber: atomic.Int64{},
 	}
 }
 
 func (t *JobExecutor) Execute() error {
 
-	defer t.close()
+	defer t.finish()
 
 	_, err := shell.ParseCommand(t.job.task.Command)
 	if err != nil {
@@ -53,23 +70,42 @@ func (t *JobExecutor) Execute() error {
 		return fmt.Errorf("%s: %s", ErrMalformedCommand, err)
 	}
 
-	if t.config.CMD.Validate {
-		msg, ok := shell.ValidateMaliciousCommand(t.job.task.Command)
+	// Approved tasks were already flagged by the validator and let through by an approver
+	if t.config.CMD.Validate && t.job.task.ReviewDecision != model.ReviewDecision_Approved {
+		msg, ok, err := shell.ValidateMaliciousCommand(t.job.task.Command)
+		if err != nil {
+			t.sendTaskFailed(fmt.Sprintf("%s: %s", ErrFailedToValidate, err), 1)
+			return fmt.Errorf("%s: %w", ErrFailedToValidate, err)
+		}
 		if !ok {
 			t.sendTaskFailed(fmt.Sprintf("%s: %s", ErrMaliciousCommand, msg), 1)
 			return fmt.Errorf("%s: %s", ErrMaliciousCommand, msg)
 		}
 	}
 
-	t.taskLogger.CreateLogFile()
+	if err := t.taskLogger.CreateLogFile(); err != nil {
+		t.sendTaskFailed(fmt.Sprintf("%s: %s", ErrFailedToExecute, err), 1)
+		return fmt.Errorf("%s: %s", ErrFailedToExecute, err)
+	}
 	t.taskLogger.Listen()
+	t.job.setLineMap(t.taskLogger.LineMap)
 
-	executor := shell.NewShellExecutor(t.job.task.Command)
+	executor := shell.NewShellExecutor(t.job.task.Command, shell.LineLimit{Max: t.config.CMD.MaxLineLength, Mode: t.config.CMD.LongLines})
+	t.shell = executor
+	if !t.redactor.Empty() {
+		executor.Redact(t.redact)
+	}
+	if t.job.task.Stdin {
+		executor.OpenStdin()
+	}
 	err = executor.Execute()
 	if err != nil {
 		t.sendTaskFailed(fmt.Sprintf("%s: %s", ErrFailedToExecute, err), 1)
 		return fmt.Errorf("%s: %s", ErrFailedToExecute, err)
 	}
+	if t.job.task.Stdin {
+		t.job.setStdin(executor)
+	}
 
 	t.logger.Infof("executing task #%d: %s, command: %s", t.job.task.ID, t.job.task.Name, t.job.task.Command)
 	t.sendTaskRunning()
@@ -96,8 +132,7 @@ func (t *JobExecutor) Execute() error {
 				t.logger.Debug("cmdStdErrChan channel closed")
 				continue
 			}
-			t.writeStderrLog(line)
-			reason += string(line)
+			reason += string(t.writeStderrLog(line))
 		case line, ok := <-cmdStdOutChan:
 			if !ok {
 				cmdStdOutChan = nil
@@ -133,13 +168,35 @@ func (t *JobExecutor) Execute() error {
 
 	return nil
 }
+
+// finish closes the stdin and finalizes the log, it runs before the terminal status is sent,
+// so a finished task always has a complete log and its output summary
+func (t *JobExecutor) finish() {
+	t.finishOnce.Do(t.close)
+}
+
 func (t *JobExecutor) close() {
 	t.logger.Infof("closing task executor")
+	t.job.setStdin(nil)
 	t.taskLogger.Close()
+	if err := t.taskLogger.Finalize(); err != nil {
+		t.logger.Errorf("failed to finalize task log: %s", err)
+	}
+	// Output is truncated if the log file went over its max size, or a line over the max line length
+	truncated := t.taskLogger.Truncated() || (t.shell != nil && t.shell.Truncated())
+	lines := t.taskLogger.LineMap()
+	// The output of a cancelled command may still be read, the counts are copied
+	t.redactionsMu.Lock()
+	redactions := maps.Clone(t.redactions)
+	t.redactionsMu.Unlock()
+	if len(redactions) > 0 || truncated {
+		t.taskChan <- &JobMsg{op: op_TASK_OUTPUT, taskID: t.job.task.ID, redactions: redactions, truncated: truncated, lines: lines}
+	}
 	t.logger.Infof("task executor closed")
 }
 
 func (t *JobExecutor) sendTaskFailed(reason string, exitCode int) {
+	t.finish()
 	t.job.task.Status = model.TaskStatus_Failed
 	t.job.task.Reason = reason
 	t.job.task.ExitCode = exitCode
@@ -148,6 +205,7 @@ func (t *JobExecutor) sendTaskFailed(reason string, exitCode int) {
 }
 
 func (t *JobExecutor) sendTaskCompleted() {
+	t.finish()
 	t.job.task.Status = model.TaskStatus_Completed
 	t.job.task.ExitCode = 0
 	t.job.task.EndTime = uint64(time.Now().Unix())
@@ -161,6 +219,7 @@ func (t *JobExecutor) sendTaskRunning() {
 }
 
 func (t *JobExecutor) sendTaskCancelled(exitCode int) {
+	t.finish()
 	t.logger.Infof("sending task cancelled")
 	t.job.task.Status = model.TaskStatus_Cancelled
 	t.job.task.EndTime = uint64(time.Now().Unix())
@@ -169,11 +228,25 @@ func (t *JobExecutor) sendTaskCancelled(exitCode int) {
 }
 
 func (t *JobExecutor) writeStdoutLog(line []byte) {
-	t.taskLogger.Write(append(line, '\n'))
-	t.logStream <- &LogMsg{TaskID: t.job.task.ID, LineNumber: int(t.lineNumber.Add(1)), Line: string(line)}
+	t.writeLog(model.LogStream_Stdout, line)
+}
+
+// writeStderrLog returns the line, so it can be used as the failure reason
+func (t *JobExecutor) writeStderrLog(line []byte) []byte {
+	return t.writeLog(model.LogStream_Stderr, line)
+}
+
+// writeLog writes a line of the output, lines are already redacted by the shell executor
+func (t *JobExecutor) writeLog(stream model.LogStream, line []byte) []byte {
+	now := time.Now()
+	t.taskLogger.Write(stream, now, append(line, '\n'))
+	t.bus.Publish(eventbus.NewLogEvent(&eventbus.LogMsg{TaskID: t.job.task.ID, LineNumber: int(t.lineNumber.Add(1)), Stream: stream, Timestamp: now.UnixNano(), Line: string(line)}))
+	return line
 }
 
-func (t *JobExecutor) writeStderrLog(line []byte) {
-	t.taskLogger.Write(append(line, '\n'))
-	t.logStream <- &LogMsg{TaskID: t.job.task.ID, LineNumber: int(t.lineNumber.Add(1)), Line: string(line)}
+// redact is called by the shell executor before the lines are split or truncated, so a secret is never cut in two
+func (t *JobExecutor) redact(line []byte, n int) ([]byte, int) {
+	t.redactionsMu.Lock()
+	defer t.redactionsMu.Unlock()
+	return t.redactor.RedactBefore(line, n, t.redactions)
 }
@@ -0,0 +1,48 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	logstore "github.com/fattymango/px-take-home/internal/log_store"
+	"github.com/fattymango/px-take-home/internal/redact"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobExecutor_FinalizeBeforeStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		wantOps []operation
+	}{
+		{name: "completed", command: "seq 1 200", wantOps: []operation{op_TASK_RUNNING, op_TASK_OUTPUT, op_TASK_COMPLETED}},
+		{name: "failed", command: "seq 1 200; exit 3", wantOps: []operation{op_TASK_RUNNING, op_TASK_OUTPUT, op_TASK_FAILED}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				CMD:        config.CMD{MaxLineLength: 1024, LongLines: "split"},
+				TaskLogger: config.TaskLogger{DirPath: t.TempDir(), MaxSize: 128},
+				EventBus:   config.EventBus{BufferSize: 1024},
+			}
+			store := logstore.NewFileStore(cfg, logger.NewTestLogger())
+			taskChan := make(chan *JobMsg, 8)
+			job := NewJob(&model.Task{ID: 1, Command: tt.command})
+
+			executor := NewJobExecutor(cfg, logger.NewTestLogger(), job, store, redact.NewRedactor(nil), taskChan, eventbus.NewBus(cfg, logger.NewTestLogger()))
+			executor.Execute()
+			close(taskChan)
+
+			// The truncated output is saved before the task is finished, readers of a finished task see its final log
+			var ops []operation
+			for msg := range taskChan {
+				ops = append(ops, msg.op)
+			}
+			assert.Equal(t, tt.wantOps, ops)
+		})
+	}
+}
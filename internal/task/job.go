@@ -2,16 +2,33 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	"github.com/fattymango/px-take-home/internal/shell"
 	"github.com/fattymango/px-take-home/model"
 )
 
+var (
+	ErrNoStdin = errors.New("task has no open stdin")
+	// returned when the task has no job to cancel, it finished or hasn't started
+	ErrNotRunning = errors.New(ErrTaskNotRunning)
+	// returned when a task was reviewed meanwhile, e.g. by another approver
+	ErrNotPendingApproval = errors.New(ErrTaskNotPendingApproval)
+)
+
 type Job struct {
 	task   *model.Task
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// the running command of the job, set while its stdin is open
+	mu    sync.Mutex
+	stdin *shell.ShellExecutor
+	// line map of the log being written, set once the executor created it
+	lineMap func() logreader.LineMap
 }
 
 func NewJob(task *model.Task) *Job {
@@ -27,6 +44,50 @@ func (j *Job) Cancel() {
 	j.cancel()
 }
 
+func (j *Job) setStdin(executor *shell.ShellExecutor) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stdin = executor
+}
+
+func (j *Job) setLineMap(lineMap func() logreader.LineMap) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.lineMap = lineMap
+}
+
+// LineMap returns the line map of the log being written by the job, false until the executor created the log
+func (j *Job) LineMap() (logreader.LineMap, bool) {
+	j.mu.Lock()
+	lineMap := j.lineMap
+	j.mu.Unlock()
+	if lineMap == nil {
+		return logreader.LineMap{}, false
+	}
+	return lineMap(), true
+}
+
+// WriteStdin writes data to the stdin of the running command of a task created with stdin, eof closes it afterwards
+func (j *Job) WriteStdin(data []byte, eof bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.stdin == nil {
+		return ErrNoStdin
+	}
+	if len(data) > 0 {
+		if err := j.stdin.WriteStdin(data); err != nil {
+			return err
+		}
+	}
+	if eof {
+		err := j.stdin.CloseStdin()
+		j.stdin = nil
+		return err
+	}
+	return nil
+}
+
 type JobCache interface {
 	GetJob(id uint64) (*Job, error)
 	SetJob(id uint64, job *Job)
@@ -1,11 +1,19 @@
 package task
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"sync"
 
 	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	logdiff "github.com/fattymango/px-take-home/internal/log_diff"
 	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	logsearch "github.com/fattymango/px-take-home/internal/log_search"
+	logstore "github.com/fattymango/px-take-home/internal/log_store"
+	"github.com/fattymango/px-take-home/internal/redact"
+	"github.com/fattymango/px-take-home/internal/shell"
 	"github.com/fattymango/px-take-home/model"
 	"github.com/fattymango/px-take-home/pkg/logger"
 )
@@ -22,6 +30,7 @@ const (
 	op_TASK_COMPLETED
 	op_TASK_RUNNING
 	op_TASK_CANCELLED
+	op_TASK_OUTPUT
 )
 
 const (
@@ -29,6 +38,9 @@ const (
 	ErrTaskNotRunning       = "task is not running"
 	ReasonCancelledByUser   = "cancelled by user"
 	ReasonCancelledBySystem = "cancelled by system"
+
+	ErrTaskNotPendingApproval = "task is not pending approval"
+	ReasonRejectedByApprover  = "rejected by approver"
 )
 
 type JobMsg struct {
@@ -36,27 +48,25 @@ type JobMsg struct {
 	taskID   uint64
 	reason   string
 	exitCode int
-}
-
-type LogMsg struct {
-	TaskID     uint64 `json:"task_id"`
-	LineNumber int    `json:"line_number"`
-	Line       string `json:"line"`
-}
 
-type TaskMsg struct {
-	TaskID   uint64           `json:"task_id"`
-	Status   model.TaskStatus `json:"status"`
-	Reason   string           `json:"reason"`
-	ExitCode int              `json:"exit_code"`
+	redactions map[string]int64
+	truncated  bool
+	lines      logreader.LineMap
 }
 
 type TaskManager struct {
-	config    *config.Config
-	logger    *logger.Logger
-	store     TaskStore
-	jobCache  JobCache
-	logReader *logreader.LogReader
+	config   *config.Config
+	logger   *logger.Logger
+	store    TaskStore
+	jobCache JobCache
+	logStore logstore.LogStore
+	redactor *redact.Redactor
+	// publishes the events of the tasks to the other components, like SSE
+	bus *eventbus.Bus
+	// bounds the logs scanned at once by the searches across tasks
+	searchPool *logsearch.Pool
+	// flags the commands that need an approval, returns the findings and whether there are none
+	validateCommand func(command string) (string, bool, error)
 
 	// Queue channel for queued tasks
 	taskQueue chan *model.Task
@@ -66,19 +76,22 @@ type TaskManager struct {
 	// channel to receive task updates from task executors
 	taskUpdatesChan chan *JobMsg
 
+	// mutex for the quota check and task creation, so concurrent submissions can't exceed the quota
+	quotaMutex sync.Mutex
+	// limits the number of running tasks per owner
+	runSlots *runSlots
+
 	// wait group for the task manager
 	wg sync.WaitGroup
 
 	// wait group for the jobs
 	jobsWg sync.WaitGroup
 
-	// channel to receive logs from task executors, used by other components to receive logs, like SSE
-	logStream chan *LogMsg
-	// channel to receive task updates from task executors, used by other components to receive task updates, like SSE
-	taskUpdatesStream chan *TaskMsg
+	// taskID -> chan struct{}, closed once the executor of the task wrote its whole log
+	logsDone sync.Map
 }
 
-func NewTaskManager(config *config.Config, logger *logger.Logger, store TaskStore) *TaskManager {
+func NewTaskManager(config *config.Config, logger *logger.Logger, store TaskStore, logStore logstore.LogStore, bus *eventbus.Bus) *TaskManager {
 	return &TaskManager{
 		config:   config,
 		logger:   logger,
@@ -89,12 +102,16 @@ func NewTaskManager(config *config.Config, logger *logger.Logger, store TaskStor
 		taskQueueMutex: sync.RWMutex{},
 
 		taskUpdatesChan: make(chan *JobMsg, CH_BUF_SIZE),
+		runSlots:        newRunSlots(config.Quota.MaxRunningTasks),
 		wg:              sync.WaitGroup{},
 		jobsWg:          sync.WaitGroup{},
 
-		logStream:         make(chan *LogMsg, CH_BUF_SIZE),
-		taskUpdatesStream: make(chan *TaskMsg, CH_BUF_SIZE),
-		logReader:         logreader.NewLogReader(config, logger),
+		logStore:   logStore,
+		redactor:   redact.NewRedactor(config.Redact.Rules),
+		bus:        bus,
+		searchPool: logsearch.NewPool(config.LogSearch.Concurrency),
+
+		validateCommand: shell.ValidateMaliciousCommand,
 	}
 }
 
@@ -125,8 +142,6 @@ func (t *TaskManager) Stop() {
 	close(t.taskUpdatesChan)
 	t.logger.Debug("waiting for task manager to finish")
 	t.wg.Wait() // wait for task manager to finish all
-	close(t.logStream)
-	close(t.taskUpdatesStream)
 }
 
 func (t *TaskManager) listen() {
@@ -178,6 +193,11 @@ func (t *TaskManager) processTaskUpdates(data *JobMsg) {
 		if err != nil {
 			t.logger.Errorf("failed to task running: %s", err)
 		}
+	case op_TASK_OUTPUT:
+		err := t.store.TaskOutput(data.taskID, data.redactions, data.truncated, data.lines)
+		if err != nil {
+			t.logger.Errorf("failed to save task output summary: %s", err)
+		}
 	default:
 		return
 	}
@@ -218,19 +238,65 @@ func (t *TaskManager) loadQueuedTasks() error {
 	return nil
 }
 
-func (t *TaskManager) LogStream() <-chan *LogMsg {
-	return t.logStream
-}
+func (t *TaskManager) CreateTask(task *model.Task) (*model.Task, error) {
+	if task.Owner != "" {
+		t.quotaMutex.Lock()
+		defer t.quotaMutex.Unlock()
 
-func (t *TaskManager) TaskUpdatesStream() <-chan *TaskMsg {
-	return t.taskUpdatesStream
-}
+		if err := t.checkQuota(task.Owner); err != nil {
+			return nil, err
+		}
+	}
+
+	// Flagged commands wait for an approver instead of failing when they are executed
+	if t.config.CMD.Validate && t.config.Approval.Enabled {
+		findings, ok, err := t.validateCommand(task.Command)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ErrFailedToValidate, err)
+		}
+		if !ok {
+			task.Status = model.TaskStatus_PendingApproval
+			task.Findings = findings
+		}
+	}
 
-func (t *TaskManager) CreateTask(task *model.Task) (*model.Task, error) {
 	err := t.store.CreateTask(task)
 	if err != nil {
 		return nil, fmt.Errorf("db failed to create task: %w", err)
 	}
+	t.bus.Publish(eventbus.NewTaskEvent(eventbus.EventTaskCreated, &eventbus.TaskMsg{TaskID: task.ID, Status: task.Status}))
+
+	return task, nil
+}
+
+// ReviewTask records the approver decision on a task pending approval, approved tasks are queued.
+func (t *TaskManager) ReviewTask(taskID uint64, decision model.ReviewDecision, reviewer, comment string) (*model.Task, error) {
+	status := model.TaskStatus_Rejected
+	if decision == model.ReviewDecision_Approved {
+		status = model.TaskStatus_Queued
+	}
+
+	err := t.store.TaskReviewed(taskID, decision, reviewer, comment, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to review task: %w", err)
+	}
+
+	task, err := t.store.GetTask(taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task from db: %w", err)
+	}
+
+	// Approved tasks are announced once queued
+	if status == model.TaskStatus_Rejected {
+		t.bus.Publish(eventbus.NewTaskEvent(eventbus.EventTaskRejected, &eventbus.TaskMsg{TaskID: taskID, Status: task.Status, Reason: task.Reason}))
+	}
+
+	if status == model.TaskStatus_Queued {
+		err = t.QueueTask(task)
+		if err != nil {
+			return nil, fmt.Errorf("failed to queue task: %w", err)
+		}
+	}
 
 	return task, nil
 }
@@ -252,6 +318,8 @@ func (t *TaskManager) QueueTask(task *model.Task) error {
 		return fmt.Errorf("task #%d is already in the queue", task.ID)
 	}
 
+	// Published before the task can start, so it's never announced after its started event
+	t.bus.Publish(eventbus.NewTaskEvent(eventbus.EventTaskQueued, &eventbus.TaskMsg{TaskID: task.ID, Status: model.TaskStatus_Queued}))
 	t.taskQueue <- task
 	return nil
 }
@@ -262,7 +330,21 @@ func (t *TaskManager) executeTask(task *model.Task) error {
 	job := NewJob(task)
 	t.jobCache.SetJob(task.ID, job)
 
-	executor := NewJobExecutor(t.config, t.logger, job, t.taskUpdatesChan, t.logStream)
+	done := make(chan struct{})
+	t.logsDone.Store(task.ID, done)
+	defer func() {
+		t.logsDone.Delete(task.ID)
+		close(done)
+	}()
+
+	if !t.runSlots.acquire(job) {
+		t.logger.Infof("task #%d cancelled while waiting for a run slot", task.ID)
+		t.taskUpdatesChan <- &JobMsg{op: op_TASK_CANCELLED, taskID: task.ID, reason: ReasonCancelledBySystem}
+		return nil
+	}
+	defer t.runSlots.release(job)
+
+	executor := NewJobExecutor(t.config, t.logger, job, t.logStore, t.redactor, t.taskUpdatesChan, t.bus)
 	err := executor.Execute()
 	if err != nil {
 		t.logger.Errorf("failed to execute job #%d: %s", job.task.ID, err)
@@ -292,15 +374,28 @@ func (t *TaskManager) GetAllTasks(offset, limit int, status model.TaskStatus) ([
 func (t *TaskManager) CancelTask(taskID uint64) error {
 	job, err := t.jobCache.GetJob(taskID)
 	if err != nil {
-		return fmt.Errorf("failed to get job: %w", err)
+		return fmt.Errorf("task #%d: %w", taskID, ErrNotRunning)
 	}
 	job.Cancel()
 
 	return nil
 }
 
-func (t *TaskManager) GetTaskLogs(taskID uint64, from, to int) ([]string, int, error) {
-	logs, totalLines, err := t.logReader.Read(taskID, from, to)
+// WriteTaskStdin writes data to the stdin of a running task created with stdin, eof closes its stdin afterwards
+func (t *TaskManager) WriteTaskStdin(taskID uint64, data []byte, eof bool) error {
+	job, err := t.jobCache.GetJob(taskID)
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+	if err := job.WriteStdin(data, eof); err != nil {
+		return fmt.Errorf("failed to write task stdin: %w", err)
+	}
+
+	return nil
+}
+
+func (t *TaskManager) GetTaskLogs(taskID uint64, filter *logreader.Filter) ([]*logreader.Line, int, error) {
+	logs, totalLines, err := t.logStore.Read(taskID, filter)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to read task logs: %w", err)
 	}
@@ -308,25 +403,136 @@ func (t *TaskManager) GetTaskLogs(taskID uint64, from, to int) ([]string, int, e
 	return logs, totalLines, nil
 }
 
+// GetTaskLogPage returns a page of the log of a task from the cursor, a nil cursor returns the last lines.
+// Lines of other streams are removed from the page, the cursors still cover them.
+func (t *TaskManager) GetTaskLogPage(taskID uint64, cursor *logreader.Cursor, limit int, stream model.LogStream) (*logreader.Page, error) {
+	page, err := t.logStore.Page(taskID, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task logs: %w", err)
+	}
+
+	if stream != 0 {
+		page.Lines = slices.DeleteFunc(page.Lines, func(line *logreader.Line) bool { return line.Stream != stream })
+	}
+	return page, nil
+}
+
+// SearchTaskLogs scans the log of a task for the query, the search is stopped after the configured timeout
+func (t *TaskManager) SearchTaskLogs(ctx context.Context, taskID uint64, query *logsearch.Query) (*logsearch.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.config.LogSearch.Timeout)
+	defer cancel()
+
+	return logsearch.Search(ctx, t.logStore, taskID, query)
+}
+
+// DiffTaskLogs compares the logs of two tasks, the comparison is stopped after the log search timeout.
+// The lines of the diff are read from the log store by Diff.Write.
+func (t *TaskManager) DiffTaskLogs(ctx context.Context, a, b uint64, opts *logdiff.Options) (*logdiff.Diff, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.config.LogSearch.Timeout)
+	defer cancel()
+
+	return logdiff.Compare(ctx, t.logStore, a, b, opts)
+}
+
+// SearchAllTaskLogs searches the logs of the most recent tasks selected by the filter, at most limit tasks.
+// It returns the selected tasks, the number of tasks the filter selects and the result of the search,
+// which holds the tasks searched so far if the search timed out.
+func (t *TaskManager) SearchAllTaskLogs(ctx context.Context, filter *TaskFilter, limit int, query *logsearch.Query) ([]*model.Task, int64, *logsearch.TasksResult, error) {
+	matcher, err := logsearch.NewMatcher(query.Pattern, query.Regex, query.IgnoreCase)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	tasks, total, err := t.store.FindTasks(filter, limit)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to find tasks: %w", err)
+	}
+
+	taskIDs := make([]uint64, len(tasks))
+	for i, task := range tasks {
+		taskIDs[i] = task.ID
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.config.LogSearch.Timeout)
+	defer cancel()
+
+	result, err := t.searchPool.SearchTasks(ctx, t.logStore, taskIDs, matcher, query)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return tasks, total, result, nil
+}
+
+// TailTaskLogs returns the last n lines of the log of a task and its total number of lines
+func (t *TaskManager) TailTaskLogs(taskID uint64, n int) ([]*logreader.Line, int, error) {
+	return t.logStore.Tail(taskID, n)
+}
+
+// GetTaskLogLineMap returns the line map of the log of a task, and whether the log is complete.
+// The log of a task executing on this instance is mapped by its logger, the map is saved with the task
+// before the job ends. While an output over the max size is executing, only its head is in the log store.
+func (t *TaskManager) GetTaskLogLineMap(taskID uint64) (logreader.LineMap, bool, error) {
+	if job, err := t.jobCache.GetJob(taskID); err == nil {
+		if lines, ok := job.LineMap(); ok {
+			return lines, false, nil
+		}
+	}
+
+	task, err := t.GetTask(taskID)
+	if err != nil {
+		return logreader.LineMap{}, false, err
+	}
+	return logreader.LineMap{Head: task.LogHeadLines, Dropped: task.LogDroppedLines}, task.Status.Finished(), nil
+}
+
+// WaitTaskLogs waits until the log of a task executed by this instance is completely written.
+// The status of a task is updated before its executor flushes the last lines, readers of a finished task
+// wait for it to get the whole log. It returns immediately if the task is not executing.
+func (t *TaskManager) WaitTaskLogs(ctx context.Context, taskID uint64) error {
+	done, ok := t.logsDone.Load(taskID)
+	if !ok {
+		return nil
+	}
+
+	select {
+	case <-done.(chan struct{}):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OpenTaskLogs returns the log of a task from the byte offset, the error wraps os.ErrNotExist if the task has no log
+func (t *TaskManager) OpenTaskLogs(taskID uint64, acceptGzip bool, offset int64) (*logstore.Download, error) {
+	return t.logStore.Open(taskID, acceptGzip, offset)
+}
+
+// The status updates below are saved before they are published, so subscribers reading the task
+// get at least the status of the event. They are published even if saving fails.
+
 func (t *TaskManager) taskFailed(taskID uint64, reason string, exitCode int) error {
 	t.jobCache.DeleteJob(taskID)
-	t.taskUpdatesStream <- &TaskMsg{TaskID: taskID, Status: model.TaskStatus_Failed, Reason: reason, ExitCode: exitCode}
-	return t.store.TaskFailed(taskID, reason, exitCode)
+	err := t.store.TaskFailed(taskID, reason, exitCode)
+	t.bus.Publish(eventbus.NewTaskEvent(eventbus.EventTaskFailed, &eventbus.TaskMsg{TaskID: taskID, Status: model.TaskStatus_Failed, Reason: reason, ExitCode: exitCode}))
+	return err
 }
 
 func (t *TaskManager) taskCompleted(taskID uint64, exitCode int) error {
 	t.jobCache.DeleteJob(taskID)
-	t.taskUpdatesStream <- &TaskMsg{TaskID: taskID, Status: model.TaskStatus_Completed, ExitCode: exitCode}
-	return t.store.TaskCompleted(taskID, exitCode)
+	err := t.store.TaskCompleted(taskID, exitCode)
+	t.bus.Publish(eventbus.NewTaskEvent(eventbus.EventTaskCompleted, &eventbus.TaskMsg{TaskID: taskID, Status: model.TaskStatus_Completed, ExitCode: exitCode}))
+	return err
 }
 
 func (t *TaskManager) taskCancelled(taskID uint64, exitCode int) error {
 	t.jobCache.DeleteJob(taskID)
-	t.taskUpdatesStream <- &TaskMsg{TaskID: taskID, Status: model.TaskStatus_Cancelled, ExitCode: exitCode}
-	return t.store.TaskCancelled(taskID, ReasonCancelledBySystem, exitCode)
+	err := t.store.TaskCancelled(taskID, ReasonCancelledBySystem, exitCode)
+	t.bus.Publish(eventbus.NewTaskEvent(eventbus.EventTaskCancelled, &eventbus.TaskMsg{TaskID: taskID, Status: model.TaskStatus_Cancelled, ExitCode: exitCode}))
+	return err
 }
 
 func (t *TaskManager) taskRunning(taskID uint64) error {
-	t.taskUpdatesStream <- &TaskMsg{TaskID: taskID, Status: model.TaskStatus_Running}
-	return t.store.TaskRunning(taskID)
+	err := t.store.TaskRunning(taskID)
+	t.bus.Publish(eventbus.NewTaskEvent(eventbus.EventTaskStarted, &eventbus.TaskMsg{TaskID: taskID, Status: model.TaskStatus_Running}))
+	return err
 }
@@ -0,0 +1,198 @@
+package task
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/internal/eventbus"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/fattymango/px-take-home/pkg/db"
+	"github.com/fattymango/px-take-home/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestManager returns a task manager backed by a SQLite store, its tasks are not executed
+func newTestManager(t *testing.T, cfg *config.Config) (*TaskManager, *TaskDBStore) {
+	cfg.DB = config.DB{File: filepath.Join(t.TempDir(), "px.db"), MaxOpenConns: 1}
+	cfg.EventBus.BufferSize = 16
+	database, err := db.NewSQLiteDB(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, database.AutoMigrate(&model.Task{}))
+
+	store := NewTaskDBStore(cfg, logger.NewTestLogger(), database)
+	return NewTaskManager(cfg, logger.NewTestLogger(), store, nil, eventbus.NewBus(cfg, logger.NewTestLogger())), store
+}
+
+func TestTaskManager_CreateTask_Approval(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmd      config.CMD
+		approval config.Approval
+		// result of the validator
+		findings     string
+		validatorErr error
+		wantCalled   bool
+		wantStatus   model.TaskStatus
+		wantErr      bool
+	}{
+		{
+			name:       "approval disabled",
+			cmd:        config.CMD{Validate: true},
+			findings:   "SC2115",
+			wantStatus: model.TaskStatus_Queued,
+		},
+		{
+			name:       "validation disabled",
+			approval:   config.Approval{Enabled: true},
+			findings:   "SC2115",
+			wantStatus: model.TaskStatus_Queued,
+		},
+		{
+			name:       "no findings",
+			cmd:        config.CMD{Validate: true},
+			approval:   config.Approval{Enabled: true},
+			wantCalled: true,
+			wantStatus: model.TaskStatus_Queued,
+		},
+		{
+			name:       "flagged command waits for approval",
+			cmd:        config.CMD{Validate: true},
+			approval:   config.Approval{Enabled: true},
+			findings:   "SC2115",
+			wantCalled: true,
+			wantStatus: model.TaskStatus_PendingApproval,
+		},
+		{
+			name:         "validator can't run",
+			cmd:          config.CMD{Validate: true},
+			approval:     config.Approval{Enabled: true},
+			validatorErr: errors.New("shellcheck not found"),
+			wantCalled:   true,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, store := newTestManager(t, &config.Config{CMD: tt.cmd, Approval: tt.approval})
+			called := false
+			manager.validateCommand = func(command string) (string, bool, error) {
+				called = true
+				return tt.findings, tt.findings == "", tt.validatorErr
+			}
+
+			task, err := manager.CreateTask(&model.Task{Name: "test", Command: "rm -rf $DIR/", Status: model.TaskStatus_Queued})
+			assert.Equal(t, tt.wantCalled, called)
+			if tt.wantErr {
+				assert.Error(t, err)
+				_, total, err := store.GetAllTasks(0, 10, 0)
+				assert.NoError(t, err)
+				assert.Zero(t, total)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, task.Status)
+			if tt.wantStatus == model.TaskStatus_PendingApproval {
+				assert.Equal(t, tt.findings, task.Findings)
+			} else {
+				assert.Empty(t, task.Findings)
+			}
+		})
+	}
+}
+
+func TestTaskManager_ReviewTask(t *testing.T) {
+	tests := []struct {
+		name       string
+		decision   model.ReviewDecision
+		wantStatus model.TaskStatus
+		wantReason string
+		wantQueued bool
+	}{
+		{name: "approved", decision: model.ReviewDecision_Approved, wantStatus: model.TaskStatus_Queued, wantQueued: true},
+		{name: "rejected", decision: model.ReviewDecision_Rejected, wantStatus: model.TaskStatus_Rejected, wantReason: ReasonRejectedByApprover},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, store := newTestManager(t, &config.Config{})
+			pending := &model.Task{Name: "test", Command: "rm -rf $DIR/", Status: model.TaskStatus_PendingApproval, Findings: "SC2115"}
+			assert.NoError(t, store.CreateTask(pending))
+
+			task, err := manager.ReviewTask(pending.ID, tt.decision, "key:approver", "checked")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, task.Status)
+			assert.Equal(t, tt.wantReason, task.Reason)
+			assert.Equal(t, tt.decision, task.ReviewDecision)
+			assert.Equal(t, "key:approver", task.ReviewedBy)
+			assert.Equal(t, "checked", task.ReviewComment)
+			assert.NotZero(t, task.ReviewedAt)
+			assert.Equal(t, tt.wantQueued, len(manager.taskQueue) == 1)
+
+			// a task is reviewed once
+			_, err = manager.ReviewTask(pending.ID, model.ReviewDecision_Approved, "key:other", "")
+			assert.ErrorContains(t, err, ErrTaskNotPendingApproval)
+		})
+	}
+}
+
+func TestTaskManager_ReviewTask_NotPending(t *testing.T) {
+	manager, store := newTestManager(t, &config.Config{})
+	queued := &model.Task{Name: "test", Command: "true", Status: model.TaskStatus_Queued}
+	assert.NoError(t, store.CreateTask(queued))
+
+	_, err := manager.ReviewTask(queued.ID, model.ReviewDecision_Rejected, "key:approver", "")
+	assert.ErrorIs(t, err, ErrNotPendingApproval)
+
+	task, err := store.GetTask(queued.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.TaskStatus_Queued, task.Status)
+	assert.Empty(t, manager.taskQueue)
+}
+
+func TestTaskManager_CancelTask_NotRunning(t *testing.T) {
+	manager, store := newTestManager(t, &config.Config{})
+	completed := &model.Task{Name: "test", Command: "true", Status: model.TaskStatus_Completed}
+	assert.NoError(t, store.CreateTask(completed))
+
+	err := manager.CancelTask(completed.ID)
+	assert.ErrorIs(t, err, ErrNotRunning)
+}
+
+func TestTaskManager_StatusUpdates(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     func(m *TaskManager, taskID uint64) error
+		wantStatus model.TaskStatus
+	}{
+		{name: "running", update: func(m *TaskManager, taskID uint64) error { return m.taskRunning(taskID) }, wantStatus: model.TaskStatus_Running},
+		{name: "completed", update: func(m *TaskManager, taskID uint64) error { return m.taskCompleted(taskID, 0) }, wantStatus: model.TaskStatus_Completed},
+		{name: "failed", update: func(m *TaskManager, taskID uint64) error { return m.taskFailed(taskID, "failed", 1) }, wantStatus: model.TaskStatus_Failed},
+		{name: "cancelled", update: func(m *TaskManager, taskID uint64) error { return m.taskCancelled(taskID, -1) }, wantStatus: model.TaskStatus_Cancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, store := newTestManager(t, &config.Config{})
+			task := &model.Task{Name: "test", Command: "true", Status: model.TaskStatus_Queued}
+			assert.NoError(t, store.CreateTask(task))
+
+			// Subscribers read the task when they receive the event, it has the status of the event
+			events := manager.bus.Subscribe("test")
+			read := make(chan *model.Task)
+			go func() {
+				event := <-events.Events()
+				saved, err := store.GetTask(event.TaskID)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantStatus, event.Task.Status)
+				read <- saved
+			}()
+
+			assert.NoError(t, tt.update(manager, task.ID))
+			assert.Equal(t, tt.wantStatus, (<-read).Status)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package task
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fattymango/px-take-home/model"
+)
+
+const (
+	ErrQueuedQuotaExceeded     = "too many queued tasks"
+	ErrSubmissionQuotaExceeded = "too many task submissions in the last hour"
+)
+
+// QuotaExceededError is returned when a client exceeds one of its task quotas.
+// RetryAfter is zero when it is unknown when the quota frees up.
+type QuotaExceededError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return e.Reason
+}
+
+// checkQuota checks the submission quotas of the owner, callers must hold quotaMutex
+func (t *TaskManager) checkQuota(owner string) error {
+	quota := t.config.Quota
+
+	if quota.MaxQueuedTasks > 0 {
+		queued, err := t.store.CountOwnerTasks(owner, model.TaskStatus_Queued)
+		if err != nil {
+			return fmt.Errorf("failed to count queued tasks: %w", err)
+		}
+		if queued >= int64(quota.MaxQueuedTasks) {
+			return &QuotaExceededError{Reason: fmt.Sprintf("%s, limit is %d", ErrQueuedQuotaExceeded, quota.MaxQueuedTasks)}
+		}
+	}
+
+	if quota.MaxSubmissionsPerHour > 0 {
+		now := time.Now()
+		submitted, oldest, err := t.store.OwnerSubmissionsSince(owner, now.Add(-time.Hour).UnixNano())
+		if err != nil {
+			return fmt.Errorf("failed to count task submissions: %w", err)
+		}
+		if submitted >= int64(quota.MaxSubmissionsPerHour) {
+			return &QuotaExceededError{
+				Reason:     fmt.Sprintf("%s, limit is %d", ErrSubmissionQuotaExceeded, quota.MaxSubmissionsPerHour),
+				RetryAfter: time.Unix(0, oldest).Add(time.Hour).Sub(now),
+			}
+		}
+	}
+
+	return nil
+}
+
+// runSlots limits the number of tasks running at the same time per owner
+type runSlots struct {
+	mu    sync.Mutex
+	max   int
+	slots map[string]chan struct{}
+}
+
+func newRunSlots(max int) *runSlots {
+	return &runSlots{
+		max:   max,
+		slots: make(map[string]chan struct{}),
+	}
+}
+
+func (r *runSlots) get(owner string) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	slot, ok := r.slots[owner]
+	if !ok {
+		slot = make(chan struct{}, r.max)
+		r.slots[owner] = slot
+	}
+	return slot
+}
+
+// acquire blocks until the owner has a free slot, it returns false if the job is cancelled while waiting
+func (r *runSlots) acquire(job *Job) bool {
+	if r.max <= 0 || job.task.Owner == "" {
+		return true
+	}
+
+	select {
+	case r.get(job.task.Owner) <- struct{}{}:
+		return true
+	case <-job.ctx.Done():
+		return false
+	}
+}
+
+func (r *runSlots) release(job *Job) {
+	if r.max <= 0 || job.task.Owner == "" {
+		return
+	}
+
+	<-r.get(job.task.Owner)
+}
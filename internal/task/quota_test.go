@@ -0,0 +1,153 @@
+package task
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fattymango/px-take-home/config"
+	"github.com/fattymango/px-take-home/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskManager_CheckQuota(t *testing.T) {
+	tests := []struct {
+		name  string
+		quota config.Quota
+		// tasks already submitted by the owner
+		existing   []*model.Task
+		owner      string
+		wantReason string
+		wantRetry  bool
+	}{
+		{
+			name:  "no quota",
+			owner: "key:a",
+			existing: []*model.Task{
+				{Owner: "key:a", Status: model.TaskStatus_Queued},
+				{Owner: "key:a", Status: model.TaskStatus_Queued},
+			},
+		},
+		{
+			name:  "queued under the limit",
+			quota: config.Quota{MaxQueuedTasks: 2},
+			owner: "key:a",
+			existing: []*model.Task{
+				{Owner: "key:a", Status: model.TaskStatus_Queued},
+				{Owner: "key:a", Status: model.TaskStatus_Completed},
+				{Owner: "key:b", Status: model.TaskStatus_Queued},
+			},
+		},
+		{
+			name:  "queued limit reached",
+			quota: config.Quota{MaxQueuedTasks: 2},
+			owner: "key:a",
+			existing: []*model.Task{
+				{Owner: "key:a", Status: model.TaskStatus_Queued},
+				{Owner: "key:a", Status: model.TaskStatus_Queued},
+			},
+			wantReason: ErrQueuedQuotaExceeded,
+		},
+		{
+			name:  "submissions of other owners and older than an hour don't count",
+			quota: config.Quota{MaxSubmissionsPerHour: 2},
+			owner: "key:a",
+			existing: []*model.Task{
+				{Owner: "key:a", Status: model.TaskStatus_Completed},
+				{Owner: "key:a", Status: model.TaskStatus_Completed, CommonModel: model.CommonModel{CreatedAt: time.Now().Add(-2 * time.Hour).UnixNano()}},
+				{Owner: "key:b", Status: model.TaskStatus_Completed},
+			},
+		},
+		{
+			name:  "submissions limit reached",
+			quota: config.Quota{MaxSubmissionsPerHour: 2},
+			owner: "key:a",
+			existing: []*model.Task{
+				{Owner: "key:a", Status: model.TaskStatus_Completed},
+				{Owner: "key:a", Status: model.TaskStatus_Failed},
+			},
+			wantReason: ErrSubmissionQuotaExceeded,
+			wantRetry:  true,
+		},
+		{
+			name:  "clients without an owner are not limited",
+			quota: config.Quota{MaxQueuedTasks: 1, MaxSubmissionsPerHour: 1},
+			existing: []*model.Task{
+				{Status: model.TaskStatus_Queued},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, store := newTestManager(t, &config.Config{Quota: tt.quota})
+			for _, task := range tt.existing {
+				assert.NoError(t, store.CreateTask(task))
+			}
+
+			_, err := manager.CreateTask(&model.Task{Name: "test", Command: "true", Owner: tt.owner, Status: model.TaskStatus_Queued})
+			if tt.wantReason == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var quotaErr *QuotaExceededError
+			assert.True(t, errors.As(err, &quotaErr))
+			assert.Contains(t, quotaErr.Reason, tt.wantReason)
+			if tt.wantRetry {
+				assert.True(t, quotaErr.RetryAfter > 59*time.Minute && quotaErr.RetryAfter <= time.Hour)
+			} else {
+				assert.Zero(t, quotaErr.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestTaskManager_CheckQuota_DeletedTasks(t *testing.T) {
+	manager, store := newTestManager(t, &config.Config{Quota: config.Quota{MaxSubmissionsPerHour: 1}})
+
+	task := &model.Task{Name: "test", Command: "true", Owner: "key:a", Status: model.TaskStatus_Completed}
+	assert.NoError(t, store.CreateTask(task))
+	assert.NoError(t, store.DeleteTasks([]uint64{task.ID}))
+
+	// deleting a task doesn't give its submission back
+	_, err := manager.CreateTask(&model.Task{Name: "test", Command: "true", Owner: "key:a", Status: model.TaskStatus_Queued})
+	var quotaErr *QuotaExceededError
+	assert.True(t, errors.As(err, &quotaErr))
+}
+
+func TestRunSlots(t *testing.T) {
+	slots := newRunSlots(1)
+
+	first := NewJob(&model.Task{ID: 1, Owner: "key:a"})
+	assert.True(t, slots.acquire(first))
+
+	// other owners and tasks without an owner have their own slots
+	assert.True(t, slots.acquire(NewJob(&model.Task{ID: 2, Owner: "key:b"})))
+	assert.True(t, slots.acquire(NewJob(&model.Task{ID: 3})))
+
+	// a second task of the owner waits until it is cancelled
+	second := NewJob(&model.Task{ID: 4, Owner: "key:a"})
+	acquired := make(chan bool)
+	go func() { acquired <- slots.acquire(second) }()
+	select {
+	case <-acquired:
+		t.Fatal("second task acquired a slot while the first one is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	second.Cancel()
+	assert.False(t, <-acquired)
+
+	// or until the first one releases its slot
+	third := NewJob(&model.Task{ID: 5, Owner: "key:a"})
+	go func() { acquired <- slots.acquire(third) }()
+	slots.release(first)
+	assert.True(t, <-acquired)
+}
+
+func TestRunSlots_Unlimited(t *testing.T) {
+	slots := newRunSlots(0)
+	for i := 0; i < 3; i++ {
+		assert.True(t, slots.acquire(NewJob(&model.Task{ID: uint64(i), Owner: "key:a"})))
+	}
+}
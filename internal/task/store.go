@@ -1,9 +1,11 @@
 package task
 
 import (
+	"strings"
 	"time"
 
 	"github.com/fattymango/px-take-home/config"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
 	"github.com/fattymango/px-take-home/model"
 	"github.com/fattymango/px-take-home/pkg/db"
 	"github.com/fattymango/px-take-home/pkg/logger"
@@ -19,6 +21,27 @@ type TaskStore interface {
 	TaskFailed(id uint64, reason string, exitCode int) error
 	TaskCompleted(id uint64, exitCode int) error
 	TaskRunning(id uint64) error
+	TaskOutput(id uint64, redactions map[string]int64, truncated bool, lines logreader.LineMap) error
+	TaskReviewed(id uint64, decision model.ReviewDecision, reviewer, comment string, status model.TaskStatus) error
+	CountOwnerTasks(owner string, status model.TaskStatus) (int64, error)
+	OwnerSubmissionsSince(owner string, since int64) (int64, int64, error)
+	GetFinishedTasks(beforeID uint64, limit int) ([]*model.Task, error)
+	FindTasks(filter *TaskFilter, limit int) ([]*model.Task, int64, error)
+	DeleteTasks(ids []uint64) error
+}
+
+const (
+	deleteBatchSize = 500 // keeps the number of query parameters under the SQLite limit
+)
+
+// TaskFilter selects tasks, zero fields match every task
+type TaskFilter struct {
+	Status model.TaskStatus
+	// Part of the task name, case insensitive
+	Name string
+	// Creation time range (unix nano, inclusive)
+	CreatedAfter  int64
+	CreatedBefore int64
 }
 
 type TaskDBStore struct {
@@ -101,3 +124,115 @@ func (t *TaskDBStore) TaskRunning(id uint64) error {
 		Where("id = ?", id).
 		Updates(map[string]interface{}{"status": model.TaskStatus_Running, "start_time": time.Now().Unix()}).Error
 }
+
+// TaskOutput saves the redactions applied to the task output, whether it was truncated and the line map of its log
+func (t *TaskDBStore) TaskOutput(id uint64, redactions map[string]int64, truncated bool, lines logreader.LineMap) error {
+	return t.db.Model(&model.Task{}).
+		Where("id = ?", id).
+		Updates(&model.Task{Redactions: redactions, Truncated: truncated, LogHeadLines: lines.Head, LogDroppedLines: lines.Dropped}).Error
+}
+
+func (t *TaskDBStore) CountOwnerTasks(owner string, status model.TaskStatus) (int64, error) {
+	var total int64
+	err := t.db.Model(&model.Task{}).
+		Where("owner = ? AND status = ?", owner, status).
+		Count(&total).Error
+	return total, err
+}
+
+// OwnerSubmissionsSince returns the number of tasks submitted by the owner since the given unix nano time,
+// and the creation time of the oldest one. Deleted tasks are counted as well.
+func (t *TaskDBStore) OwnerSubmissionsSince(owner string, since int64) (int64, int64, error) {
+	var result struct {
+		Total  int64
+		Oldest int64
+	}
+	err := t.db.Unscoped().Model(&model.Task{}).
+		Select("COUNT(*) AS total, COALESCE(MIN(created_at), 0) AS oldest").
+		Where("owner = ? AND created_at >= ?", owner, since).
+		Scan(&result).Error
+	return result.Total, result.Oldest, err
+}
+
+// TaskReviewed records the approval decision, it only updates tasks that are still pending approval
+func (t *TaskDBStore) TaskReviewed(id uint64, decision model.ReviewDecision, reviewer, comment string, status model.TaskStatus) error {
+	updates := map[string]interface{}{
+		"status":          status,
+		"review_decision": decision,
+		"reviewed_by":     reviewer,
+		"review_comment":  comment,
+		"reviewed_at":     time.Now().Unix(),
+	}
+	if status == model.TaskStatus_Rejected {
+		updates["reason"] = ReasonRejectedByApprover
+	}
+
+	result := t.db.Model(&model.Task{}).
+		Where("id = ? AND status = ?", id, model.TaskStatus_PendingApproval).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotPendingApproval
+	}
+	return nil
+}
+
+// GetFinishedTasks returns at most limit tasks in a terminal state with an ID below beforeID, newest first.
+// A beforeID of 0 starts at the newest task.
+func (t *TaskDBStore) GetFinishedTasks(beforeID uint64, limit int) ([]*model.Task, error) {
+	query := t.db.Where("status IN ?", model.TaskStatus_Finished)
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var tasks []*model.Task
+	err := query.Order("id DESC").
+		Limit(limit).
+		Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// FindTasks returns the most recent tasks selected by the filter, at most limit, and the number of tasks selected
+func (t *TaskDBStore) FindTasks(filter *TaskFilter, limit int) ([]*model.Task, int64, error) {
+	query := t.db.Model(&model.Task{})
+	if filter.Status != 0 {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Name != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Name)
+		query = query.Where(`LOWER(name) LIKE ? ESCAPE '\'`, "%"+strings.ToLower(escaped)+"%")
+	}
+	if filter.CreatedAfter != 0 {
+		query = query.Where("created_at >= ?", filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != 0 {
+		query = query.Where("created_at <= ?", filter.CreatedBefore)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var tasks []*model.Task
+	if err := query.Order("created_at DESC").Limit(limit).Find(&tasks).Error; err != nil {
+		return nil, 0, err
+	}
+	return tasks, total, nil
+}
+
+// DeleteTasks soft deletes the tasks, they are still counted by the submission quota
+func (t *TaskDBStore) DeleteTasks(ids []uint64) error {
+	for start := 0; start < len(ids); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(ids))
+		if err := t.db.Where("id IN ?", ids[start:end]).Delete(&model.Task{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
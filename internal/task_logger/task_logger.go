@@ -1,90 +1,215 @@
 package tasklogger
 
 import (
-	"bufio"
 	"context"
-	"fmt"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/fattymango/px-take-home/config"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	logstore "github.com/fattymango/px-take-home/internal/log_store"
+	"github.com/fattymango/px-take-home/model"
 	"github.com/fattymango/px-take-home/pkg/logger"
 )
 
 const (
 	FLUSH_INTERVAL = 100 * time.Millisecond // Flush interval, every 100ms
-	MAX_BUF_SIZE   = 4096                   // Max buffer capacity, if this is exceeded, the buffer will be flushed
 	CH_BUF_SIZE    = 1000                   // Channel buffer size, this is the size of the channel buffer
 )
 
+type entry struct {
+	stream model.LogStream
+	time   int64 // unix nano
+	line   []byte
+	tail   bool // kept in the tail buffer of an output over the max size
+}
+
+// TaskLogger queues the task output and writes it to the log store, the writer is flushed every FLUSH_INTERVAL.
+//
+// When a max size is configured, the first half of it is written as the output comes in and the last half
+// is kept in a ring file next to the logs, it is written after a truncation marker line when the logger is closed.
+// Whether a line goes to the head or the tail is decided by Write, so the line map is current once it returns.
 type TaskLogger struct {
 	config *config.Config
 	logger *logger.Logger
 
-	taskID  uint64
-	logFile *os.File
-	buffer  *bufio.Writer
-	wg      sync.WaitGroup
+	store  logstore.LogStore
+	writer logstore.Writer
+
+	taskID uint64
+	queued int64 // bytes of the head queued by Write
+	tail   *tailBuffer
+
+	// lines of the log, see LineMap
+	linesMu   sync.Mutex
+	lines     logreader.LineMap
+	inTail    bool
+	headLines int // lines queued to the head
+
+	wg sync.WaitGroup
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	ch chan []byte
+	ch chan *entry
 }
 
-func NewTaskLogger(config *config.Config, logger *logger.Logger, taskID uint64) *TaskLogger {
+func NewTaskLogger(config *config.Config, logger *logger.Logger, store logstore.LogStore, taskID uint64) *TaskLogger {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &TaskLogger{
 		config: config,
 		logger: logger,
+		store:  store,
 		taskID: taskID,
 		wg:     sync.WaitGroup{},
 		ctx:    ctx,
 		cancel: cancel,
-		ch:     make(chan []byte, CH_BUF_SIZE),
+		ch:     make(chan *entry, CH_BUF_SIZE),
 	}
 }
 
 func (t *TaskLogger) CreateLogFile() error {
-	taskLogDir := filepath.Join(t.config.TaskLogger.DirPath)
-	if err := os.MkdirAll(taskLogDir, 0755); err != nil {
-		return fmt.Errorf("failed to create task log directory: %w", err)
+	writer, err := t.store.Create(t.taskID)
+	if err != nil {
+		return err
 	}
+	t.writer = writer
+	return nil
+}
 
-	logFilePath := filepath.Join(taskLogDir, fmt.Sprintf("%d.log", t.taskID))
-	logFile, err := os.Create(logFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create task log file: %w", err)
+// Write queues a single line of the given stream captured at ts, the line must end with a new line.
+// Lines in the tail of an output over the max size only reach the log store when the logger is closed,
+// unless they are dropped by then, see LineMap. Write must not be called concurrently.
+func (t *TaskLogger) Write(stream model.LogStream, ts time.Time, line []byte) {
+	e := &entry{stream: stream, time: ts.UnixNano(), line: line}
+	if max := t.config.TaskLogger.MaxSize; max > 0 {
+		t.linesMu.Lock()
+		if t.inTail || t.queued+int64(len(line)) > max/2 {
+			if !t.inTail {
+				t.inTail = true
+				t.lines.Head = t.headLines
+			}
+			e.tail = true
+		} else {
+			t.queued += int64(len(line))
+			t.headLines++
+		}
+		t.linesMu.Unlock()
 	}
+	t.ch <- e
+}
 
-	t.logFile = logFile
-	t.buffer = bufio.NewWriterSize(logFile, MAX_BUF_SIZE)
+func (t *TaskLogger) write(e *entry) error {
+	if !e.tail {
+		return t.writeEntry(e)
+	}
+	if t.tail == nil {
+		max := t.config.TaskLogger.MaxSize
+		tail, err := newTailBuffer(max-max/2, FormatTailFileName(t.config.TaskLogger.DirPath, t.taskID))
+		if err != nil {
+			return err
+		}
+		t.tail = tail
+	}
+	return t.tail.push(e)
+}
 
-	return nil
+func (t *TaskLogger) writeEntry(e *entry) error {
+	return t.writer.Write(e.stream, e.time, e.line)
 }
 
-func (t *TaskLogger) Write(line []byte) {
-	t.ch <- line
+// LineMap maps the lines of the log to the lines of the output. While the output is truncated, the lines after
+// the head are not in the log store and the dropped lines are only counted once the logger is closed.
+func (t *TaskLogger) LineMap() logreader.LineMap {
+	t.linesMu.Lock()
+	defer t.linesMu.Unlock()
+	return t.lines
 }
 
-func (t *TaskLogger) write(p []byte) (n int, err error) {
-	return t.buffer.Write(p)
+// Truncated reports whether part of the output was dropped because of the max size, it is only valid after Close.
+func (t *TaskLogger) Truncated() bool {
+	return t.tail != nil && t.tail.dropped > 0
+}
+
+// writeTail writes the kept tail of a truncated output
+func (t *TaskLogger) writeTail() error {
+	if t.tail == nil || t.writer == nil {
+		return nil
+	}
+	if t.tail.dropped > 0 {
+		if err := t.writeEntry(t.tail.marker()); err != nil {
+			return err
+		}
+	}
+	for _, e := range t.tail.entries {
+		if err := t.writeEntry(e); err != nil {
+			return err
+		}
+	}
+	t.tail.entries = nil
+	return nil
 }
 
 func (t *TaskLogger) Close() error {
 	t.cancel()
 	t.wg.Wait()
-	t.Flush()
-	return t.logFile.Close()
+	if t.writer == nil {
+		return nil
+	}
+	// The lines after the head are numbered before they reach the log store
+	if t.tail != nil {
+		t.linesMu.Lock()
+		t.lines.Dropped = int(t.tail.dropped)
+		t.linesMu.Unlock()
+	}
+	if err := t.writeTail(); err != nil {
+		t.logger.Errorf("failed to write task log tail: %v", err)
+		return t.writer.Close()
+	}
+	if err := t.writer.Close(); err != nil {
+		return err
+	}
+	// The tail file is kept if the tail didn't make it to the log
+	if t.tail != nil {
+		return t.tail.remove()
+	}
+	return nil
 }
+
+// Finalize lets the store process the complete log, e.g. compress or upload it, it must be called after Close.
+func (t *TaskLogger) Finalize() error {
+	if t.writer == nil {
+		return nil
+	}
+	return t.store.Finalize(t.taskID)
+}
+
 func (t *TaskLogger) Flush() error {
-	if t.buffer == nil {
+	if t.writer == nil {
 		return nil
 	}
-	return t.buffer.Flush()
+	if t.tail != nil {
+		if err := t.tail.flush(); err != nil {
+			return err
+		}
+	}
+	return t.writer.Flush()
 }
+
+// drain writes the entries still queued when the logger is closed
+func (t *TaskLogger) drain() {
+	for {
+		select {
+		case e := <-t.ch:
+			if err := t.write(e); err != nil {
+				t.logger.Errorf("failed to write task log: %v", err)
+			}
+		default:
+			return
+		}
+	}
+}
+
 func (t *TaskLogger) Listen() {
 	t.wg.Add(1)
 	ticker := time.NewTicker(FLUSH_INTERVAL)
@@ -97,19 +222,22 @@ func (t *TaskLogger) Listen() {
 		defer t.Flush()
 		for {
 			select {
-			case line, ok := <-t.ch:
+			case e, ok := <-t.ch:
 				if !ok {
 					t.logger.Infof("task logger channel closed")
 					return
 				}
-				t.write(line)
+				if err := t.write(e); err != nil {
+					t.logger.Errorf("failed to write task log: %v", err)
+				}
 			case <-ticker.C:
 				// t.logger.Debugf("flushing buffer on ticker")
-				if err := t.buffer.Flush(); err != nil {
+				if err := t.Flush(); err != nil {
 					t.logger.Errorf("failed to flush buffer on ticker: %v", err)
 				}
 			case <-t.ctx.Done():
 				t.logger.Infof("task logger context done")
+				t.drain()
 				return
 			}
 		}
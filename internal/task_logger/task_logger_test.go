@@ -1,12 +1,18 @@
 package tasklogger
 
 import (
+	"encoding/binary"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/fattymango/px-take-home/config"
+	logreader "github.com/fattymango/px-take-home/internal/log_reader"
+	logstore "github.com/fattymango/px-take-home/internal/log_store"
+	"github.com/fattymango/px-take-home/model"
 	"github.com/fattymango/px-take-home/pkg/logger"
 	"github.com/stretchr/testify/assert"
 )
@@ -21,7 +27,7 @@ func TestTaskLogger_CreateLogFileFailure(t *testing.T) {
 	log := logger.NewTestLogger()
 	taskID := uint64(1)
 
-	tl := NewTaskLogger(cfg, log, taskID)
+	tl := NewTaskLogger(cfg, log, logstore.NewFileStore(cfg, log), taskID)
 	err := tl.CreateLogFile()
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create task log directory")
@@ -41,7 +47,7 @@ func TestTaskLogger_SuccessfulWriteAndClose(t *testing.T) {
 	log := logger.NewTestLogger()
 	taskID := uint64(1)
 
-	tl := NewTaskLogger(cfg, log, taskID)
+	tl := NewTaskLogger(cfg, log, logstore.NewFileStore(cfg, log), taskID)
 
 	err = tl.CreateLogFile()
 	assert.NoError(t, err)
@@ -51,7 +57,9 @@ func TestTaskLogger_SuccessfulWriteAndClose(t *testing.T) {
 
 	// Write test data
 	testData := []byte("test log entry\n")
-	tl.Write(testData)
+	now := time.Now()
+	tl.Write(model.LogStream_Stdout, now, testData)
+	tl.Write(model.LogStream_Stderr, now.Add(time.Millisecond), testData)
 
 	// Give some time for the write to complete and flush
 	time.Sleep(FLUSH_INTERVAL)
@@ -61,5 +69,137 @@ func TestTaskLogger_SuccessfulWriteAndClose(t *testing.T) {
 	logFilePath := filepath.Join(tmpDir, "1.log")
 	content, err := os.ReadFile(logFilePath)
 	assert.NoError(t, err)
-	assert.Equal(t, testData, content)
+	assert.Equal(t, append(testData, testData...), content)
+
+	streams, err := os.ReadFile(filepath.Join(tmpDir, "1.stream"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{byte(model.LogStream_Stdout), byte(model.LogStream_Stderr)}, streams)
+
+	timestamps, err := logreader.ReadTimestamps(logreader.NewFileSource(tmpDir), taskID, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{now.UnixNano(), now.Add(time.Millisecond).UnixNano()}, timestamps)
+
+	line, total, err := logreader.SearchTimestamp(logreader.NewFileSource(tmpDir), taskID, now.Add(time.Microsecond).UnixNano())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, line)
+	assert.Equal(t, 2, total)
+}
+
+func TestTaskLogger_TruncateAndCompress(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "tasklogger_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{
+		TaskLogger: config.TaskLogger{
+			DirPath:     tmpDir,
+			Compression: logreader.CompressionGzip,
+			MaxSize:     40,
+		},
+	}
+
+	log := logger.NewTestLogger()
+	taskID := uint64(1)
+
+	tl := NewTaskLogger(cfg, log, logstore.NewFileStore(cfg, log), taskID)
+	assert.NoError(t, tl.CreateLogFile())
+	tl.Listen()
+
+	// 10 lines of 5 bytes, the first 4 lines fit the head and the last 4 the tail
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		tl.Write(model.LogStream_Stdout, now, []byte(fmt.Sprintf("ln-%d\n", i)))
+	}
+	// The dropped lines are counted once the logger is closed
+	assert.Equal(t, logreader.LineMap{Head: 4}, tl.LineMap())
+
+	assert.NoError(t, tl.Close())
+	assert.True(t, tl.Truncated())
+	assert.Equal(t, logreader.LineMap{Head: 4, Dropped: 2}, tl.LineMap())
+	assert.NoError(t, tl.Finalize())
+
+	assert.False(t, logreader.CheckFileExists(logreader.FormatFileName(tmpDir, taskID)))
+
+	file, err := logreader.OpenLog(logreader.NewFileSource(tmpDir), taskID)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "ln-0\nln-1\nln-2\nln-3\n[... 2 lines (10 bytes) truncated ...]\nln-6\nln-7\nln-8\nln-9\n", string(content))
+
+	streams, err := logreader.ReadStreams(logreader.NewFileSource(tmpDir), taskID, 1, 9)
+	assert.NoError(t, err)
+	assert.Len(t, streams, 9)
+}
+
+// readTailFile returns the lines of the records of a tail file
+func readTailFile(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	var lines []string
+	for len(data) >= TAIL_RECORD_HEADER_SIZE {
+		n := int(binary.LittleEndian.Uint32(data[9:TAIL_RECORD_HEADER_SIZE]))
+		lines = append(lines, string(data[TAIL_RECORD_HEADER_SIZE:TAIL_RECORD_HEADER_SIZE+n]))
+		data = data[TAIL_RECORD_HEADER_SIZE+n:]
+	}
+	assert.Empty(t, data)
+	return lines
+}
+
+func TestTaskLogger_TailFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{TaskLogger: config.TaskLogger{DirPath: tmpDir, MaxSize: 40}}
+
+	log := logger.NewTestLogger()
+	taskID := uint64(1)
+
+	tl := NewTaskLogger(cfg, log, logstore.NewFileStore(cfg, log), taskID)
+	assert.NoError(t, tl.CreateLogFile())
+	tl.Listen()
+
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		tl.Write(model.LogStream_Stdout, now, []byte(fmt.Sprintf("l-%02d\n", i)))
+	}
+
+	// the tail reaches the disk before the logger is closed, and the file is compacted as lines are dropped
+	path := FormatTailFileName(tmpDir, taskID)
+	assert.Eventually(t, func() bool {
+		lines := readTailFile(t, path)
+		return len(lines) > 0 && lines[len(lines)-1] == "l-99\n"
+	}, time.Second, FLUSH_INTERVAL/2)
+
+	lines := readTailFile(t, path)
+	assert.Less(t, len(lines), 40)
+	assert.Equal(t, []string{"l-96\n", "l-97\n", "l-98\n", "l-99\n"}, lines[len(lines)-4:])
+
+	assert.NoError(t, tl.Close())
+	assert.True(t, tl.Truncated())
+	assert.NoFileExists(t, path)
+
+	content, err := os.ReadFile(logreader.FormatFileName(tmpDir, taskID))
+	assert.NoError(t, err)
+	assert.Equal(t, "l-00\nl-01\nl-02\nl-03\n[... 92 lines (460 bytes) truncated ...]\nl-96\nl-97\nl-98\nl-99\n", string(content))
+}
+
+func TestTailBuffer_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1.tail")
+	tail, err := newTailBuffer(10, path)
+	assert.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, tail.push(&entry{stream: model.LogStream_Stdout, line: []byte(fmt.Sprintf("%d\n", i%10))}))
+	}
+	assert.NoError(t, tail.flush())
+
+	// the file starts with the marker of the lines dropped before the last compaction
+	lines := readTailFile(t, path)
+	assert.Contains(t, lines[0], "truncated")
+	assert.Equal(t, []string{"5\n", "6\n", "7\n", "8\n", "9\n"}, lines[len(lines)-5:])
+	assert.NoFileExists(t, path+".tmp")
+
+	assert.NoError(t, tail.remove())
+	assert.NoFileExists(t, path)
 }
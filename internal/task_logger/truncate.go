@@ -0,0 +1,155 @@
+package tasklogger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	logstore "github.com/fattymango/px-take-home/internal/log_store"
+)
+
+const TAIL_RECORD_HEADER_SIZE = 1 + 8 + 4 // stream, time and line length of a record of the tail file
+
+// FormatTailFileName returns the file keeping the tail of a truncated log until the task logger is closed
+func FormatTailFileName(dirpath string, taskID uint64) string {
+	return filepath.Join(dirpath, fmt.Sprintf("%d.tail", taskID))
+}
+
+// tailBuffer keeps the last lines of the output up to size bytes, older lines are dropped and counted.
+//
+// The lines are also appended to a ring file as they arrive, so the tail survives a crash of the server.
+// The file is rewritten with the truncation marker and the kept lines once the dropped lines take as much
+// space as the kept ones, the tail is the last lines of the file up to size bytes.
+type tailBuffer struct {
+	size    int64
+	used    int64
+	entries []*entry
+
+	dropped      int64
+	droppedBytes int64
+	first        *entry // first dropped line
+
+	path     string
+	file     *os.File
+	writer   *bufio.Writer
+	fileSize int64
+}
+
+func newTailBuffer(size int64, path string) (*tailBuffer, error) {
+	b := &tailBuffer{size: size, path: path}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create tail file directory: %w", err)
+	}
+	if err := b.open(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *tailBuffer) open() error {
+	file, err := os.OpenFile(b.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create tail file: %w", err)
+	}
+	b.file = file
+	b.writer = bufio.NewWriterSize(file, logstore.MAX_BUF_SIZE)
+	b.fileSize = 0
+	return nil
+}
+
+func (b *tailBuffer) push(e *entry) error {
+	b.entries = append(b.entries, e)
+	b.used += int64(len(e.line))
+
+	drop := 0
+	for b.used > b.size && drop < len(b.entries) {
+		d := b.entries[drop]
+		if b.dropped == 0 {
+			b.first = &entry{stream: d.stream, time: d.time}
+		}
+		b.dropped++
+		b.droppedBytes += int64(len(d.line))
+		b.used -= int64(len(d.line))
+		drop++
+	}
+	if drop > 0 {
+		b.entries = b.entries[drop:]
+	}
+
+	if b.fileSize > 2*(b.used+int64(len(b.entries))*TAIL_RECORD_HEADER_SIZE)+b.size {
+		return b.compact()
+	}
+	return b.writeRecord(e)
+}
+
+func (b *tailBuffer) writeRecord(e *entry) error {
+	var header [TAIL_RECORD_HEADER_SIZE]byte
+	header[0] = byte(e.stream)
+	binary.LittleEndian.PutUint64(header[1:9], uint64(e.time))
+	binary.LittleEndian.PutUint32(header[9:], uint32(len(e.line)))
+	if _, err := b.writer.Write(header[:]); err != nil {
+		return fmt.Errorf("failed to write tail file: %w", err)
+	}
+	if _, err := b.writer.Write(e.line); err != nil {
+		return fmt.Errorf("failed to write tail file: %w", err)
+	}
+	b.fileSize += int64(TAIL_RECORD_HEADER_SIZE + len(e.line))
+	return nil
+}
+
+// compact rewrites the file with the marker and the kept lines, the new file replaces the old one once complete
+func (b *tailBuffer) compact() error {
+	if err := b.file.Close(); err != nil {
+		return fmt.Errorf("failed to close tail file: %w", err)
+	}
+
+	path := b.path
+	b.path = path + ".tmp"
+	err := b.open()
+	b.path = path
+	if err != nil {
+		return err
+	}
+
+	if b.dropped > 0 {
+		if err := b.writeRecord(b.marker()); err != nil {
+			return err
+		}
+	}
+	for _, e := range b.entries {
+		if err := b.writeRecord(e); err != nil {
+			return err
+		}
+	}
+	if err := b.flush(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to replace tail file: %w", err)
+	}
+	return nil
+}
+
+func (b *tailBuffer) flush() error {
+	return b.writer.Flush()
+}
+
+// remove deletes the file once the tail is written to the log
+func (b *tailBuffer) remove() error {
+	b.file.Close()
+	if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove tail file: %w", err)
+	}
+	return nil
+}
+
+// marker returns the line written in place of the dropped lines, it takes the stream and time of the first one
+func (b *tailBuffer) marker() *entry {
+	return &entry{
+		stream: b.first.stream,
+		time:   b.first.time,
+		line:   []byte(fmt.Sprintf("[... %d lines (%d bytes) truncated ...]\n", b.dropped, b.droppedBytes)),
+	}
+}
@@ -0,0 +1,28 @@
+package model
+
+type LogStream uint8
+
+const (
+	LogStream_Stdout LogStream = iota + 1
+	LogStream_Stderr
+)
+
+var (
+	LogStream_name = map[LogStream]string{
+		LogStream_Stdout: "stdout",
+		LogStream_Stderr: "stderr",
+	}
+	LogStream_value = map[string]LogStream{
+		"stdout": LogStream_Stdout,
+		"stderr": LogStream_Stderr,
+	}
+)
+
+// TaskLogLine is a single line of a task log, used by the SQL log store
+type TaskLogLine struct {
+	TaskID     uint64    `gorm:"column:task_id;primaryKey;autoIncrement:false"`
+	LineNumber int       `gorm:"column:line_number;primaryKey;autoIncrement:false"` // 1-based
+	Stream     LogStream `gorm:"column:stream;not null"`
+	Time       int64     `gorm:"column:time;not null;index"` // unix nano
+	Text       string    `gorm:"column:text;type:text;not null"`
+}
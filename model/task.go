@@ -1,5 +1,7 @@
 package model
 
+import "slices"
+
 type TaskStatus uint8
 
 const (
@@ -8,6 +10,8 @@ const (
 	TaskStatus_Completed
 	TaskStatus_Failed
 	TaskStatus_Cancelled
+	TaskStatus_PendingApproval
+	TaskStatus_Rejected
 )
 
 var (
@@ -17,6 +21,9 @@ var (
 		TaskStatus_Completed: "completed",
 		TaskStatus_Failed:    "failed",
 		TaskStatus_Cancelled: "canceled",
+
+		TaskStatus_PendingApproval: "pending_approval",
+		TaskStatus_Rejected:        "rejected",
 	}
 	TaskStatus_value = map[string]TaskStatus{
 		"queued":    TaskStatus_Queued,
@@ -24,6 +31,36 @@ var (
 		"completed": TaskStatus_Completed,
 		"failed":    TaskStatus_Failed,
 		"canceled":  TaskStatus_Cancelled,
+
+		"pending_approval": TaskStatus_PendingApproval,
+		"rejected":         TaskStatus_Rejected,
+	}
+)
+
+// TaskStatus_Finished are the terminal statuses, tasks in these statuses never change status again
+var TaskStatus_Finished = []TaskStatus{
+	TaskStatus_Completed,
+	TaskStatus_Failed,
+	TaskStatus_Cancelled,
+	TaskStatus_Rejected,
+}
+
+// Finished reports whether the status is a terminal status
+func (s TaskStatus) Finished() bool {
+	return slices.Contains(TaskStatus_Finished, s)
+}
+
+type ReviewDecision uint8
+
+const (
+	ReviewDecision_Approved ReviewDecision = iota + 1
+	ReviewDecision_Rejected
+)
+
+var (
+	ReviewDecision_name = map[ReviewDecision]string{
+		ReviewDecision_Approved: "approved",
+		ReviewDecision_Rejected: "rejected",
 	}
 )
 
@@ -31,10 +68,28 @@ type Task struct {
 	ID        uint64     `gorm:"column:id;primary_key;auto_increment" json:"id"`
 	Name      string     `gorm:"column:name;not null" json:"name"`
 	Command   string     `gorm:"column:command;not null" json:"command"`
-	Reason    string     `gorm:"column:reason;not null" json:"reason"` // Reason for canceling the task
+	Owner     string     `gorm:"column:owner;index;not null;default:''" json:"owner"` // Client that submitted the task, API key hash or IP
+	Reason    string     `gorm:"column:reason;not null" json:"reason"`                // Reason for canceling the task
 	Status    TaskStatus `gorm:"column:status;not null" json:"status"`
 	ExitCode  int        `gorm:"column:exit_code;not null" json:"exit_code"`
 	StartTime uint64     `gorm:"column:start_time;not null" json:"start_time"`
 	EndTime   uint64     `gorm:"column:end_time;not null" json:"end_time"`
+	// Number of redactions applied to the task output, per redact rule name
+	Redactions map[string]int64 `gorm:"column:redactions;type:text;serializer:json" json:"redactions"`
+	// Part of the output was dropped from the log file to keep it under the max size
+	Truncated bool `gorm:"column:truncated;not null;default:false" json:"truncated"`
+	// A log over the max size has the first LogHeadLines lines of the output, then a marker line
+	// in place of the LogDroppedLines next ones, they map the lines of the log to the lines of the output
+	LogHeadLines    int `gorm:"column:log_head_lines;not null;default:0" json:"log_head_lines"`
+	LogDroppedLines int `gorm:"column:log_dropped_lines;not null;default:0" json:"log_dropped_lines"`
+	// Stdin of the command is kept open for the input sent over the WebSocket API, otherwise it reads EOF
+	Stdin bool `gorm:"column:stdin;not null;default:false" json:"stdin"`
+
+	// Approval workflow, only set for tasks flagged by the command validator
+	Findings       string         `gorm:"column:findings;not null;default:''" json:"findings"` // Validator output
+	ReviewDecision ReviewDecision `gorm:"column:review_decision;not null;default:0" json:"review_decision"`
+	ReviewedBy     string         `gorm:"column:reviewed_by;not null;default:''" json:"reviewed_by"`
+	ReviewComment  string         `gorm:"column:review_comment;not null;default:''" json:"review_comment"`
+	ReviewedAt     uint64         `gorm:"column:reviewed_at;not null;default:0" json:"reviewed_at"`
 	CommonModel
 }
@@ -1,8 +1,11 @@
 package ctxstore
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 
+	"github.com/fattymango/px-take-home/config"
 	"github.com/fattymango/px-take-home/dto"
 	"github.com/fattymango/px-take-home/model"
 	"github.com/gofiber/fiber/v2"
@@ -26,6 +29,15 @@ func GetTaskLogFilterFromCtx(ctx *fiber.Ctx) (*dto.TaskLogFilter, error) {
 	return filter, nil
 }
 
+func GetTaskLogSearchQueryFromCtx(ctx *fiber.Ctx) (*dto.TaskLogSearchQuery, error) {
+	query := &dto.TaskLogSearchQuery{}
+	if err := ctx.QueryParser(query); err != nil {
+		return nil, fmt.Errorf("failed to parse task log search query: %w", err)
+	}
+
+	return query, nil
+}
+
 func GetOffsetLimitQueryFromCtx(ctx *fiber.Ctx) (int, int) {
 	offset := ctx.QueryInt("offset", 0)
 	limit := ctx.QueryInt("limit", 10)
@@ -50,3 +62,77 @@ func GetStatusQueryFromCtx(ctx *fiber.Ctx) (model.TaskStatus, error) {
 
 	return model.TaskStatus(status), nil
 }
+
+func GetAPIKeyFromCtx(ctx *fiber.Ctx, header string) string {
+	return ctx.Get(header)
+}
+
+// GetClientIDFromCtx identifies the client by its API key when it is one of the configured keys, otherwise by
+// its verified client certificate or its IP. The key is hashed so it can be stored on tasks without leaking it.
+func GetClientIDFromCtx(ctx *fiber.Ctx, auth *config.Auth) string {
+	if key := GetAPIKeyFromCtx(ctx, auth.APIKeyHeader); auth.HasKey(key) {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+
+	if state := ctx.Context().TLSConnectionState(); state != nil && len(state.VerifiedChains) > 0 {
+		return "cert:" + state.VerifiedChains[0][0].Subject.CommonName
+	}
+
+	return "ip:" + ctx.IP()
+}
+
+func GetTaskLogFollowQueryFromCtx(ctx *fiber.Ctx) (*dto.TaskLogFollowQuery, error) {
+	query := &dto.TaskLogFollowQuery{}
+	if err := ctx.QueryParser(query); err != nil {
+		return nil, fmt.Errorf("failed to parse task log follow query: %w", err)
+	}
+
+	return query, nil
+}
+
+func GetTaskLogDownloadQueryFromCtx(ctx *fiber.Ctx) (*dto.TaskLogDownloadQuery, error) {
+	query := &dto.TaskLogDownloadQuery{}
+	if err := ctx.QueryParser(query); err != nil {
+		return nil, fmt.Errorf("failed to parse task log download query: %w", err)
+	}
+
+	return query, nil
+}
+
+func GetLogSearchQueryFromCtx(ctx *fiber.Ctx) (*dto.LogSearchQuery, error) {
+	query := &dto.LogSearchQuery{}
+	if err := ctx.QueryParser(query); err != nil {
+		return nil, fmt.Errorf("failed to parse log search query: %w", err)
+	}
+
+	return query, nil
+}
+
+// GetDiffTaskIDFromCtx returns the ID of the task whose log is compared to the log of the taskID task
+func GetDiffTaskIDFromCtx(ctx *fiber.Ctx) (uint64, error) {
+	taskID, err := ctx.ParamsInt("otherTaskID")
+	if err != nil {
+		return 0, fmt.Errorf("ID of the task to compare is required")
+	}
+
+	return uint64(taskID), nil
+}
+
+func GetTaskLogDiffQueryFromCtx(ctx *fiber.Ctx) (*dto.TaskLogDiffQuery, error) {
+	query := &dto.TaskLogDiffQuery{}
+	if err := ctx.QueryParser(query); err != nil {
+		return nil, fmt.Errorf("failed to parse task log diff query: %w", err)
+	}
+
+	return query, nil
+}
+
+func GetEventsQueryFromCtx(ctx *fiber.Ctx) (*dto.EventsQuery, error) {
+	query := &dto.EventsQuery{}
+	if err := ctx.QueryParser(query); err != nil {
+		return nil, fmt.Errorf("failed to parse events query: %w", err)
+	}
+
+	return query, nil
+}
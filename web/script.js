@@ -1,5 +1,5 @@
 // API Configuration
-const API_BASE_URL = 'http://localhost:8888/api/v1';
+const API_BASE_URL = `${window.location.origin}/api/v1`;
 
 // Pagination State
 let paginationState = {
@@ -14,13 +14,23 @@ const TaskStatus = {
     2: 'Running',
     3: 'Completed',
     4: 'Failed',
-    5: 'Canceled'
+    5: 'Canceled',
+    6: 'Pending Approval',
+    7: 'Rejected'
 };
 
 // Event Types
 const MsgTypeTaskStatus = 1;
 const MsgTypeLog = 2;
 
+// Log Streams
+const LogStreamStdout = 1;
+const LogStreamStderr = 2;
+const LogStreamValue = {
+    stdout: LogStreamStdout,
+    stderr: LogStreamStderr
+};
+
 // DOM Elements
 const createTaskForm = document.getElementById('createTaskForm');
 const tasksList = document.getElementById('tasksList');
@@ -32,10 +42,22 @@ const refreshLogsBtn = document.getElementById('refreshLogs');
 const fromLineInput = document.getElementById('fromLine');
 const toLineInput = document.getElementById('toLine');
 const fetchRangeBtn = document.getElementById('fetchRange');
+const logStreamSelect = document.getElementById('logStream');
 const prevPageBtn = document.getElementById('prevPage');
 const nextPageBtn = document.getElementById('nextPage');
 const pageSizeSelect = document.getElementById('pageSize');
 const pageInfo = document.getElementById('pageInfo');
+const logSearchForm = document.getElementById('logSearchForm');
+const searchQueryInput = document.getElementById('searchQuery');
+const searchRegexInput = document.getElementById('searchRegex');
+const searchIgnoreCaseInput = document.getElementById('searchIgnoreCase');
+const searchContextSelect = document.getElementById('searchContext');
+const searchResults = document.getElementById('searchResults');
+const searchInfo = document.getElementById('searchInfo');
+const searchMatches = document.getElementById('searchMatches');
+const searchPrevBtn = document.getElementById('searchPrev');
+const searchNextBtn = document.getElementById('searchNext');
+const searchCloseBtn = document.getElementById('searchClose');
 
 let currentTaskId = null;
 let isLoadingLogs = false;
@@ -51,8 +73,19 @@ let currentLogState = {
     prefetchedLogs: null  // Store prefetched logs
 };
 
+// Log search pagination
+let searchState = {
+    offset: 0,
+    limit: 20,
+    totalMatches: 0,
+    totalLines: 0
+};
+
 // SSE connection
 let eventSource = null;
+let logEventSource = null;
+let lastStatusEventId = '';
+let lastLogEventId = '';
 
 // Buffer for collecting log messages before rendering
 let logBuffer = [];
@@ -65,6 +98,7 @@ createTaskForm.addEventListener('submit', handleCreateTask);
 refreshButton.addEventListener('click', () => fetchTasks());
 closeModalBtn.addEventListener('click', () => {
     logsModal.style.display = 'none';
+    closeSearch();
     currentTaskId = null;
     resetLogState();
 });
@@ -82,6 +116,12 @@ fetchRangeBtn.addEventListener('click', () => {
         fetchLogs(currentTaskId, from, to);
     }
 });
+logStreamSelect.addEventListener('change', () => {
+    if (currentTaskId) {
+        resetLogState();
+        fetchLogs(currentTaskId);
+    }
+});
 prevPageBtn.addEventListener('click', () => {
     if (paginationState.currentPage > 1) {
         paginationState.currentPage--;
@@ -102,6 +142,8 @@ pageSizeSelect.addEventListener('change', (e) => {
 window.addEventListener('click', (e) => {
     if (e.target === logsModal) {
         logsModal.style.display = 'none';
+        closeSearch();
+        closeLogEvents();
         currentTaskId = null;
         resetLogState();
     }
@@ -239,7 +281,7 @@ function renderTasks(data) {
 
     tasksList.innerHTML = tasks.map(task => {
         const status = TaskStatus[task.status];
-        const statusLower = status.toLowerCase();
+        const statusLower = status.toLowerCase().replace(' ', '-');
         const isRunning = task.status === 1 || task.status === 2; // Queued or Running
         
         return `
@@ -255,10 +297,12 @@ function renderTasks(data) {
                     ${task.exit_code !== undefined && !isRunning ? 
                         `<p><strong>Exit Code:</strong> ${task.exit_code}</p>` : ''}
                     ${task.reason ? `<p><strong>Reason:</strong> ${task.reason}</p>` : ''}
+                    ${task.findings ? `<p><strong>Findings:</strong></p><pre class="findings">${escapeHtml(task.findings)}</pre>` : ''}
+                    ${task.review_comment ? `<p><strong>Review Comment:</strong> ${escapeHtml(task.review_comment)}</p>` : ''}
                 </div>
                 <div class="task-actions">
                     <button onclick="showLogs(${task.id})">View Logs</button>
-                    ${!isRunning ? 
+                    ${task.status !== 1 && task.status !== 6 ? 
                         `<button class="download-btn" onclick="downloadLogs(${task.id})">Download Logs</button>` : ''}
                     ${isRunning ? 
                         `<button class="cancel-btn" onclick="cancelTask(${task.id})">Cancel</button>` : ''}
@@ -268,6 +312,12 @@ function renderTasks(data) {
     }).join('');
 }
 
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
 function updatePaginationControls(data) {
     const { tasks, total } = data;
     paginationState.totalTasks = total;
@@ -287,6 +337,7 @@ function updatePaginationControls(data) {
 
 async function showLogs(taskId) {
     currentTaskId = taskId;
+    connectToLogEvents(taskId);
     resetLogState();
     currentLogState.taskId = taskId;
     logsModal.style.display = 'block';
@@ -341,6 +392,8 @@ async function prefetchLogs(taskId, from, to) {
         const queryParams = new URLSearchParams();
         if (from > 0) queryParams.append('from', from);
         if (to > 0) queryParams.append('to', to);
+        queryParams.append('stream', logStreamSelect.value);
+        queryParams.append('render', 'html');
         
         const response = await fetch(`${API_BASE_URL}/tasks/${taskId}/logs?${queryParams}`);
         if (!response.ok) {
@@ -384,7 +437,7 @@ function insertPrefetchedLogs() {
     
     // Prepend new logs
     const logsContainer = document.createElement('div');
-    logsContainer.innerHTML = currentLogState.prefetchedLogs.logs.map(log => `<p>${log}</p>`).join('');
+    logsContainer.innerHTML = currentLogState.prefetchedLogs.logs.map(renderLogLine).join('');
     logsContent.insertBefore(logsContainer, header.nextSibling);
     
     // Restore scroll position
@@ -403,6 +456,8 @@ async function fetchLogs(taskId, from = 0, to = 0) {
         const queryParams = new URLSearchParams();
         if (from > 0) queryParams.append('from', from);
         if (to > 0) queryParams.append('to', to);
+        queryParams.append('stream', logStreamSelect.value);
+        queryParams.append('render', 'html');
         
         const response = await fetch(`${API_BASE_URL}/tasks/${taskId}/logs?${queryParams}`);
         if (!response.ok) {
@@ -443,7 +498,7 @@ function renderLogs(logs, totalLines) {
     }
 
     const header = `<div class="logs-header">Showing lines ${currentLogState.loadedLines.from}-${currentLogState.loadedLines.to} of ${totalLines}</div>`;
-    const logsHtml = logs.map(log => `<p>${log}</p>`).join('');
+    const logsHtml = logs.map(renderLogLine).join('');
     logsContent.innerHTML = header + logsHtml;
     
     // Scroll to bottom of logs on initial load
@@ -452,55 +507,166 @@ function renderLogs(logs, totalLines) {
     }
 }
 
+// Log timestamps are in unix nano
+function formatLogTimestamp(timestamp) {
+    if (!timestamp) return '';
+    return new Date(timestamp / 1e6).toISOString();
+}
+
+// stderr lines are rendered differently from stdout lines, the capture time is shown on hover.
+// Lines are fetched with render=html, they are escaped and their colors are spans with ansi-* classes.
+function renderLogLine(log) {
+    const streamClass = log.stream === LogStreamStderr ? ' class="log-stderr"' : '';
+    return `<p${streamClass} data-line="${log.line_number}" title="${formatLogTimestamp(log.timestamp)}">${log.line}</p>`;
+}
+
+// Live lines are sent as captured, their escape sequences are removed like render=plain does
+const ANSI_SEQUENCE = /\x1b(?:\[[0-?]*[ -\/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[ -\/]*[0-~])|[\x00-\x08\x0a-\x1f\x7f]/g;
+function stripAnsi(text) {
+    return text.replace(ANSI_SEQUENCE, '');
+}
+
+logSearchForm.addEventListener('submit', (e) => {
+    e.preventDefault();
+    searchState.offset = 0;
+    searchLogs();
+});
+searchPrevBtn.addEventListener('click', () => {
+    searchState.offset = Math.max(0, searchState.offset - searchState.limit);
+    searchLogs();
+});
+searchNextBtn.addEventListener('click', () => {
+    searchState.offset += searchState.limit;
+    searchLogs();
+});
+searchCloseBtn.addEventListener('click', closeSearch);
+searchMatches.addEventListener('click', (e) => {
+    const match = e.target.closest('.search-match');
+    if (match) {
+        jumpToLine(parseInt(match.dataset.line));
+    }
+});
+
+async function searchLogs() {
+    if (!currentTaskId || !searchQueryInput.value) return;
+
+    const queryParams = new URLSearchParams({
+        q: searchQueryInput.value,
+        regex: searchRegexInput.checked,
+        ignore_case: searchIgnoreCaseInput.checked,
+        context: searchContextSelect.value,
+        stream: logStreamSelect.value,
+        offset: searchState.offset,
+        limit: searchState.limit
+    });
+
+    searchResults.style.display = 'block';
+    searchInfo.textContent = 'Searching...';
+    try {
+        const response = await fetch(`${API_BASE_URL}/tasks/${currentTaskId}/logs/search?${queryParams}`);
+        const result = await response.json();
+        if (!response.ok || !result.success) {
+            throw new Error(result.error || `HTTP error! status: ${response.status}`);
+        }
+        renderSearchResults(result.data);
+    } catch (error) {
+        console.error('Error searching logs:', error);
+        searchInfo.textContent = `Search failed: ${error.message}`;
+        searchMatches.innerHTML = '';
+    }
+}
+
+// Highlights are [start, end) character offsets, Array.from splits the line in characters like the server does
+function highlightText(text, highlights) {
+    const chars = Array.from(text);
+    let html = '';
+    let last = 0;
+    (highlights || []).forEach(([start, end]) => {
+        html += escapeHtml(chars.slice(last, start).join(''));
+        html += `<mark>${escapeHtml(chars.slice(start, end).join(''))}</mark>`;
+        last = end;
+    });
+    return html + escapeHtml(chars.slice(last).join(''));
+}
+
+function renderSearchLine(log, html, className) {
+    return `<p class="${className}"><span class="line-number">${log.line_number}</span>${html}</p>`;
+}
+
+function renderSearchResults(data) {
+    const matches = data.matches || [];
+    searchState.totalMatches = data.total_matches;
+    searchState.totalLines = data.total_lines;
+
+    searchInfo.textContent = matches.length === 0
+        ? `No matches in ${data.total_lines} lines`
+        : `Matches ${searchState.offset + 1}-${searchState.offset + matches.length} of ${data.total_matches} in ${data.total_lines} lines`;
+    searchPrevBtn.disabled = searchState.offset === 0;
+    searchNextBtn.disabled = searchState.offset + matches.length >= data.total_matches;
+
+    searchMatches.innerHTML = matches.map(match => {
+        const before = (match.before || []).map(log => renderSearchLine(log, escapeHtml(log.line), 'search-context')).join('');
+        const after = (match.after || []).map(log => renderSearchLine(log, escapeHtml(log.line), 'search-context')).join('');
+        const streamClass = match.stream === LogStreamStderr ? 'log-stderr' : '';
+        return `<div class="search-match" data-line="${match.line_number}" title="Show line ${match.line_number}">
+            ${before}${renderSearchLine(match, highlightText(match.line, match.highlights), streamClass)}${after}
+        </div>`;
+    }).join('');
+}
+
+// Loads the lines around a match with the range API and scrolls to it
+async function jumpToLine(line) {
+    const from = Math.max(1, line - 50);
+    const to = Math.max(from + 1, Math.min(line + 50, searchState.totalLines));
+    resetLogState();
+    await fetchLogs(currentTaskId, from, to);
+
+    const target = logsContent.querySelector(`[data-line="${line}"]`);
+    if (target) {
+        target.classList.add('log-target');
+        target.scrollIntoView({ block: 'center' });
+    }
+}
+
+function closeSearch() {
+    searchResults.style.display = 'none';
+    searchMatches.innerHTML = '';
+    searchState.offset = 0;
+}
+
+// Builds the URL of an event stream, resuming after the last event received so the missed events are replayed
+function eventsUrl(params, lastEventId) {
+    const query = new URLSearchParams(params);
+    if (lastEventId) {
+        query.set('last_event_id', lastEventId);
+    }
+    return `${API_BASE_URL}/events?${query}`;
+}
+
 function connectToSSE() {
     if (eventSource) {
         eventSource.close();
     }
 
     console.log('Connecting to SSE...');
-    eventSource = new EventSource(`${API_BASE_URL}/events`);
+    // Status updates of every task, the logs of the task shown are streamed by connectToLogEvents
+    eventSource = new EventSource(eventsUrl({ types: 'status' }, lastStatusEventId));
 
     // Handle connection event
     eventSource.addEventListener('connect', (e) => {
+        lastStatusEventId = e.lastEventId;
         console.log('SSE Connected:', e.data);
     });
 
+    // Some of the events missed while disconnected are gone, reload the tasks instead
+    eventSource.addEventListener('resync', () => {
+        fetchTasks();
+    });
+
     // Handle all messages through onmessage
     eventSource.onmessage = (e) => {
-        try {
-            // Remove "data: " prefix and parse the JSON
-            const rawData = e.data.replace(/^data: /, '');
-            const data = JSON.parse(rawData);
-            
-            // Log the parsed message for debugging
-            // console.debug('Parsed SSE message:', data);
-            
-            // Handle ping messages
-            if (data.ping !== undefined) {
-                console.debug('Received ping:', data.ping);
-                return;
-            }
-            
-            // Handle regular messages
-            const eventType = parseInt(data.event);
-            if (isNaN(eventType)) {
-                console.warn('Invalid event type:', data.event);
-                return;
-            }
-
-            switch (eventType) {
-                case MsgTypeLog:
-                    handleLogMessage(data);
-                    break;
-                case MsgTypeTaskStatus:
-                    handleTaskStatusMessage(data);
-                    break;
-                default:
-                    console.warn('Unknown event type:', eventType);
-            }
-        } catch (error) {
-            console.error('Error processing SSE message:', error, e.data);
-        }
+        lastStatusEventId = e.lastEventId;
+        handleEventMessage(e);
     };
 
     eventSource.onopen = () => {
@@ -515,14 +681,94 @@ function connectToSSE() {
     };
 }
 
+// Streams the log lines of a single task, only while its logs are shown. Reconnections resume after the last line received.
+function connectToLogEvents(taskId, lastEventId = '') {
+    closeLogEvents();
+    lastLogEventId = lastEventId;
+    logEventSource = new EventSource(eventsUrl({ types: 'log', task_id: taskId }, lastEventId));
+    logEventSource.addEventListener('connect', (e) => {
+        lastLogEventId = e.lastEventId;
+    });
+    logEventSource.addEventListener('resync', () => {
+        if (currentTaskId === taskId) {
+            resetLogState();
+            fetchLogs(taskId);
+        }
+    });
+    logEventSource.onmessage = (e) => {
+        lastLogEventId = e.lastEventId;
+        handleEventMessage(e);
+    };
+    logEventSource.onerror = (error) => {
+        console.error('SSE log connection error:', error);
+        const lastEventId = lastLogEventId;
+        closeLogEvents();
+        setTimeout(() => {
+            if (currentTaskId === taskId && !logEventSource) {
+                connectToLogEvents(taskId, lastEventId);
+            }
+        }, 5000);
+    };
+}
+
+function closeLogEvents() {
+    if (logEventSource) {
+        logEventSource.close();
+        logEventSource = null;
+    }
+}
+
+function handleEventMessage(e) {
+    try {
+        // Remove "data: " prefix and parse the JSON
+        const rawData = e.data.replace(/^data: /, '');
+        const data = JSON.parse(rawData);
+        
+        // Log the parsed message for debugging
+        // console.debug('Parsed SSE message:', data);
+        
+        // Handle ping messages
+        if (data.ping !== undefined) {
+            console.debug('Received ping:', data.ping);
+            return;
+        }
+        
+        // Handle regular messages
+        const eventType = parseInt(data.event);
+        if (isNaN(eventType)) {
+            console.warn('Invalid event type:', data.event);
+            return;
+        }
+
+        switch (eventType) {
+            case MsgTypeLog:
+                handleLogMessage(data);
+                break;
+            case MsgTypeTaskStatus:
+                handleTaskStatusMessage(data);
+                break;
+            default:
+                console.warn('Unknown event type:', eventType);
+        }
+    } catch (error) {
+        console.error('Error processing SSE message:', error, e.data);
+    }
+}
+
 function handleLogMessage(data) {
     const taskId = parseInt(data.task_id);
     if (taskId === currentTaskId) {
         // Add to buffer with line number
         const logValue = data.value;
+        const selectedStream = LogStreamValue[logStreamSelect.value];
+        if (selectedStream && logValue.stream !== selectedStream) {
+            return;
+        }
         const logEntry = {
             line: logValue.line,
-            lineNumber: logValue.line_number
+            lineNumber: logValue.line_number,
+            stream: logValue.stream,
+            timestamp: logValue.timestamp
         };
 
         logBuffer.push(logEntry);
@@ -556,8 +802,9 @@ function flushLogBuffer() {
     // Create elements for all buffered logs
     logBuffer.forEach(log => {
         const logLine = document.createElement('div');
-        logLine.className = 'log-line';
-        logLine.innerHTML = `<span class="log-message">${log.line}</span>`;
+        logLine.className = log.stream === LogStreamStderr ? 'log-line log-stderr' : 'log-line';
+        logLine.title = formatLogTimestamp(log.timestamp);
+        logLine.innerHTML = `<span class="log-message">${escapeHtml(stripAnsi(log.line))}</span>`;
         fragment.appendChild(logLine);
     });
 
@@ -612,7 +859,7 @@ function handleTaskStatusMessage(data) {
         const statusElement = taskElement.querySelector('.task-status');
         const newStatus = TaskStatus[taskValue.status];
         statusElement.textContent = newStatus;
-        statusElement.className = `task-status status-${newStatus.toLowerCase()}`;
+        statusElement.className = `task-status status-${newStatus.toLowerCase().replace(' ', '-')}`;
 
         // Get the task info container
         const taskInfo = taskElement.querySelector('.task-info');
@@ -641,7 +888,7 @@ function handleTaskStatusMessage(data) {
 
         // Update action buttons based on new status
         const actionButtons = taskElement.querySelector('.task-actions');
-        const statusLower = newStatus.toLowerCase();
+        const statusLower = newStatus.toLowerCase().replace(' ', '-');
         if (statusLower === 'queued' || statusLower === 'running') {
             if (!actionButtons.querySelector('.cancel-btn')) {
                 const cancelBtn = document.createElement('button');
@@ -668,6 +915,8 @@ connectToSSE();
 // Update cleanup when closing modal
 function closeLogsModal() {
     logsModal.style.display = 'none';
+    closeSearch();
+    closeLogEvents();
     currentTaskId = null;
     resetLogState();
     logsContent.onscroll = null;
@@ -680,6 +929,7 @@ window.addEventListener('beforeunload', () => {
     if (eventSource) {
         eventSource.close();
     }
+    closeLogEvents();
 });
 
 async function cancelTask(taskId) {